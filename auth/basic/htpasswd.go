@@ -0,0 +1,181 @@
+package basic
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ParseHtpasswd parses the users of an htpasswd file, one "username:hash"
+// per line. Blank lines and lines starting with # are skipped. Hashes must be
+// in one of the formats MemoryStore supports.
+func ParseHtpasswd(r io.Reader) (MemoryStore, error) {
+	users := MemoryStore{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("htpasswd: malformed line %d", n)
+		}
+		if !supportedHash(line[i+1:]) {
+			return nil, fmt.Errorf("htpasswd: unsupported hash format on line %d", n)
+		}
+		users[line[:i]] = line[i+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+const plainPrefix = "{PLAIN}"
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$")
+}
+
+func supportedHash(hash string) bool {
+	for _, prefix := range []string{"{SHA}", "$apr1$", plainPrefix} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return isBcrypt(hash)
+}
+
+// verifyPassword reports whether the password matches the hash, which is in
+// one of the htpasswd formats: bcrypt ($2y$, $2a$ or $2b$), SHA-1 ({SHA}),
+// APR1-MD5 ($apr1$), or plain text with the {PLAIN} prefix. Hashes in other
+// formats match no password.
+func verifyPassword(hash, password string) bool {
+	switch {
+	case isBcrypt(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return constantTimeEqual(hash[len("{SHA}"):], base64.StdEncoding.EncodeToString(sum[:]))
+	case strings.HasPrefix(hash, "$apr1$"):
+		parts := strings.SplitN(hash[len("$apr1$"):], "$", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		return constantTimeEqual(hash, apr1(password, parts[0]))
+	case strings.HasPrefix(hash, plainPrefix):
+		return constantTimeEqual(hash[len(plainPrefix):], password)
+	default:
+		return false
+	}
+}
+
+var dummyHashes sync.Map // bcrypt cost: dummy hash
+
+// dummyHash returns a hash in the format, and of the cost, of the hash, to
+// check the passwords of unknown users against, so that they take as long to
+// be rejected as the ones of known users. The result of the check must be
+// ignored.
+func dummyHash(hash string) string {
+	if !isBcrypt(hash) {
+		return hash // the other formats have a fixed cost
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return hash
+	}
+	if dummy, ok := dummyHashes.Load(cost); ok {
+		return dummy.(string)
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte("dummy password"), cost)
+	if err != nil {
+		return hash
+	}
+	dummyHashes.Store(cost, string(dummy))
+	return string(dummy)
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare(toHashSlice([]byte(a)), toHashSlice([]byte(b))) == 1
+}
+
+// apr1 returns the APR1-MD5 hash of the password with the salt, as computed
+// by htpasswd -m.
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw, s := []byte(password), []byte(salt)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	h := md5.New()
+	h.Write(pw)
+	h.Write([]byte(magic))
+	h.Write(s)
+	for i := len(pw); i > 0; i -= md5.Size {
+		if i > md5.Size {
+			h.Write(altSum)
+		} else {
+			h.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(sum[i[0]])<<16|uint(sum[i[1]])<<8|uint(sum[i[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+	return b.String()
+}
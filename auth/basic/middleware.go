@@ -7,13 +7,28 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
 )
 
+type contextKey string
+
+// PrincipalContextKey holds the key used to store the authenticated username
+// in the context.
+const PrincipalContextKey contextKey = "BasicPrincipal"
+
+// Principal returns the username authenticated by the middleware, if any. It
+// may be used as the subject of casbin.NewContextEnforcer.
+func Principal(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(PrincipalContextKey).(string)
+	return username, ok
+}
+
 // AuthError represents an authorization error.
 type AuthError struct {
 	Realm string
@@ -88,7 +103,108 @@ func AuthMiddleware(requiredUser, requiredPassword, realm string) endpoint.Middl
 				return nil, AuthError{realm}
 			}
 
+			ctx = context.WithValue(ctx, PrincipalContextKey, string(givenUser))
 			return next(ctx, request)
 		}
 	}
 }
+
+// AuthOption sets an optional parameter for the middleware of
+// NewAuthMiddleware.
+type AuthOption func(*authMiddleware)
+
+// AuthThrottler sets the throttler of failed attempts, e.g. to share it
+// between middlewares. A nil throttler disables throttling. By default, each
+// middleware has its own throttler, locking a user from a client IP, or a
+// client IP, out for a minute after 5 failed attempts within a minute.
+func AuthThrottler(t *Throttler) AuthOption {
+	return func(m *authMiddleware) { m.throttler = t }
+}
+
+// AuthClientIP sets the function returning the IP of the client, which
+// failed attempts are throttled by. By default, it's the
+// host of the remote address populated in the context by
+// httptransport.PopulateRequestContext. Behind a proxy, it may be taken from
+// the X-Forwarded-For header of trusted proxies instead.
+func AuthClientIP(clientIP func(context.Context) string) AuthOption {
+	return func(m *authMiddleware) { m.clientIP = clientIP }
+}
+
+type authMiddleware struct {
+	store     CredentialStore
+	realm     string
+	throttler *Throttler
+	clientIP  func(context.Context) string
+}
+
+// NewAuthMiddleware returns a Basic Authentication middleware for the users
+// of the credential store. The authenticated username is added to the
+// context under PrincipalContextKey. Failed attempts are throttled per user
+// and client IP pair, and per client IP, and attempts of locked out users or
+// client IPs fail with a *ThrottledError, without their credentials being
+// verified. Users are only throttled regardless of their IP if it's unknown.
+func NewAuthMiddleware(store CredentialStore, realm string, options ...AuthOption) endpoint.Middleware {
+	m := &authMiddleware{
+		store:     store,
+		realm:     realm,
+		throttler: NewThrottler(5, time.Minute, time.Minute),
+		clientIP:  remoteIP,
+	}
+	for _, option := range options {
+		option(m)
+	}
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			auth, ok := ctx.Value(httptransport.ContextKeyRequestAuthorization).(string)
+			if !ok {
+				return nil, AuthError{m.realm}
+			}
+
+			givenUser, givenPassword, ok := parseBasicAuth(auth)
+			if !ok {
+				return nil, AuthError{m.realm}
+			}
+			username := string(givenUser)
+
+			// Users are locked out per client IP, so that no one can lock a
+			// user out everywhere with a few wrong passwords.
+			keys := []string{"user:" + username}
+			if ip := m.clientIP(ctx); ip != "" {
+				keys = []string{"user:" + username + "@ip:" + ip, "ip:" + ip}
+			}
+			if m.throttler != nil {
+				if wait := m.throttler.wait(time.Now(), keys...); wait > 0 {
+					return nil, &ThrottledError{RetryAfter: wait}
+				}
+			}
+
+			ok, err := m.store.Verify(ctx, username, string(givenPassword))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				if m.throttler != nil {
+					m.throttler.fail(time.Now(), keys...)
+				}
+				return nil, AuthError{m.realm}
+			}
+			if m.throttler != nil {
+				m.throttler.reset(keys[0])
+			}
+
+			ctx = context.WithValue(ctx, PrincipalContextKey, username)
+			return next(ctx, request)
+		}
+	}
+}
+
+// remoteIP returns the host of the remote address of the request.
+func remoteIP(ctx context.Context) string {
+	addr, _ := ctx.Value(httptransport.ContextKeyRequestRemoteAddr).(string)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
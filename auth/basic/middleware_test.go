@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"testing"
+	"time"
 
 	httptransport "github.com/go-kit/kit/transport/http"
 )
@@ -50,3 +51,78 @@ func makeAuthString(user string, password string) string {
 func passedValidation(ctx context.Context, request interface{}) (response interface{}, err error) {
 	return true, nil
 }
+
+func TestThrottlerMaxEntries(t *testing.T) {
+	var (
+		throttler = NewThrottler(1, time.Minute, time.Minute, ThrottlerMaxEntries(2))
+		now       = time.Now()
+	)
+	throttler.fail(now, "a")
+	throttler.fail(now, "b")
+	throttler.fail(now, "c")
+	if want, have := 2, len(throttler.entries); want != have {
+		t.Errorf("want %d entries, have %d", want, have)
+	}
+	if throttler.wait(now, "a") > 0 {
+		t.Error("want the least recently failing key to be forgotten")
+	}
+	if throttler.wait(now, "c") == 0 {
+		t.Error("want the most recently failing key to be locked out")
+	}
+}
+
+func TestNewAuthMiddleware(t *testing.T) {
+	store := MemoryStore{"alice": "{PLAIN}secret", "bob": "{PLAIN}secret"}
+	throttler := NewThrottler(3, time.Minute, time.Minute)
+	middleware := NewAuthMiddleware(store, "test realm", AuthThrottler(throttler))
+	endpoint := middleware(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		principal, _ := Principal(ctx)
+		return principal, nil
+	})
+	call := func(username, password, remoteAddr string) (interface{}, error) {
+		ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestAuthorization, makeAuthString(username, password))
+		ctx = context.WithValue(ctx, httptransport.ContextKeyRequestRemoteAddr, remoteAddr)
+		return endpoint(ctx, nil)
+	}
+
+	principal, err := call("alice", "secret", "10.0.0.1:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "alice", principal; want != have {
+		t.Errorf("want principal %q, have %v", want, have)
+	}
+	_, err = call("alice", "wrong", "10.0.0.1:1234")
+	if want, have := (AuthError{"test realm"}), err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// Alice is locked out from an IP after 3 failures, even with the right
+	// password, but not from other IPs.
+	call("alice", "wrong", "10.0.0.1:1234")
+	call("alice", "wrong", "10.0.0.1:1234")
+	_, err = call("alice", "secret", "10.0.0.1:1234")
+	throttled, ok := err.(*ThrottledError)
+	if !ok {
+		t.Fatalf("want *ThrottledError, have %v", err)
+	}
+	if want, have := "60", throttled.Headers().Get("Retry-After"); want != have {
+		t.Errorf("want Retry-After %q, have %q", want, have)
+	}
+	if _, err := call("alice", "secret", "10.0.0.4:1234"); err != nil {
+		t.Errorf("want alice to be authenticated from another IP, have %v", err)
+	}
+
+	// So is an IP failing for several users.
+	if _, err := call("bob", "wrong", "10.0.0.5:1234"); err == nil {
+		t.Fatal("want error, have none")
+	}
+	call("carol", "wrong", "10.0.0.5:1234")
+	call("dave", "wrong", "10.0.0.5:1234")
+	if _, err := call("bob", "secret", "10.0.0.5:1234"); err == nil {
+		t.Error("want IP to be locked out")
+	}
+	if _, err := call("bob", "secret", "10.0.0.6:1234"); err != nil {
+		t.Errorf("want bob to be authenticated from another IP, have %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package basic
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// CredentialStore verifies the credentials of users.
+type CredentialStore interface {
+	// Verify reports whether the password is the one of the user. Unknown
+	// users are not an error.
+	Verify(ctx context.Context, username, password string) (bool, error)
+}
+
+// MemoryStore is a CredentialStore of the users in the map, to the hash of
+// their password in one of the htpasswd formats: bcrypt, SHA-1 ({SHA}) or
+// APR1-MD5 ($apr1$). Plain text passwords must be explicitly marked with the
+// {PLAIN} prefix, e.g. "{PLAIN}secret". Users with hashes in other formats
+// can't be verified.
+type MemoryStore map[string]string
+
+// Verify implements CredentialStore. The passwords of unknown users are
+// checked against a dummy hash like the ones of the known users, so that
+// the time taken doesn't tell whether a user exists.
+func (s MemoryStore) Verify(_ context.Context, username, password string) (bool, error) {
+	hash, ok := s[username]
+	if !ok {
+		for _, hash := range s {
+			verifyPassword(dummyHash(hash), password)
+			break
+		}
+		return false, nil
+	}
+	return verifyPassword(hash, password), nil
+}
+
+// FileStore is a CredentialStore of the users of an htpasswd file, which is
+// reloaded when it changes, so that users can be added or removed without
+// restarting.
+type FileStore struct {
+	path          string
+	checkInterval time.Duration
+
+	mtx     sync.Mutex
+	users   MemoryStore
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// FileStoreOption sets an optional parameter for file stores.
+type FileStoreOption func(*FileStore)
+
+// FileStoreCheckInterval sets how often the file is checked for changes, on
+// use of the store. By default, it's 5 seconds.
+func FileStoreCheckInterval(d time.Duration) FileStoreOption {
+	return func(s *FileStore) { s.checkInterval = d }
+}
+
+// NewFileStore returns a store of the users of the htpasswd file at the path,
+// which is loaded right away.
+func NewFileStore(path string, options ...FileStoreOption) (*FileStore, error) {
+	s := &FileStore{path: path, checkInterval: 5 * time.Second}
+	for _, option := range options {
+		option(s)
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Verify implements CredentialStore. The previous users are kept if the file
+// fails to reload.
+func (s *FileStore) Verify(ctx context.Context, username, password string) (bool, error) {
+	s.mtx.Lock()
+	if now := time.Now(); now.Sub(s.checked) >= s.checkInterval {
+		s.checked = now
+		s.reload(false)
+	}
+	users := s.users
+	s.mtx.Unlock()
+	return users.Verify(ctx, username, password)
+}
+
+// Reload loads the file, e.g. on SIGHUP.
+func (s *FileStore) Reload() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.checked = time.Now()
+	return s.reload(true)
+}
+
+// reload loads the file if it changed since it was last loaded, or if force
+// is true.
+func (s *FileStore) reload(force bool) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if !force && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users, err := ParseHtpasswd(f)
+	if err != nil {
+		return err
+	}
+	s.users, s.modTime, s.size = users, info.ModTime(), info.Size()
+	return nil
+}
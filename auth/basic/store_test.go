@@ -0,0 +1,137 @@
+package basic
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswdFormats(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := ParseHtpasswd(strings.NewReader(strings.Join([]string{
+		"# users",
+		"bcrypt:" + string(bcryptHash),
+		"sha:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"apr1:$apr1$qHDFfhPC$nITSVHgYbDAK1Y0acGRnY0",
+		"",
+		"plain:{PLAIN}secret",
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		username, password string
+		want               bool
+	}{
+		{"bcrypt", "secret", true},
+		{"bcrypt", "wrong", false},
+		{"sha", "secret", true},
+		{"sha", "wrong", false},
+		{"apr1", "myPassword", true},
+		{"apr1", "wrong", false},
+		{"plain", "secret", true},
+		{"plain", "wrong", false},
+		{"unknown", "secret", false},
+	} {
+		have, err := store.Verify(context.Background(), tc.username, tc.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tc.want; want != have {
+			t.Errorf("%s:%s: want %v, have %v", tc.username, tc.password, want, have)
+		}
+	}
+
+	if _, err := ParseHtpasswd(strings.NewReader("malformed")); err == nil {
+		t.Error("want error for malformed line, have none")
+	}
+	if _, err := ParseHtpasswd(strings.NewReader("alice:secret")); err == nil {
+		t.Error("want error for unsupported hash format, have none")
+	}
+
+	// Hashes in unknown formats aren't compared as plain text.
+	if ok, _ := (MemoryStore{"alice": "secret"}).Verify(context.Background(), "alice", "secret"); ok {
+		t.Error("want unknown hash format not to be verified")
+	}
+}
+
+func TestDummyHash(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dummy := dummyHash(string(hash))
+	cost, err := bcrypt.Cost([]byte(dummy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := bcrypt.MinCost+1, cost; want != have {
+		t.Errorf("want cost %d, have %d", want, have)
+	}
+	if verifyPassword(dummy, "secret") {
+		t.Error("want the dummy hash not to match the password")
+	}
+	if want, have := dummy, dummyHash(string(hash)); want != have {
+		t.Error("want the dummy hash to be reused")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".htpasswd")
+	if err := ioutil.WriteFile(path, []byte("alice:{PLAIN}secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(path, FileStoreCheckInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(username, password string) bool {
+		ok, err := store.Verify(context.Background(), username, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !verify("alice", "secret") {
+		t.Error("want alice to be verified")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("alice:{PLAIN}changed\nbob:{PLAIN}secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if verify("alice", "secret") || !verify("alice", "changed") || !verify("bob", "secret") {
+		t.Error("want the changed file to be reloaded")
+	}
+
+	// A broken file keeps the previous users.
+	if err := ioutil.WriteFile(path, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !verify("bob", "secret") {
+		t.Error("want the previous users to be kept")
+	}
+
+	if _, err := NewFileStore(filepath.Join(dir, "missing")); err == nil {
+		t.Error("want error for missing file, have none")
+	}
+}
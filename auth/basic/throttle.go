@@ -0,0 +1,160 @@
+package basic
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+// ThrottledError is returned by the middleware of NewAuthMiddleware when a
+// user or client IP is locked out after too many failed attempts.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "too many failed authentication attempts"
+}
+
+// StatusCode is an implementation of the StatusCoder interface in go-kit/http.
+func (e *ThrottledError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// Headers is an implementation of the Headerer interface in go-kit/http.
+func (e *ThrottledError) Headers() http.Header {
+	h := http.Header{}
+	h.Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	return h
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *ThrottledError) ErrorKind() errkind.Kind {
+	return errkind.ResourceExhausted
+}
+
+// Throttler locks users and client IPs out after too many failed
+// authentication attempts, to blunt brute force attacks. A Throttler may be
+// shared by several middlewares. It tracks a bounded number of users and
+// client IPs, forgetting the least recently failing ones first, so that
+// attempts with random usernames can't make it grow without bound.
+type Throttler struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	maxEntries  int
+
+	mtx     sync.Mutex
+	lru     *list.List // of *throttleEntry, most recently failed first
+	entries map[string]*list.Element
+	swept   time.Time
+}
+
+type throttleEntry struct {
+	key         string
+	failures    int
+	since       time.Time
+	lockedUntil time.Time
+}
+
+// ThrottlerOption sets an optional parameter for throttlers.
+type ThrottlerOption func(*Throttler)
+
+// ThrottlerMaxEntries sets the maximum number of users and client IPs
+// tracked. By default, it's 10000.
+func ThrottlerMaxEntries(n int) ThrottlerOption {
+	return func(t *Throttler) { t.maxEntries = n }
+}
+
+// NewThrottler returns a throttler locking a user, or a client IP, out for
+// the lockout duration after maxFailures failed attempts within the window.
+func NewThrottler(maxFailures int, window, lockout time.Duration, options ...ThrottlerOption) *Throttler {
+	t := &Throttler{
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		maxEntries:  10000,
+		lru:         list.New(),
+		entries:     map[string]*list.Element{},
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// wait returns how long until none of the keys is locked out.
+func (t *Throttler) wait(now time.Time, keys ...string) time.Duration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	var wait time.Duration
+	for _, key := range keys {
+		if el, ok := t.entries[key]; ok {
+			if d := el.Value.(*throttleEntry).lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// fail records a failed attempt for the keys.
+func (t *Throttler) fail(now time.Time, keys ...string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.sweep(now)
+	for _, key := range keys {
+		el, ok := t.entries[key]
+		if !ok {
+			el = t.lru.PushFront(&throttleEntry{key: key, since: now})
+			t.entries[key] = el
+		}
+		t.lru.MoveToFront(el)
+		e := el.Value.(*throttleEntry)
+		if now.Sub(e.since) > t.window {
+			e.failures, e.since = 0, now
+		}
+		e.failures++
+		if e.failures >= t.maxFailures {
+			e.lockedUntil = now.Add(t.lockout)
+			e.failures, e.since = 0, now
+		}
+	}
+	for t.maxEntries > 0 && t.lru.Len() > t.maxEntries {
+		t.remove(t.lru.Back())
+	}
+}
+
+// reset forgets the failed attempts of the key.
+func (t *Throttler) reset(key string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if el, ok := t.entries[key]; ok {
+		t.remove(el)
+	}
+}
+
+// remove must be called with the mutex held.
+func (t *Throttler) remove(el *list.Element) {
+	t.lru.Remove(el)
+	delete(t.entries, el.Value.(*throttleEntry).key)
+}
+
+// sweep drops the entries that are neither locked out nor within their
+// window, at most once per window.
+func (t *Throttler) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.window {
+		return
+	}
+	t.swept = now
+	for _, el := range t.entries {
+		if e := el.Value.(*throttleEntry); now.After(e.lockedUntil) && now.Sub(e.since) > t.window {
+			t.remove(el)
+		}
+	}
+}
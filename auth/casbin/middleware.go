@@ -46,6 +46,22 @@ var (
 // with CasbinEnforcer as the key.
 func NewEnforcer(
 	subject string, object interface{}, action string,
+) endpoint.Middleware {
+	return NewContextEnforcer(func(context.Context) (string, bool) {
+		return subject, true
+	}, object, action)
+}
+
+// SubjectFunc returns the subject of a request from its context, e.g. the
+// principal authenticated by a previous middleware, or false if there's
+// none.
+type SubjectFunc func(ctx context.Context) (string, bool)
+
+// NewContextEnforcer is like NewEnforcer, but checks whether the subject
+// returned by the SubjectFunc for each request is authorized. Requests
+// without a subject fail with ErrUnauthorized.
+func NewContextEnforcer(
+	subject SubjectFunc, object interface{}, action string,
 ) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
@@ -57,7 +73,11 @@ func NewEnforcer(
 			}
 
 			ctx = context.WithValue(ctx, CasbinEnforcerContextKey, enforcer)
-			ok, err := enforcer.Enforce(subject, object, action)
+			sub, ok := subject(ctx)
+			if !ok {
+				return nil, ErrUnauthorized
+			}
+			ok, err = enforcer.Enforce(sub, object, action)
 			if err != nil {
 				return nil, err
 			}
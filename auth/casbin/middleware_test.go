@@ -54,3 +54,26 @@ func TestFileBaseContext(t *testing.T) {
 		t.Fatalf("Enforcer returned error: %s", err)
 	}
 }
+
+func TestContextEnforcer(t *testing.T) {
+	e := func(ctx context.Context, i interface{}) (interface{}, error) { return ctx, nil }
+	ctx := context.WithValue(context.Background(), CasbinModelContextKey, "testdata/basic_model.conf")
+	ctx = context.WithValue(ctx, CasbinPolicyContextKey, "testdata/basic_policy.csv")
+
+	type subjectKey struct{}
+	subject := func(ctx context.Context) (string, bool) {
+		sub, ok := ctx.Value(subjectKey{}).(string)
+		return sub, ok
+	}
+	middleware := NewContextEnforcer(subject, "data2", "write")(e)
+
+	if _, err := middleware(context.WithValue(ctx, subjectKey{}, "bob"), struct{}{}); err != nil {
+		t.Fatalf("Enforcer returned error: %s", err)
+	}
+	if _, err := middleware(context.WithValue(ctx, subjectKey{}, "alice"), struct{}{}); err != ErrUnauthorized {
+		t.Fatalf("want %v, have %v", ErrUnauthorized, err)
+	}
+	if _, err := middleware(ctx, struct{}{}); err != ErrUnauthorized {
+		t.Fatalf("want %v, have %v", ErrUnauthorized, err)
+	}
+}
@@ -0,0 +1,328 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+// authError is the type of the errors of tokens that fail authentication,
+// which transports encode as 401 Unauthorized or UNAUTHENTICATED.
+type authError string
+
+func (e authError) Error() string {
+	return string(e)
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e authError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e authError) ErrorKind() errkind.Kind {
+	return errkind.Unauthenticated
+}
+
+// GRPCStatus returns the UNAUTHENTICATED status of the error.
+func (e authError) GRPCStatus() *status.Status {
+	return status.New(codes.Unauthenticated, string(e))
+}
+
+// invalidTokenError is an error of token parsing or verification, e.g. an
+// invalid signature, which transports encode as 401 Unauthorized or
+// UNAUTHENTICATED.
+type invalidTokenError struct {
+	err error
+}
+
+// invalidToken returns err as an authentication error, unless it already
+// has a kind, e.g. the errors of the package.
+func invalidToken(err error) error {
+	if _, ok := err.(errkind.ErrorKinder); ok {
+		return err
+	}
+	return invalidTokenError{err: err}
+}
+
+func (e invalidTokenError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the parsing or verification error.
+func (e invalidTokenError) Unwrap() error {
+	return e.err
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e invalidTokenError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e invalidTokenError) ErrorKind() errkind.Kind {
+	return errkind.Unauthenticated
+}
+
+// GRPCStatus returns the UNAUTHENTICATED status of the error.
+func (e invalidTokenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unauthenticated, e.err.Error())
+}
+
+// ClaimsError is returned by parsers when a claim of a token doesn't satisfy
+// their validation options. Transports encode it as 401 Unauthorized, or
+// UNAUTHENTICATED.
+type ClaimsError struct {
+	Claim  string
+	Reason string
+}
+
+func (e *ClaimsError) Error() string {
+	return fmt.Sprintf("JWT claim %q %s", e.Claim, e.Reason)
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e *ClaimsError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// Headers implements the http transport Headerer, with the challenge of
+// RFC 6750.
+func (e *ClaimsError) Headers() http.Header {
+	h := http.Header{}
+	h.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return h
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *ClaimsError) ErrorKind() errkind.Kind {
+	return errkind.Unauthenticated
+}
+
+// GRPCStatus returns the UNAUTHENTICATED status of the error.
+func (e *ClaimsError) GRPCStatus() *status.Status {
+	return status.New(codes.Unauthenticated, e.Error())
+}
+
+// PermissionError is returned by parsers when a valid token lacks the scopes
+// or roles required by their validation options. Transports encode it as
+// 403 Forbidden, or PERMISSION_DENIED.
+type PermissionError struct {
+	// Claim is "scope" for missing scopes, or "roles" for missing roles.
+	Claim    string
+	Required []string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Claim == "roles" {
+		return "JWT lacks one of the roles " + strings.Join(e.Required, ", ")
+	}
+	return "JWT lacks the scopes " + strings.Join(e.Required, ", ")
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e *PermissionError) StatusCode() int {
+	return http.StatusForbidden
+}
+
+// Headers implements the http transport Headerer, with the challenge of
+// RFC 6750.
+func (e *PermissionError) Headers() http.Header {
+	challenge := `Bearer error="insufficient_scope"`
+	if e.Claim == "scope" {
+		challenge += `, scope="` + strings.Join(e.Required, " ") + `"`
+	}
+	h := http.Header{}
+	h.Set("WWW-Authenticate", challenge)
+	return h
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *PermissionError) ErrorKind() errkind.Kind {
+	return errkind.PermissionDenied
+}
+
+// GRPCStatus returns the PERMISSION_DENIED status of the error.
+func (e *PermissionError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, e.Error())
+}
+
+// ParserOption sets an optional claims validation policy for parsers. The
+// policies apply to the claims of the token payload, whatever the claims type
+// of the parser.
+type ParserOption func(*parser)
+
+// ParserIssuer requires the issuer (iss) of tokens to be one of the issuers.
+func ParserIssuer(issuers ...string) ParserOption {
+	return func(p *parser) { p.issuers = issuers }
+}
+
+// ParserAudience requires the audience (aud) of tokens to contain one of the
+// audiences.
+func ParserAudience(audiences ...string) ParserOption {
+	return func(p *parser) { p.audiences = audiences }
+}
+
+// ParserLeeway sets the clock skew tolerated when checking the expiration
+// (exp), not before (nbf) and issued at (iat) times of tokens. There's no
+// leeway by default.
+func ParserLeeway(leeway time.Duration) ParserOption {
+	return func(p *parser) { p.leeway = leeway }
+}
+
+// ParserRequiredClaims requires tokens to have the claims, e.g. "sub" or
+// "exp", with a non-null value.
+func ParserRequiredClaims(names ...string) ParserOption {
+	return func(p *parser) { p.required = names }
+}
+
+// ParserScopes requires tokens to be granted all the scopes, as per the
+// space-delimited scope claim of RFC 8693, or else the scp claim, which may
+// be an array. Missing scopes fail with a *PermissionError.
+func ParserScopes(scopes ...string) ParserOption {
+	return func(p *parser) { p.scopes = scopes }
+}
+
+// ParserRoles requires tokens to have at least one of the roles, as per the
+// roles claim, which may be an array or a space-delimited string. Missing
+// roles fail with a *PermissionError.
+func ParserRoles(roles ...string) ParserOption {
+	return func(p *parser) { p.roles = roles }
+}
+
+type parser struct {
+	issuers   []string
+	audiences []string
+	leeway    time.Duration
+	required  []string
+	scopes    []string
+	roles     []string
+}
+
+// validates reports whether the parser has claims validation policies.
+func (p *parser) validates() bool {
+	return len(p.issuers) > 0 || len(p.audiences) > 0 || len(p.required) > 0 || len(p.scopes) > 0 || len(p.roles) > 0
+}
+
+// timeErrors are the validation errors of the time claims.
+const timeErrors = jwt.ValidationErrorExpired | jwt.ValidationErrorNotValidYet | jwt.ValidationErrorIssuedAt
+
+// checkTimes checks the time claims with the leeway, for tokens that only
+// failed the checks of their claims type for time claims.
+func (p *parser) checkTimes(payload map[string]interface{}) error {
+	now := time.Now()
+	if exp, ok := numericDate(payload["exp"]); ok && now.After(exp.Add(p.leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := numericDate(payload["nbf"]); ok && now.Add(p.leeway).Before(nbf) {
+		return ErrTokenNotActive
+	}
+	if iat, ok := numericDate(payload["iat"]); ok && now.Add(p.leeway).Before(iat) {
+		return ErrTokenNotActive
+	}
+	return nil
+}
+
+// checkClaims checks the claims of the token payload against the policies.
+func (p *parser) checkClaims(payload map[string]interface{}) error {
+	for _, name := range p.required {
+		if payload[name] == nil {
+			return &ClaimsError{Claim: name, Reason: "is required"}
+		}
+	}
+	if len(p.issuers) > 0 {
+		iss, _ := payload["iss"].(string)
+		if !containsAny([]string{iss}, p.issuers) {
+			return &ClaimsError{Claim: "iss", Reason: "is not an accepted issuer"}
+		}
+	}
+	if len(p.audiences) > 0 && !containsAny(stringList(payload["aud"], false), p.audiences) {
+		return &ClaimsError{Claim: "aud", Reason: "is not an accepted audience"}
+	}
+	if len(p.scopes) > 0 {
+		granted := stringList(payload["scope"], true)
+		if payload["scope"] == nil {
+			granted = stringList(payload["scp"], true)
+		}
+		for _, scope := range p.scopes {
+			if !containsAny(granted, []string{scope}) {
+				return &PermissionError{Claim: "scope", Required: p.scopes}
+			}
+		}
+	}
+	if len(p.roles) > 0 && !containsAny(stringList(payload["roles"], true), p.roles) {
+		return &PermissionError{Claim: "roles", Required: p.roles}
+	}
+	return nil
+}
+
+// decodePayload returns the claims of the token payload.
+func decodePayload(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	b, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	var payload map[string]interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	return payload, nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// stringList returns the claim value as a list of strings, splitting strings
+// on spaces if split is true.
+func stringList(v interface{}, split bool) []string {
+	switch x := v.(type) {
+	case string:
+		if split {
+			return strings.Fields(x)
+		}
+		return []string{x}
+	case []interface{}:
+		list := make([]string, 0, len(x))
+		for _, e := range x {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func containsAny(list, candidates []string) bool {
+	for _, s := range list {
+		for _, c := range candidates {
+			if s == c {
+				return true
+			}
+		}
+	}
+	return false
+}
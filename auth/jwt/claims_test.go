@@ -0,0 +1,102 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/transport/http"
+)
+
+func TestParserOptions(t *testing.T) {
+	now := time.Now().Unix()
+	for _, tc := range []struct {
+		name    string
+		claims  jwt.MapClaims
+		options []ParserOption
+		want    error
+	}{
+		{"issuer", jwt.MapClaims{"iss": "b"}, []ParserOption{ParserIssuer("a", "b")}, nil},
+		{"wrong issuer", jwt.MapClaims{"iss": "c"}, []ParserOption{ParserIssuer("a", "b")}, &ClaimsError{"iss", "is not an accepted issuer"}},
+		{"audience", jwt.MapClaims{"aud": "api"}, []ParserOption{ParserAudience("api")}, nil},
+		{"audiences", jwt.MapClaims{"aud": []string{"web", "api"}}, []ParserOption{ParserAudience("api")}, nil},
+		{"wrong audience", jwt.MapClaims{"aud": []string{"web"}}, []ParserOption{ParserAudience("api")}, &ClaimsError{"aud", "is not an accepted audience"}},
+		{"required", jwt.MapClaims{"sub": "kit"}, []ParserOption{ParserRequiredClaims("sub")}, nil},
+		{"missing", jwt.MapClaims{}, []ParserOption{ParserRequiredClaims("sub")}, &ClaimsError{"sub", "is required"}},
+		{"expired", jwt.MapClaims{"exp": now - 5}, nil, ErrTokenExpired},
+		{"expired within leeway", jwt.MapClaims{"exp": now - 5}, []ParserOption{ParserLeeway(time.Minute)}, nil},
+		{"expired beyond leeway", jwt.MapClaims{"exp": now - 120}, []ParserOption{ParserLeeway(time.Minute)}, ErrTokenExpired},
+		{"not before within leeway", jwt.MapClaims{"nbf": now + 5}, []ParserOption{ParserLeeway(time.Minute)}, nil},
+		{"leeway then issuer", jwt.MapClaims{"exp": now - 5}, []ParserOption{ParserLeeway(time.Minute), ParserIssuer("a")}, &ClaimsError{"iss", "is not an accepted issuer"}},
+		{"scopes", jwt.MapClaims{"scope": "read write"}, []ParserOption{ParserScopes("read", "write")}, nil},
+		{"scp", jwt.MapClaims{"scp": []string{"read", "write"}}, []ParserOption{ParserScopes("write")}, nil},
+		{"missing scope", jwt.MapClaims{"scope": "read"}, []ParserOption{ParserScopes("read", "write")}, &PermissionError{"scope", []string{"read", "write"}}},
+		{"roles", jwt.MapClaims{"roles": []string{"editor"}}, []ParserOption{ParserRoles("admin", "editor")}, nil},
+		{"missing role", jwt.MapClaims{"roles": "viewer"}, []ParserOption{ParserRoles("admin", "editor")}, &PermissionError{"roles", []string{"admin", "editor"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(method, tc.claims).SignedString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parser := NewParser(
+				func(*jwt.Token) (interface{}, error) { return key, nil },
+				method, MapClaimsFactory, tc.options...,
+			)(func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+			_, err = parser(context.WithValue(context.Background(), JWTTokenContextKey, token), nil)
+			if (tc.want == nil) != (err == nil) || (err != nil && tc.want.Error() != err.Error()) {
+				t.Errorf("want %v, have %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestParserErrorEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		wantHTTP int
+		wantGRPC codes.Code
+	}{
+		{ErrTokenExpired, 401, codes.Unauthenticated},
+		{ErrTokenContextMissing, 401, codes.Unauthenticated},
+		{&ClaimsError{Claim: "iss", Reason: "is not an accepted issuer"}, 401, codes.Unauthenticated},
+		{&PermissionError{Claim: "scope", Required: []string{"write"}}, 403, codes.PermissionDenied},
+	} {
+		rec := httptest.NewRecorder()
+		http.DefaultErrorEncoder(context.Background(), tc.err, rec)
+		if want, have := tc.wantHTTP, rec.Code; want != have {
+			t.Errorf("%v: want %d, have %d", tc.err, want, have)
+		}
+		if want, have := tc.wantGRPC, status.Code(tc.err); want != have {
+			t.Errorf("%v: want %v, have %v", tc.err, want, have)
+		}
+	}
+
+	// Signature errors are authentication errors too.
+	parser := NewParser(
+		func(*jwt.Token) (interface{}, error) { return []byte("bad"), nil },
+		method, MapClaimsFactory,
+	)(func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+	_, err := parser(context.WithValue(context.Background(), JWTTokenContextKey, signedKey), nil)
+	if !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Errorf("want %v, have %v", jwt.ErrSignatureInvalid, err)
+	}
+	if want, have := codes.Unauthenticated, status.Code(err); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	rec := httptest.NewRecorder()
+	http.DefaultErrorEncoder(context.Background(), err, rec)
+	if want, have := 401, rec.Code; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := `Bearer error="insufficient_scope", scope="write"`,
+		(&PermissionError{Claim: "scope", Required: []string{"write"}}).Headers().Get("WWW-Authenticate"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,369 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	stdhttp "net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/go-kit/kit/transport/http"
+)
+
+var (
+	// ErrKeyNotFound denotes no key of the key set has the key ID (kid) of a
+	// token.
+	ErrKeyNotFound error = authError("no key found for the token's key ID")
+
+	// ErrUnsupportedKey denotes a JSON Web Key, or a public key, of an
+	// unsupported type or curve.
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// JSONWebKey is a public JSON Web Key, as per RFC 7517, of type RSA, EC (with
+// the P-256, P-384 or P-521 curves) or OKP (with the Ed25519 curve).
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA members.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP members.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is a JSON Web Key Set, as per RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey returns the JSON Web Key of the public key, which must be an
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey, with the key ID
+// and the algorithm of the signing method.
+func NewJSONWebKey(kid string, method jwt.SigningMethod, publicKey crypto.PublicKey) (JSONWebKey, error) {
+	k := JSONWebKey{KeyID: kid, Use: "sig", Algorithm: method.Alg()}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		k.KeyType = "RSA"
+		k.N = encodeBase64(key.N.Bytes())
+		k.E = encodeBase64(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		k.KeyType, k.Curve = "EC", key.Curve.Params().Name
+		k.X = encodeBase64(padBytes(key.X.Bytes(), size))
+		k.Y = encodeBase64(padBytes(key.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		k.KeyType, k.Curve = "OKP", "Ed25519"
+		k.X = encodeBase64(key)
+	default:
+		return JSONWebKey{}, ErrUnsupportedKey
+	}
+	return k, nil
+}
+
+// PublicKey returns the public key of the JSON Web Key, as an
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBase64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		return key, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decodeBase64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// JWKSProvider resolves the keys of tokens from a JSON Web Key Set fetched
+// from a URL, e.g. an OpenID Connect provider's jwks_uri, by their key ID
+// (kid). The key set is cached, and fetched again once the refresh interval
+// has elapsed, or when a token has an unknown key ID, so that keys rotated
+// by the issuer are picked up without restarting. Concurrent requests share
+// a single fetch, and stale keys keep being served while it's in flight. Its
+// Keyfunc is meant to be passed to NewParser.
+type JWKSProvider struct {
+	url                string
+	client             http.HTTPClient
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	timeout            time.Duration
+
+	mtx       sync.Mutex
+	keys      map[string]jwksKey
+	fetched   time.Time // of the current keys
+	refreshed time.Time // of the last fetch, successful or not
+	err       error     // of the last fetch
+	inflight  *jwksFetch
+}
+
+type jwksKey struct {
+	algorithm string
+	publicKey crypto.PublicKey
+}
+
+// jwksFetch is a fetch of the key set, shared by the requests waiting for it.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// JWKSOption sets an optional parameter for JWKS providers.
+type JWKSOption func(*JWKSProvider)
+
+// JWKSClient sets the HTTP client used to fetch the key set. By default,
+// http.DefaultClient is used.
+func JWKSClient(client http.HTTPClient) JWKSOption {
+	return func(p *JWKSProvider) { p.client = client }
+}
+
+// JWKSRefreshInterval sets how long the key set is cached before it's
+// fetched again. By default, it's an hour.
+func JWKSRefreshInterval(d time.Duration) JWKSOption {
+	return func(p *JWKSProvider) { p.refreshInterval = d }
+}
+
+// JWKSMinRefreshInterval sets the minimum time between two fetches of the
+// key set, so that tokens with unknown key IDs, or an unreachable URL, can't
+// make the provider hammer the URL. By default, it's a minute.
+func JWKSMinRefreshInterval(d time.Duration) JWKSOption {
+	return func(p *JWKSProvider) { p.minRefreshInterval = d }
+}
+
+// JWKSTimeout sets the time limit of a fetch of the key set. By default, it's
+// 10 seconds.
+func JWKSTimeout(d time.Duration) JWKSOption {
+	return func(p *JWKSProvider) { p.timeout = d }
+}
+
+// NewJWKSProvider returns a provider of the keys of the JSON Web Key Set at
+// the URL. The key set is fetched on first use.
+func NewJWKSProvider(url string, options ...JWKSOption) *JWKSProvider {
+	p := &JWKSProvider{
+		url:                url,
+		client:             stdhttp.DefaultClient,
+		refreshInterval:    time.Hour,
+		minRefreshInterval: time.Minute,
+		timeout:            10 * time.Second,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Keyfunc implements jwt.Keyfunc. It returns the key of the token's key ID,
+// or the only key of the set if the token has no key ID. It returns
+// ErrKeyNotFound if there's no such key, and ErrUnexpectedSigningMethod if
+// the key is for another algorithm than the token's.
+func (p *JWKSProvider) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.key(context.Background(), kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.algorithm != "" && token.Method != nil && key.algorithm != token.Method.Alg() {
+		return nil, ErrUnexpectedSigningMethod
+	}
+	return key.publicKey, nil
+}
+
+func (p *JWKSProvider) key(ctx context.Context, kid string) (jwksKey, error) {
+	p.mtx.Lock()
+	now := time.Now()
+	key, ok := p.lookup(kid)
+	canRefresh := p.inflight != nil || now.Sub(p.refreshed) >= p.minRefreshInterval
+	if ok {
+		if now.Sub(p.fetched) >= p.refreshInterval && canRefresh {
+			p.fetch(now) // in the background
+		}
+		p.mtx.Unlock()
+		return key, nil
+	}
+	if !canRefresh {
+		err := ErrKeyNotFound
+		if p.keys == nil && p.err != nil {
+			err = p.err // the key set couldn't be fetched yet
+		}
+		p.mtx.Unlock()
+		return jwksKey{}, err
+	}
+	f := p.fetch(now)
+	p.mtx.Unlock()
+
+	err := f.wait(ctx)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if err != nil {
+		return jwksKey{}, err
+	}
+	return jwksKey{}, ErrKeyNotFound
+}
+
+func (p *JWKSProvider) lookup(kid string) (jwksKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// Refresh fetches the key set, e.g. to warm the cache up before serving.
+func (p *JWKSProvider) Refresh(ctx context.Context) error {
+	p.mtx.Lock()
+	f := p.fetch(time.Now())
+	p.mtx.Unlock()
+	return f.wait(ctx)
+}
+
+// fetch returns the fetch of the key set in flight, or starts one. It must be
+// called with the mutex held. The fetch isn't bound to the context of any of
+// the requests waiting for it, but to the provider's timeout.
+func (p *JWKSProvider) fetch(now time.Time) *jwksFetch {
+	if p.inflight != nil {
+		return p.inflight
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	p.inflight, p.refreshed = f, now
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+		keys, err := p.refresh(ctx)
+
+		p.mtx.Lock()
+		if err == nil {
+			p.keys, p.fetched = keys, now
+		}
+		p.err, p.inflight, f.err = err, nil, err
+		p.mtx.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+func (f *jwksFetch) wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh fetches the key set. Keys of unsupported types, or meant for
+// encryption, are skipped.
+func (p *JWKSProvider) refresh(ctx context.Context) (map[string]jwksKey, error) {
+	req, err := stdhttp.NewRequest("GET", p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != stdhttp.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS from %s: unexpected status %s", p.url, resp.Status)
+	}
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("fetching JWKS from %s: %v", p.url, err)
+	}
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = jwksKey{algorithm: k.Algorithm, publicKey: publicKey}
+	}
+	return keys, nil
+}
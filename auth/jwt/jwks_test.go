@@ -0,0 +1,287 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func newTestSigningKey(t *testing.T, kid string, method jwt.SigningMethod) SigningKey {
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch method {
+	case jwt.SigningMethodRS256, jwt.SigningMethodPS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case SigningMethodEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SigningKey{ID: kid, Method: method, Key: key}
+}
+
+// signAndParse signs a token with the signer, and parses it with the
+// keyFunc.
+func signAndParse(signer func(jwt.Claims) (string, error), keyFunc jwt.Keyfunc, method jwt.SigningMethod) error {
+	token, err := signer(mapClaims)
+	if err != nil {
+		return err
+	}
+	parser := NewParser(keyFunc, method, MapClaimsFactory)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return ctx.Value(JWTClaimsContextKey), nil
+	})
+	_, err = parser(context.WithValue(context.Background(), JWTTokenContextKey, token), nil)
+	return err
+}
+
+func ringSigner(ring *KeyRing) func(jwt.Claims) (string, error) {
+	return func(claims jwt.Claims) (string, error) {
+		ctx, err := ring.NewSigner(claims)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return ctx, nil
+		})(context.Background(), nil)
+		if err != nil {
+			return "", err
+		}
+		return ctx.(context.Context).Value(JWTTokenContextKey).(string), nil
+	}
+}
+
+func TestJWKSProvider(t *testing.T) {
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodRS256, jwt.SigningMethodES256, SigningMethodEdDSA} {
+		t.Run(method.Alg(), func(t *testing.T) {
+			ring, err := NewKeyRing(newTestSigningKey(t, "k1", method))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fetches int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&fetches, 1)
+				ring.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			provider := NewJWKSProvider(server.URL, JWKSMinRefreshInterval(0))
+
+			if err := signAndParse(ringSigner(ring), provider.Keyfunc, method); err != nil {
+				t.Fatalf("want no error, have %v", err)
+			}
+			if err := signAndParse(ringSigner(ring), provider.Keyfunc, method); err != nil {
+				t.Fatalf("want no error, have %v", err)
+			}
+			if want, have := int64(1), atomic.LoadInt64(&fetches); want != have {
+				t.Errorf("want %d fetches, have %d", want, have)
+			}
+
+			// An unknown key ID makes the provider fetch the rotated keys.
+			if err := ring.Rotate(newTestSigningKey(t, "k2", method)); err != nil {
+				t.Fatal(err)
+			}
+			if err := signAndParse(ringSigner(ring), provider.Keyfunc, method); err != nil {
+				t.Fatalf("want no error, have %v", err)
+			}
+			if want, have := int64(2), atomic.LoadInt64(&fetches); want != have {
+				t.Errorf("want %d fetches, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestJWKSProviderMinRefreshInterval(t *testing.T) {
+	ring, err := NewKeyRing(newTestSigningKey(t, "k1", SigningMethodEdDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(ring)
+	defer server.Close()
+	provider := NewJWKSProvider(server.URL)
+	if err := provider.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ring.Rotate(newTestSigningKey(t, "k2", SigningMethodEdDSA)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := ErrKeyNotFound, signAndParse(ringSigner(ring), provider.Keyfunc, SigningMethodEdDSA); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// Keys for another algorithm are rejected.
+	hmacSigner := func(claims jwt.Claims) (string, error) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "k1"
+		return token.SignedString(key)
+	}
+	if want, have := ErrUnexpectedSigningMethod, signAndParse(hmacSigner, provider.Keyfunc, jwt.SigningMethodHS256); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestJWKSProviderUnavailable(t *testing.T) {
+	var fetches int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	provider := NewJWKSProvider(server.URL)
+	ring, err := NewKeyRing(newTestSigningKey(t, "k1", SigningMethodEdDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed fetches are throttled too, even before any key set is fetched.
+	for i := 0; i < 3; i++ {
+		if err := signAndParse(ringSigner(ring), provider.Keyfunc, SigningMethodEdDSA); err == nil {
+			t.Fatal("want error, have none")
+		}
+	}
+	if want, have := int64(1), atomic.LoadInt64(&fetches); want != have {
+		t.Errorf("want %d fetches, have %d", want, have)
+	}
+}
+
+func TestJWKSProviderConcurrentFetches(t *testing.T) {
+	ring, err := NewKeyRing(newTestSigningKey(t, "k1", SigningMethodEdDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		ring.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	provider := NewJWKSProvider(server.URL, JWKSMinRefreshInterval(0))
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- signAndParse(ringSigner(ring), provider.Keyfunc, SigningMethodEdDSA) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("want no error, have %v", err)
+		}
+	}
+	if want, have := int64(1), atomic.LoadInt64(&fetches); want != have {
+		t.Errorf("want %d fetches, have %d", want, have)
+	}
+}
+
+func TestJWKSProviderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	provider := NewJWKSProvider(server.URL, JWKSTimeout(50*time.Millisecond))
+	ring, err := NewKeyRing(newTestSigningKey(t, "k1", SigningMethodEdDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- signAndParse(ringSigner(ring), provider.Keyfunc, SigningMethodEdDSA) }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("want error, have none")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the fetch to time out")
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	ring, err := NewKeyRing(newTestSigningKey(t, "k1", jwt.SigningMethodES256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedWithK1, err := ringSigner(ring)(mapClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Rotate(newTestSigningKey(t, "k2", SigningMethodEdDSA)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "k2", ring.Active().ID; want != have {
+		t.Errorf("want active key %q, have %q", want, have)
+	}
+	if want, have := 2, len(ring.JWKS().Keys); want != have {
+		t.Errorf("want %d published keys, have %d", want, have)
+	}
+	if err := signAndParse(ringSigner(ring), ring.Keyfunc, SigningMethodEdDSA); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+	parse := func(token string) error {
+		return signAndParse(func(jwt.Claims) (string, error) { return token, nil }, ring.Keyfunc, jwt.SigningMethodES256)
+	}
+	if err := parse(signedWithK1); err != nil {
+		t.Errorf("want tokens of previous keys to verify, have %v", err)
+	}
+
+	if want, have := ErrActiveKeyRetired, ring.Retire("k2"); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if err := ring.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := ErrKeyNotFound, parse(signedWithK1); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 1, len(ring.JWKS().Keys); want != have {
+		t.Errorf("want %d published keys, have %d", want, have)
+	}
+}
+
+// opaqueSigner hides the type of its key, like a crypto.Signer of a KMS.
+type opaqueSigner struct {
+	key crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestKeyRingSigner(t *testing.T) {
+	for _, method := range []jwt.SigningMethod{
+		jwt.SigningMethodRS256,
+		jwt.SigningMethodPS256,
+		jwt.SigningMethodES256,
+		SigningMethodEdDSA,
+	} {
+		key := newTestSigningKey(t, "k1", method)
+		key.Key = opaqueSigner{key.Key}
+		ring, err := NewKeyRing(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := signAndParse(ringSigner(ring), ring.Keyfunc, method); err != nil {
+			t.Errorf("%s: want no error, have %v", method.Alg(), err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	stdhttp "net/http"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ErrActiveKeyRetired denotes an attempt to retire the active signing key of
+// a KeyRing.
+var ErrActiveKeyRetired = errors.New("the active signing key can't be retired")
+
+// SigningKey is an asymmetric signing key of a KeyRing: an *rsa.PrivateKey,
+// *ecdsa.PrivateKey or ed25519.PrivateKey, or any crypto.Signer of their
+// public keys, e.g. backed by a KMS or an HSM, with its key ID and signing
+// method, e.g. SigningMethodRS256, SigningMethodPS256, SigningMethodES256 or
+// SigningMethodEdDSA.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// KeyRing holds the signing keys of an issuer of tokens. Tokens are signed
+// with the active key, which is replaced by Rotate. Previous keys remain in
+// the ring, so that the tokens they signed can still be verified, until
+// they're retired. The public keys of the ring are published as a JSON Web
+// Key Set by its ServeHTTP method, e.g. for a JWKSProvider.
+type KeyRing struct {
+	mtx  sync.RWMutex
+	keys []SigningKey // the active key last
+	jwks []JSONWebKey
+}
+
+// NewKeyRing returns a key ring whose active key is the signing key.
+func NewKeyRing(active SigningKey) (*KeyRing, error) {
+	r := &KeyRing{}
+	if err := r.Rotate(active); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rotate makes the signing key the active key of the ring, keeping the
+// previous keys for verification. A key with the same ID is replaced.
+func (r *KeyRing) Rotate(next SigningKey) error {
+	jwk, err := NewJSONWebKey(next.ID, next.Method, next.Key.Public())
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.remove(next.ID)
+	r.keys = append(r.keys, next)
+	r.jwks = append(r.jwks, jwk)
+	return nil
+}
+
+// Retire removes the key of the ID from the ring, so that tokens it signed
+// can't be verified anymore. It returns ErrActiveKeyRetired if it's the
+// active key.
+func (r *KeyRing) Retire(kid string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.keys[len(r.keys)-1].ID == kid {
+		return ErrActiveKeyRetired
+	}
+	r.remove(kid)
+	return nil
+}
+
+func (r *KeyRing) remove(kid string) {
+	for i := range r.keys {
+		if r.keys[i].ID == kid {
+			r.keys = append(r.keys[:i:i], r.keys[i+1:]...)
+			r.jwks = append(r.jwks[:i:i], r.jwks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Active returns the active signing key.
+func (r *KeyRing) Active() SigningKey {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.keys[len(r.keys)-1]
+}
+
+// NewSigner creates a new JWT token generating middleware, like NewSigner,
+// signing the tokens with the key that's active at the time of the request.
+func (r *KeyRing) NewSigner(claims jwt.Claims) endpoint.Middleware {
+	return newSigner(func() (string, interface{}, jwt.SigningMethod) {
+		k := r.Active()
+		return k.ID, k.Key, signingMethodOf(k)
+	}, claims)
+}
+
+// Keyfunc implements jwt.Keyfunc with the public keys of the ring, so that
+// the issuer can verify its own tokens with NewParser. It returns
+// ErrKeyNotFound if the token's key ID isn't in the ring, and
+// ErrUnexpectedSigningMethod if the token isn't signed with the key's
+// method.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	for _, k := range r.keys {
+		if k.ID != kid {
+			continue
+		}
+		if token.Method == nil || token.Method.Alg() != k.Method.Alg() {
+			return nil, ErrUnexpectedSigningMethod
+		}
+		return k.Key.Public(), nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// JWKS returns the JSON Web Key Set of the public keys of the ring.
+func (r *KeyRing) JWKS() JSONWebKeySet {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return JSONWebKeySet{Keys: append([]JSONWebKey{}, r.jwks...)}
+}
+
+// ServeHTTP implements http.Handler, serving the JSON Web Key Set of the
+// ring.
+func (r *KeyRing) ServeHTTP(w stdhttp.ResponseWriter, _ *stdhttp.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.JWKS())
+}
+
+// signingMethodOf returns the method signing with the key: its own method,
+// unless it's an RSA or ECDSA method and the key isn't an *rsa.PrivateKey or
+// an *ecdsa.PrivateKey, which are the only keys jwt-go's methods accept.
+func signingMethodOf(k SigningKey) jwt.SigningMethod {
+	switch k.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := k.Key.(*rsa.PrivateKey); ok {
+			return k.Method
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := k.Key.(*ecdsa.PrivateKey); ok {
+			return k.Method
+		}
+	default:
+		return k.Method
+	}
+	return signerMethod{k.Method}
+}
+
+// signerMethod signs with any crypto.Signer of the keys of its RSA or ECDSA
+// method, and verifies like it.
+type signerMethod struct {
+	jwt.SigningMethod
+}
+
+func (m signerMethod) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	var (
+		hash crypto.Hash
+		opts crypto.SignerOpts
+		size int // of the integers of ECDSA signatures
+	)
+	switch method := m.SigningMethod.(type) {
+	case *jwt.SigningMethodRSA:
+		hash, opts = method.Hash, method.Hash
+	case *jwt.SigningMethodRSAPSS:
+		hash = method.Hash
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	case *jwt.SigningMethodECDSA:
+		hash, opts, size = method.Hash, method.Hash, method.KeySize
+	default:
+		return m.SigningMethod.Sign(signingString, key)
+	}
+	if !hash.Available() {
+		return "", jwt.ErrHashUnavailable
+	}
+	h := hash.New()
+	h.Write([]byte(signingString))
+	sig, err := signer.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return "", err
+	}
+	if size > 0 {
+		// crypto.Signer returns ASN.1 ECDSA signatures, and JWS wants the
+		// concatenated integers, as per RFC 7518 section 3.4.
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return "", err
+		}
+		sig = make([]byte, 2*size)
+		r, s := rs.R.Bytes(), rs.S.Bytes()
+		copy(sig[size-len(r):size], r)
+		copy(sig[2*size-len(s):], s)
+	}
+	return jwt.EncodeSegment(sig), nil
+}
@@ -2,7 +2,6 @@ package jwt
 
 import (
 	"context"
-	"errors"
 
 	jwt "github.com/dgrijalva/jwt-go"
 
@@ -21,27 +20,29 @@ const (
 	JWTClaimsContextKey contextKey = "JWTClaims"
 )
 
+// The errors of tokens failing authentication, which transports encode as
+// 401 Unauthorized, or UNAUTHENTICATED.
 var (
 	// ErrTokenContextMissing denotes a token was not passed into the parsing
 	// middleware's context.
-	ErrTokenContextMissing = errors.New("token up for parsing was not passed through the context")
+	ErrTokenContextMissing error = authError("token up for parsing was not passed through the context")
 
 	// ErrTokenInvalid denotes a token was not able to be validated.
-	ErrTokenInvalid = errors.New("JWT Token was invalid")
+	ErrTokenInvalid error = authError("JWT Token was invalid")
 
 	// ErrTokenExpired denotes a token's expire header (exp) has since passed.
-	ErrTokenExpired = errors.New("JWT Token is expired")
+	ErrTokenExpired error = authError("JWT Token is expired")
 
 	// ErrTokenMalformed denotes a token was not formatted as a JWT token.
-	ErrTokenMalformed = errors.New("JWT Token is malformed")
+	ErrTokenMalformed error = authError("JWT Token is malformed")
 
 	// ErrTokenNotActive denotes a token's not before header (nbf) is in the
 	// future.
-	ErrTokenNotActive = errors.New("token is not valid yet")
+	ErrTokenNotActive error = authError("token is not valid yet")
 
 	// ErrUnexpectedSigningMethod denotes a token was signed with an unexpected
 	// signing method.
-	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrUnexpectedSigningMethod error = authError("unexpected signing method")
 )
 
 // NewSigner creates a new JWT token generating middleware, specifying key ID,
@@ -49,8 +50,17 @@ var (
 // Tokens are signed with a Key ID header (kid) which is useful for determining
 // the key to use for parsing. Particularly useful for clients.
 func NewSigner(kid string, key []byte, method jwt.SigningMethod, claims jwt.Claims) endpoint.Middleware {
+	return newSigner(func() (string, interface{}, jwt.SigningMethod) {
+		return kid, key, method
+	}, claims)
+}
+
+// newSigner creates a JWT token generating middleware, signing with the
+// key ID, key and signing method returned by signingKey for each request.
+func newSigner(signingKey func() (string, interface{}, jwt.SigningMethod), claims jwt.Claims) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			kid, key, method := signingKey()
 			token := jwt.NewWithClaims(method, claims)
 			token.Header["kid"] = kid
 
@@ -85,8 +95,14 @@ func StandardClaimsFactory() jwt.Claims {
 // NewParser creates a new JWT token parsing middleware, specifying a
 // jwt.Keyfunc interface, the signing method and the claims type to be used. NewParser
 // adds the resulting claims to endpoint context or returns error on invalid token.
+// Options add claims validation policies, e.g. the accepted issuers, or the
+// scopes required by the endpoint.
 // Particularly useful for servers.
-func NewParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFactory) endpoint.Middleware {
+func NewParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFactory, options ...ParserOption) endpoint.Middleware {
+	p := &parser{}
+	for _, option := range options {
+		option(p)
+	}
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 			// tokenString is stored in the context from the transport handlers.
@@ -109,6 +125,19 @@ func NewParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFa
 
 				return keyFunc(token)
 			})
+			var payload map[string]interface{}
+			if e, ok := err.(*jwt.ValidationError); ok && p.leeway > 0 && e.Errors != 0 && e.Errors&^timeErrors == 0 {
+				// The token only failed the time checks of its claims
+				// type: check them again with the leeway.
+				if payload, err = decodePayload(tokenString); err == nil {
+					if err = p.checkTimes(payload); err == nil {
+						token.Valid = true
+					}
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
 			if err != nil {
 				if e, ok := err.(*jwt.ValidationError); ok {
 					switch {
@@ -123,18 +152,29 @@ func NewParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFa
 						return nil, ErrTokenNotActive
 					case e.Inner != nil:
 						// report e.Inner
-						return nil, e.Inner
+						return nil, invalidToken(e.Inner)
 					}
 					// We have a ValidationError but have no specific Go kit error for it.
 					// Fall through to return original error.
 				}
-				return nil, err
+				return nil, invalidToken(err)
 			}
 
 			if !token.Valid {
 				return nil, ErrTokenInvalid
 			}
 
+			if p.validates() {
+				if payload == nil {
+					if payload, err = decodePayload(tokenString); err != nil {
+						return nil, err
+					}
+				}
+				if err := p.checkClaims(payload); err != nil {
+					return nil, err
+				}
+			}
+
 			ctx = context.WithValue(ctx, JWTClaimsContextKey, token.Claims)
 
 			return next(ctx, request)
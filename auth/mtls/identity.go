@@ -0,0 +1,124 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+)
+
+type contextKey string
+
+// IdentityContextKey holds the key used to store the *Identity of the peer
+// in the context.
+const IdentityContextKey contextKey = "MTLSIdentity"
+
+// Identity is the identity of a peer, as per its verified client
+// certificate.
+type Identity struct {
+	// Subject is the distinguished name of the certificate subject, e.g.
+	// "CN=billing,O=Example".
+	Subject    string
+	CommonName string
+
+	// The subject alternative names of the certificate.
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// SPIFFEID is the first URI SAN with the spiffe scheme, as per the X.509
+	// SVID specification, e.g. "spiffe://example.org/billing", if any.
+	SPIFFEID string
+
+	Certificate *x509.Certificate
+}
+
+// NewIdentity returns the identity of the certificate.
+func NewIdentity(cert *x509.Certificate) *Identity {
+	id := &Identity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			id.SPIFFEID = u.String()
+			break
+		}
+	}
+	return id
+}
+
+// Name returns the main name of the identity: its SPIFFE ID if any, or else
+// the first of its other names, prefixed with their kind as per Names, e.g.
+// "dns:billing.internal", or "cn:billing" if it has no subject alternative
+// names.
+func (id *Identity) Name() string {
+	if id.SPIFFEID != "" {
+		return id.SPIFFEID
+	}
+	if names := id.Names(); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// Names returns all the names of the identity, prefixed with their kind, so
+// that a name of one kind can't be mistaken for one of another: its SPIFFE
+// ID as is, e.g. "spiffe://example.org/billing", its other URI, DNS and email
+// subject alternative names, e.g. "uri:https://example.org",
+// "dns:billing.internal" and "email:billing@example.org", and its common
+// name, e.g. "cn:billing". As per RFC 6125, the common name is only included
+// if the certificate has none of these subject alternative names.
+func (id *Identity) Names() []string {
+	names := make([]string, 0, len(id.URIs)+len(id.DNSNames)+len(id.EmailAddresses)+1)
+	for _, u := range id.URIs {
+		if u.Scheme == "spiffe" {
+			names = append(names, u.String())
+		} else {
+			names = append(names, "uri:"+u.String())
+		}
+	}
+	for _, name := range id.DNSNames {
+		names = append(names, "dns:"+name)
+	}
+	for _, address := range id.EmailAddresses {
+		names = append(names, "email:"+address)
+	}
+	if len(names) == 0 && id.CommonName != "" {
+		names = append(names, "cn:"+id.CommonName)
+	}
+	return names
+}
+
+// FromContext returns the identity of the peer in the context, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(IdentityContextKey).(*Identity)
+	return id, ok
+}
+
+// Subject returns the name of the identity of the peer in the context, if
+// any. It may be used as the subject of casbin.NewContextEnforcer.
+func Subject(ctx context.Context) (string, bool) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return id.Name(), true
+}
+
+// stateToContext adds the identity of the verified peer certificate of the
+// connection state to the context. Certificates that weren't verified, e.g.
+// with tls.RequestClientCert, are ignored.
+func stateToContext(ctx context.Context, state *tls.ConnectionState) context.Context {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, IdentityContextKey, NewIdentity(state.VerifiedChains[0][0]))
+}
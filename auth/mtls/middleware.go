@@ -0,0 +1,94 @@
+package mtls
+
+import (
+	"context"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/auth/casbin"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+)
+
+var (
+	// ErrIdentityMissing denotes the peer has no verified client certificate.
+	// Transports encode it as 401 Unauthorized, or UNAUTHENTICATED.
+	ErrIdentityMissing error = authError{"no verified client certificate", errkind.Unauthenticated}
+
+	// ErrNotAllowed denotes the peer identity is not authorized. Transports
+	// encode it as 403 Forbidden, or PERMISSION_DENIED.
+	ErrNotAllowed error = authError{"client certificate identity is not authorized", errkind.PermissionDenied}
+)
+
+type authError struct {
+	msg  string
+	kind errkind.Kind
+}
+
+func (e authError) Error() string {
+	return e.msg
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e authError) StatusCode() int {
+	return e.kind.HTTPStatus()
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e authError) ErrorKind() errkind.Kind {
+	return e.kind
+}
+
+// GRPCStatus returns the status of the error.
+func (e authError) GRPCStatus() *status.Status {
+	return status.New(e.kind.GRPCCode(), e.msg)
+}
+
+// NewAllowlist returns a middleware authorizing the peers with any of the
+// names, prefixed with their kind as per Identity.Names, e.g.
+// "spiffe://example.org/billing" or "dns:billing.internal". It fails with
+// ErrIdentityMissing if there's no identity in the context, e.g. put there by
+// HTTPToContext or GRPCToContext, and ErrNotAllowed if the identity has none
+// of the names.
+func NewAllowlist(names ...string) endpoint.Middleware {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			id, ok := FromContext(ctx)
+			if !ok {
+				return nil, ErrIdentityMissing
+			}
+			for _, name := range id.Names() {
+				if allowed[name] {
+					return next(ctx, request)
+				}
+			}
+			return nil, ErrNotAllowed
+		}
+	}
+}
+
+// NewEnforcer returns a middleware authorizing peers with the casbin model
+// and policy in the context, as per casbin.NewEnforcer, with the name of
+// their identity, as per Identity.Name, as the subject. It fails with
+// ErrIdentityMissing if there's no identity in the context, and
+// ErrNotAllowed if the policy denies the action on the object.
+func NewEnforcer(object interface{}, action string) endpoint.Middleware {
+	enforcer := casbin.NewContextEnforcer(Subject, object, action)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		enforced := enforcer(next)
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if _, ok := FromContext(ctx); !ok {
+				return nil, ErrIdentityMissing
+			}
+			response, err = enforced(ctx, request)
+			if err == casbin.ErrUnauthorized {
+				return nil, ErrNotAllowed
+			}
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/auth/casbin"
+	"github.com/go-kit/kit/endpoint"
+)
+
+func TestAuthorization(t *testing.T) {
+	ca := newCA(t)
+	billing := NewIdentity(newClientCertificate(t, ca, "billing", "spiffe://example.org/billing").Leaf)
+	reporting := NewIdentity(newClientCertificate(t, ca, "reporting").Leaf)
+	shipping := NewIdentity(newClientCertificate(t, ca, "shipping", "spiffe://example.org/shipping").Leaf)
+	// Names of one kind don't match names of another, and common names don't
+	// match when there are subject alternative names.
+	spoofing := NewIdentity(newClientCertificate(t, ca, "dns:reporting.internal", "spiffe://example.org/spoofing").Leaf)
+	legacy := NewIdentity(newCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "legacy"}}, &ca).Leaf)
+	// Common names don't pass for names of another kind.
+	cnSpoofing := NewIdentity(newCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "spiffe://example.org/billing"}}, &ca).Leaf)
+
+	ctx := context.WithValue(context.Background(), casbin.CasbinModelContextKey, "testdata/model.conf")
+	ctx = context.WithValue(ctx, casbin.CasbinPolicyContextKey, "testdata/policy.csv")
+	nop := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+
+	for _, tc := range []struct {
+		name       string
+		middleware endpoint.Middleware
+	}{
+		{"allowlist", NewAllowlist("spiffe://example.org/billing", "dns:reporting.internal", "cn:legacy", "cn:shipping")},
+		{"casbin", NewEnforcer("orders", "read")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, c := range []struct {
+				id   *Identity
+				want error
+			}{
+				{billing, nil},
+				{reporting, nil},
+				{shipping, ErrNotAllowed},
+				{spoofing, ErrNotAllowed},
+				{legacy, nil},
+				{cnSpoofing, ErrNotAllowed},
+				{nil, ErrIdentityMissing},
+			} {
+				ctx := ctx
+				if c.id != nil {
+					ctx = context.WithValue(ctx, IdentityContextKey, c.id)
+				}
+				if _, err := tc.middleware(nop)(ctx, nil); !errors.Is(err, c.want) {
+					t.Errorf("%v: want %v, have %v", c.id, c.want, err)
+				}
+			}
+		})
+	}
+
+	if want, have := codes.PermissionDenied, status.Code(ErrNotAllowed); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := codes.Unauthenticated, status.Code(ErrIdentityMissing); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
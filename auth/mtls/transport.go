@@ -0,0 +1,38 @@
+package mtls
+
+import (
+	"context"
+	stdhttp "net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/kit/transport/http"
+)
+
+// HTTPToContext moves the identity of the verified client certificate of the
+// request's TLS connection to context. Particularly useful for servers.
+func HTTPToContext() http.RequestFunc {
+	return func(ctx context.Context, r *stdhttp.Request) context.Context {
+		return stateToContext(ctx, r.TLS)
+	}
+}
+
+// GRPCToContext moves the identity of the verified client certificate of the
+// gRPC peer to context. The server must use TLS transport credentials.
+// Particularly useful for servers.
+func GRPCToContext() grpc.ServerRequestFunc {
+	return func(ctx context.Context, _ metadata.MD) context.Context {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return ctx
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return ctx
+		}
+		return stateToContext(ctx, &info.State)
+	}
+}
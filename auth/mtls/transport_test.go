@@ -0,0 +1,153 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// newCertificate returns a certificate signed by the parent, or self-signed
+// if parent is nil.
+func newCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func newCA(t *testing.T) tls.Certificate {
+	return newCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newClientCertificate(t *testing.T, ca tls.Certificate, commonName string, uris ...string) tls.Certificate {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		DNSNames:    []string{commonName + ".internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, u)
+	}
+	return newCertificate(t, template, &ca)
+}
+
+func TestHTTPToContext(t *testing.T) {
+	ca := newCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := httptest.NewUnstartedServer(httptransport.NewServer(
+		NewAllowlist("spiffe://example.org/billing")(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			id, _ := FromContext(ctx)
+			return map[string]string{"subject": id.Subject, "spiffe_id": id.SPIFFEID}, nil
+		}),
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(HTTPToContext()),
+	))
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(certs ...tls.Certificate) (int, string) {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		defer transport.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get(newClientCertificate(t, ca, "billing", "spiffe://example.org/billing"))
+	if want, have := http.StatusOK, status; want != have {
+		t.Fatalf("want %d, have %d: %s", want, have, body)
+	}
+	if want, have := `{"spiffe_id":"spiffe://example.org/billing","subject":"CN=billing,O=Example"}`+"\n", body; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	status, _ = get(newClientCertificate(t, ca, "reporting"))
+	if want, have := http.StatusForbidden, status; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	status, _ = get()
+	if want, have := http.StatusUnauthorized, status; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+func TestGRPCToContext(t *testing.T) {
+	ca := newCA(t)
+	cert := newClientCertificate(t, ca, "billing", "https://example.org", "spiffe://example.org/billing")
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert.Leaf},
+			VerifiedChains:   [][]*x509.Certificate{{cert.Leaf, ca.Leaf}},
+		},
+	}})
+	id, ok := FromContext(GRPCToContext()(ctx, nil))
+	if !ok {
+		t.Fatal("want identity in context")
+	}
+	if want, have := "spiffe://example.org/billing", id.Name(); want != have {
+		t.Errorf("want name %q, have %q", want, have)
+	}
+	if want, have := fmt.Sprint([]string{"uri:https://example.org", "spiffe://example.org/billing", "dns:billing.internal"}), fmt.Sprint(id.Names()); want != have {
+		t.Errorf("want names %s, have %s", want, have)
+	}
+
+	// Unverified certificates are ignored.
+	ctx = peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}},
+	}})
+	if _, ok := FromContext(GRPCToContext()(ctx, nil)); ok {
+		t.Error("want no identity in context")
+	}
+}
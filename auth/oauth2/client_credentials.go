@@ -0,0 +1,270 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	stdhttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+	"github.com/go-kit/kit/transport/http"
+)
+
+// TokenError is returned by ClientCredentials when the token endpoint fails
+// to issue a token, with the error response of RFC 6749, if any.
+type TokenError struct {
+	// Status is the HTTP status code of the token endpoint response.
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	switch {
+	case e.Code == "":
+		return fmt.Sprintf("fetching token: unexpected status %d", e.Status)
+	case e.Description == "":
+		return "fetching token: " + e.Code
+	default:
+		return "fetching token: " + e.Code + ": " + e.Description
+	}
+}
+
+// ErrorKind implements errkind.ErrorKinder. Failures of the token endpoint
+// are Unavailable, and rejected requests, e.g. of clients with invalid
+// credentials, are Internal: either way, the caller of the endpoint isn't to
+// blame.
+func (e *TokenError) ErrorKind() errkind.Kind {
+	if e.Status >= 500 {
+		return errkind.Unavailable
+	}
+	return errkind.Internal
+}
+
+// ClientCredentials gets access tokens from the token endpoint of an
+// authorization server with the client credentials grant of RFC 6749, and
+// caches them until they're about to expire. Concurrent requests share a
+// single fetch, and a token about to expire keeps being served while its
+// replacement is fetched.
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	params       url.Values
+	client       http.HTTPClient
+	inBody       bool
+	expiryDelta  time.Duration
+	timeout      time.Duration
+
+	mtx      sync.Mutex
+	token    string
+	expiry   time.Time
+	inflight *tokenFetch
+}
+
+// tokenFetch is a fetch of a token, shared by the requests waiting for it.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// ClientCredentialsOption sets an optional parameter for client credentials.
+type ClientCredentialsOption func(*ClientCredentials)
+
+// ClientCredentialsScopes sets the scopes requested for tokens.
+func ClientCredentialsScopes(scopes ...string) ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.scopes = scopes }
+}
+
+// ClientCredentialsParams sets additional parameters of token requests, e.g.
+// the audience or resource of the tokens.
+func ClientCredentialsParams(params url.Values) ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.params = params }
+}
+
+// ClientCredentialsClient sets the HTTP client used to call the token
+// endpoint. By default, http.DefaultClient is used.
+func ClientCredentialsClient(client http.HTTPClient) ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.client = client }
+}
+
+// ClientCredentialsInBody sends the client credentials as parameters of token
+// requests, for authorization servers that don't support HTTP Basic
+// authentication of clients, which is used by default.
+func ClientCredentialsInBody() ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.inBody = true }
+}
+
+// ClientCredentialsExpiryDelta sets how long before their expiration tokens
+// are refreshed, so that they don't expire in flight. By default, it's 10
+// seconds.
+func ClientCredentialsExpiryDelta(d time.Duration) ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.expiryDelta = d }
+}
+
+// ClientCredentialsTimeout sets the time limit of a token request. By
+// default, it's 10 seconds.
+func ClientCredentialsTimeout(d time.Duration) ClientCredentialsOption {
+	return func(c *ClientCredentials) { c.timeout = d }
+}
+
+// NewClientCredentials returns client credentials for the token endpoint at
+// the URL.
+func NewClientCredentials(tokenURL, clientID, clientSecret string, options ...ClientCredentialsOption) *ClientCredentials {
+	c := &ClientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       stdhttp.DefaultClient,
+		expiryDelta:  10 * time.Second,
+		timeout:      10 * time.Second,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Middleware returns an endpoint middleware that adds an access token to the
+// context under AccessTokenContextKey, to be sent by ContextToHTTP or
+// ContextToGRPC. Particularly useful for clients.
+func (c *ClientCredentials) Middleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			token, err := c.Token(ctx)
+			if err != nil {
+				return nil, err
+			}
+			ctx = context.WithValue(ctx, AccessTokenContextKey, token)
+			return next(ctx, request)
+		}
+	}
+}
+
+// Token returns the cached access token, or a new one if it's about to
+// expire. Tokens without an expiration are cached until Invalidate is called.
+// A token about to expire, but not expired yet, is returned while a new one
+// is fetched in the background.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mtx.Lock()
+	now := time.Now()
+	if c.token != "" && (c.expiry.IsZero() || now.Add(c.expiryDelta).Before(c.expiry)) {
+		c.mtx.Unlock()
+		return c.token, nil
+	}
+	f := c.fetchToken()
+	if c.token != "" && now.Before(c.expiry) {
+		token := c.token
+		c.mtx.Unlock()
+		return token, nil
+	}
+	c.mtx.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// fetchToken returns the fetch of a token in flight, or starts one. It must be
+// called with the mutex held. The fetch isn't bound to the context of any of
+// the requests waiting for it, but to the timeout.
+func (c *ClientCredentials) fetchToken() *tokenFetch {
+	if c.inflight != nil {
+		return c.inflight
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	c.inflight = f
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		token, expiry, err := c.fetch(ctx)
+
+		c.mtx.Lock()
+		if err == nil {
+			c.token, c.expiry = token, expiry
+		}
+		c.inflight, f.token, f.err = nil, token, err
+		c.mtx.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// Invalidate drops the cached access token, e.g. after it's been rejected,
+// so that the next call to Token gets a new one.
+func (c *ClientCredentials) Invalidate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.token, c.expiry = "", time.Time{}
+}
+
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{}
+	for name, values := range c.params {
+		form[name] = values
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	if c.inBody {
+		form.Set("client_id", c.clientID)
+		form.Set("client_secret", c.clientSecret)
+	}
+	req, err := stdhttp.NewRequest("POST", c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !c.inBody {
+		req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", time.Time{}, errkind.Wrap(errkind.Unavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var tr tokenResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&tr)
+	if resp.StatusCode != stdhttp.StatusOK {
+		return "", time.Time{}, &TokenError{Status: resp.StatusCode, Code: tr.Error, Description: tr.ErrorDescription}
+	}
+	if decodeErr != nil {
+		return "", time.Time{}, errkind.Errorf(errkind.Unavailable, "fetching token: %v", decodeErr)
+	}
+	if tr.AccessToken == "" {
+		return "", time.Time{}, errkind.New(errkind.Unavailable, "fetching token: no access token in response")
+	}
+	if !strings.EqualFold(tr.TokenType, bearer) {
+		return "", time.Time{}, errkind.Errorf(errkind.Internal, "fetching token: unsupported token type %q", tr.TokenType)
+	}
+	var expiry time.Time
+	if tr.ExpiresIn != "" {
+		seconds, err := tr.ExpiresIn.Int64()
+		if err != nil {
+			return "", time.Time{}, errkind.Errorf(errkind.Unavailable, "fetching token: invalid expires_in %q", tr.ExpiresIn)
+		}
+		expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return tr.AccessToken, expiry, nil
+}
@@ -0,0 +1,175 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func TestClientCredentials(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+
+	credentials := NewClientCredentials(server.URL+"/token", "client", "secret", ClientCredentialsScopes("read", "write"))
+	token, err := credentials.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := credentials.Token(context.Background()); err != nil || again != token {
+		t.Errorf("want cached token %q, have %q (%v)", token, again, err)
+	}
+	credentials.Invalidate()
+	if again, err := credentials.Token(context.Background()); err != nil || again == token {
+		t.Errorf("want new token, have %q (%v)", again, err)
+	}
+
+	// Tokens expiring within the expiry delta are refreshed in the
+	// background, and served until then.
+	server.expiresIn = 5
+	inBody := NewClientCredentials(server.URL+"/token", "client", "secret", ClientCredentialsInBody())
+	first, err := inBody.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := inBody.Token(context.Background()); err != nil || second != first {
+		t.Errorf("want token %q until refreshed, have %q (%v)", first, second, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		second, err := inBody.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second != first {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want refreshed token, have none")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = NewClientCredentials(server.URL+"/token", "client", "wrong").Token(context.Background())
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) {
+		t.Fatalf("want *TokenError, have %v", err)
+	}
+	if want, have := "invalid_client", tokenErr.Code; want != have {
+		t.Errorf("want code %q, have %q", want, have)
+	}
+	if want, have := errkind.Internal, errkind.Of(err); want != have {
+		t.Errorf("want kind %v, have %v", want, have)
+	}
+}
+
+func TestClientCredentialsSharedFetch(t *testing.T) {
+	var (
+		fetches int64
+		release = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+	credentials := NewClientCredentials(server.URL, "client", "secret")
+
+	// Waiting requests can give up, without failing the others.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := credentials.Token(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, have %v", context.DeadlineExceeded, err)
+	}
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := credentials.Token(context.Background())
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("want no error, have %v", err)
+		}
+	}
+	if want, have := int64(1), atomic.LoadInt64(&fetches); want != have {
+		t.Errorf("want %d fetches, have %d", want, have)
+	}
+
+}
+
+func TestClientCredentialsTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	credentials := NewClientCredentials(server.URL, "client", "secret", ClientCredentialsTimeout(10*time.Millisecond))
+	if _, err := credentials.Token(context.Background()); !errors.Is(err, errkind.Unavailable) {
+		t.Errorf("want %v, have %v", errkind.Unavailable, err)
+	}
+}
+
+func TestClientCredentialsToIntrospection(t *testing.T) {
+	authServer := newAuthServer()
+	defer authServer.Close()
+
+	introspector := NewIntrospector(authServer.URL+"/introspect", IntrospectorClientCredentials("resource", "secret"))
+	var serverEndpoint endpoint.Endpoint = func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return ctx.Value(IntrospectionContextKey).(*Introspection).ClientID, nil
+	}
+	server := httptest.NewServer(httptransport.NewServer(
+		introspector.Middleware("read")(serverEndpoint),
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerBefore(HTTPToContext()),
+	))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	call := func(scopes ...string) (interface{}, error) {
+		credentials := NewClientCredentials(authServer.URL+"/token", "client", "secret", ClientCredentialsScopes(scopes...))
+		client := httptransport.NewClient(
+			"GET", u,
+			httptransport.EncodeJSONRequest,
+			func(_ context.Context, r *http.Response) (interface{}, error) {
+				if r.StatusCode != http.StatusOK {
+					return nil, errors.New(r.Status + ": " + r.Header.Get("WWW-Authenticate"))
+				}
+				return r.Header.Get("Content-Type"), nil
+			},
+			httptransport.ClientBefore(ContextToHTTP()),
+		)
+		return credentials.Middleware()(client.Endpoint())(context.Background(), nil)
+	}
+
+	if _, err := call("read"); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+	_, err := call("write")
+	if want, have := `403 Forbidden: Bearer error="insufficient_scope", scope="read"`, err.Error(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,453 @@
+package oauth2
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	stdhttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+	"github.com/go-kit/kit/transport/http"
+)
+
+type contextKey string
+
+const (
+	// AccessTokenContextKey holds the key used to store an access token in
+	// the context.
+	AccessTokenContextKey contextKey = "OAuth2AccessToken"
+
+	// IntrospectionContextKey holds the key used to store the *Introspection
+	// of the access token in the context.
+	IntrospectionContextKey contextKey = "OAuth2Introspection"
+)
+
+// The errors of tokens failing authentication, which transports encode as
+// 401 Unauthorized, or UNAUTHENTICATED.
+var (
+	// ErrTokenContextMissing denotes a token was not passed into the
+	// introspection middleware's context.
+	ErrTokenContextMissing error = authError("access token was not passed through the context")
+
+	// ErrTokenInactive denotes the authorization server reported a token as
+	// not active, e.g. because it's expired, revoked or unknown.
+	ErrTokenInactive error = authError("access token is not active")
+)
+
+// authError is the type of the errors of tokens that fail authentication.
+type authError string
+
+func (e authError) Error() string {
+	return string(e)
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e authError) StatusCode() int {
+	return stdhttp.StatusUnauthorized
+}
+
+// Headers implements the http transport Headerer, with the challenge of
+// RFC 6750.
+func (e authError) Headers() stdhttp.Header {
+	challenge := "Bearer"
+	if e != ErrTokenContextMissing {
+		challenge += ` error="invalid_token"`
+	}
+	h := stdhttp.Header{}
+	h.Set("WWW-Authenticate", challenge)
+	return h
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e authError) ErrorKind() errkind.Kind {
+	return errkind.Unauthenticated
+}
+
+// GRPCStatus returns the UNAUTHENTICATED status of the error.
+func (e authError) GRPCStatus() *status.Status {
+	return status.New(codes.Unauthenticated, string(e))
+}
+
+// ScopeError is returned by the introspection middleware when an active token
+// lacks the required scopes. Transports encode it as 403 Forbidden, or
+// PERMISSION_DENIED.
+type ScopeError struct {
+	Required []string
+}
+
+func (e *ScopeError) Error() string {
+	return "access token lacks the scopes " + strings.Join(e.Required, ", ")
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e *ScopeError) StatusCode() int {
+	return stdhttp.StatusForbidden
+}
+
+// Headers implements the http transport Headerer, with the challenge of
+// RFC 6750.
+func (e *ScopeError) Headers() stdhttp.Header {
+	h := stdhttp.Header{}
+	h.Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(e.Required, " ")+`"`)
+	return h
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *ScopeError) ErrorKind() errkind.Kind {
+	return errkind.PermissionDenied
+}
+
+// GRPCStatus returns the PERMISSION_DENIED status of the error.
+func (e *ScopeError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, e.Error())
+}
+
+// Introspection is the response of a token introspection endpoint, as per
+// RFC 7662.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	// Extra holds the other members of the response, e.g. claims specific
+	// to the authorization server.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, collecting unknown members in
+// Extra.
+func (i *Introspection) UnmarshalJSON(b []byte) error {
+	type introspection Introspection
+	if err := json.Unmarshal(b, (*introspection)(i)); err != nil {
+		return err
+	}
+	var members map[string]interface{}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	for _, name := range []string{"active", "scope", "client_id", "username", "token_type", "exp", "iat", "nbf", "sub", "aud", "iss", "jti"} {
+		delete(members, name)
+	}
+	if len(members) > 0 {
+		i.Extra = members
+	}
+	return nil
+}
+
+// Scopes returns the scopes of the space-delimited scope member.
+func (i *Introspection) Scopes() []string {
+	return strings.Fields(i.Scope)
+}
+
+// HasScopes reports whether the token is granted all the scopes.
+func (i *Introspection) HasScopes(scopes ...string) bool {
+	granted := i.Scopes()
+outer:
+	for _, scope := range scopes {
+		for _, g := range granted {
+			if g == scope {
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Audience is the aud member of a token, which may be a single string or an
+// array of strings.
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// Introspector validates opaque access tokens with the token introspection
+// endpoint of an authorization server, as per RFC 7662. Responses are cached
+// for a while, so that a token used repeatedly doesn't cost a round trip to
+// the authorization server on every request, and concurrent requests with the
+// same token share a single round trip.
+type Introspector struct {
+	url              string
+	client           http.HTTPClient
+	clientID         string
+	clientSecret     string
+	cacheTTL         time.Duration
+	inactiveCacheTTL time.Duration
+	cacheSize        int
+	timeout          time.Duration
+
+	mtx   sync.Mutex
+	lru   *list.List // of *cachedIntrospection, most recently used first
+	cache map[[sha256.Size]byte]*list.Element
+	calls map[[sha256.Size]byte]*introspectionCall
+}
+
+type cachedIntrospection struct {
+	key           [sha256.Size]byte
+	introspection *Introspection
+	expires       time.Time
+}
+
+// introspectionCall is a call to the introspection endpoint, shared by the
+// requests with the same token. It's canceled once none of them waits for it,
+// or once the timeout elapses.
+type introspectionCall struct {
+	done          chan struct{}
+	introspection *Introspection
+	err           error
+	waiters       int
+	cancel        context.CancelFunc
+}
+
+// IntrospectorOption sets an optional parameter for introspectors.
+type IntrospectorOption func(*Introspector)
+
+// IntrospectorClient sets the HTTP client used to call the introspection
+// endpoint. By default, http.DefaultClient is used.
+func IntrospectorClient(client http.HTTPClient) IntrospectorOption {
+	return func(i *Introspector) { i.client = client }
+}
+
+// IntrospectorClientCredentials sets the credentials the introspector
+// authenticates with to the introspection endpoint, with HTTP Basic
+// authentication.
+func IntrospectorClientCredentials(clientID, clientSecret string) IntrospectorOption {
+	return func(i *Introspector) { i.clientID, i.clientSecret = clientID, clientSecret }
+}
+
+// IntrospectorCacheTTL sets how long introspection responses of active tokens
+// are cached. They're never cached past the expiration of the tokens. A TTL of
+// zero disables the cache. By default, it's a minute.
+func IntrospectorCacheTTL(ttl time.Duration) IntrospectorOption {
+	return func(i *Introspector) { i.cacheTTL = ttl }
+}
+
+// IntrospectorInactiveCacheTTL sets how long introspection responses of
+// tokens that aren't active are cached. Such tokens are usually presented
+// once, or by clients that fail anyway, so by default, they aren't cached,
+// and can't evict the active ones.
+func IntrospectorInactiveCacheTTL(ttl time.Duration) IntrospectorOption {
+	return func(i *Introspector) { i.inactiveCacheTTL = ttl }
+}
+
+// IntrospectorCacheSize sets the maximum number of cached introspection
+// responses. The least recently used ones are evicted first. By default,
+// it's 10000.
+func IntrospectorCacheSize(size int) IntrospectorOption {
+	return func(i *Introspector) { i.cacheSize = size }
+}
+
+// IntrospectorTimeout sets the time limit of a call to the introspection
+// endpoint. By default, it's 10 seconds.
+func IntrospectorTimeout(d time.Duration) IntrospectorOption {
+	return func(i *Introspector) { i.timeout = d }
+}
+
+// NewIntrospector returns an introspector of tokens with the introspection
+// endpoint at the URL.
+func NewIntrospector(url string, options ...IntrospectorOption) *Introspector {
+	i := &Introspector{
+		url:       url,
+		client:    stdhttp.DefaultClient,
+		cacheTTL:  time.Minute,
+		cacheSize: 10000,
+		timeout:   10 * time.Second,
+		lru:       list.New(),
+		cache:     map[[sha256.Size]byte]*list.Element{},
+		calls:     map[[sha256.Size]byte]*introspectionCall{},
+	}
+	for _, option := range options {
+		option(i)
+	}
+	return i
+}
+
+// Middleware returns an endpoint middleware that introspects the access
+// token in the context, e.g. put there by HTTPToContext or GRPCToContext. It
+// fails with ErrTokenContextMissing if there's no token, ErrTokenInactive if
+// the token isn't active, and a *ScopeError if the token isn't granted all
+// the scopes. Otherwise, the *Introspection of the token is added to the
+// context under IntrospectionContextKey.
+func (i *Introspector) Middleware(scopes ...string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			token, ok := ctx.Value(AccessTokenContextKey).(string)
+			if !ok {
+				return nil, ErrTokenContextMissing
+			}
+			introspection, err := i.Introspect(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			if !introspection.Active {
+				return nil, ErrTokenInactive
+			}
+			if !introspection.HasScopes(scopes...) {
+				return nil, &ScopeError{Required: scopes}
+			}
+			ctx = context.WithValue(ctx, IntrospectionContextKey, introspection)
+			return next(ctx, request)
+		}
+	}
+}
+
+// Introspect returns the introspection of the token, from the cache or the
+// introspection endpoint. Tokens whose expiration or not before times,
+// if any, don't hold are reported as not active. Failures to call the
+// endpoint are Unavailable errors, as classified by errkind.
+func (i *Introspector) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	key := sha256.Sum256([]byte(token))
+	i.mtx.Lock()
+	if introspection, ok := i.cached(key, time.Now()); ok {
+		i.mtx.Unlock()
+		return introspection, nil
+	}
+	c, ok := i.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithTimeout(context.Background(), i.timeout)
+		c = &introspectionCall{done: make(chan struct{}), cancel: cancel}
+		i.calls[key] = c
+		go i.call(callCtx, key, token, c)
+	}
+	c.waiters++
+	i.mtx.Unlock()
+
+	select {
+	case <-c.done:
+		return c.introspection, c.err
+	case <-ctx.Done():
+		i.mtx.Lock()
+		if c.waiters--; c.waiters == 0 {
+			c.cancel()
+			if i.calls[key] == c {
+				delete(i.calls, key)
+			}
+		}
+		i.mtx.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// call introspects the token for the requests waiting for c, and caches the
+// introspection.
+func (i *Introspector) call(ctx context.Context, key [sha256.Size]byte, token string, c *introspectionCall) {
+	defer c.cancel()
+	introspection, err := i.introspect(ctx, token)
+
+	i.mtx.Lock()
+	if err == nil {
+		i.store(key, introspection, time.Now())
+	}
+	if i.calls[key] == c {
+		delete(i.calls, key)
+	}
+	c.introspection, c.err = introspection, err
+	i.mtx.Unlock()
+	close(c.done)
+}
+
+func (i *Introspector) introspect(ctx context.Context, token string) (*Introspection, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := stdhttp.NewRequest("POST", i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	}
+	resp, err := i.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errkind.Wrap(errkind.Unavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != stdhttp.StatusOK {
+		return nil, errkind.Errorf(errkind.Unavailable, "introspecting token: unexpected status %s", resp.Status)
+	}
+	introspection := &Introspection{}
+	if err := json.NewDecoder(resp.Body).Decode(introspection); err != nil {
+		return nil, errkind.Errorf(errkind.Unavailable, "introspecting token: %v", err)
+	}
+
+	now := time.Now()
+	if introspection.Active && introspection.ExpiresAt != 0 && !now.Before(time.Unix(introspection.ExpiresAt, 0)) {
+		introspection.Active = false
+	}
+	if introspection.Active && introspection.NotBefore != 0 && now.Before(time.Unix(introspection.NotBefore, 0)) {
+		introspection.Active = false
+	}
+	return introspection, nil
+}
+
+// cached returns the cached introspection of the token with the key, if it's
+// still fresh. It must be called with the mutex held.
+func (i *Introspector) cached(key [sha256.Size]byte, now time.Time) (*Introspection, bool) {
+	e, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cachedIntrospection)
+	if !now.Before(entry.expires) {
+		i.lru.Remove(e)
+		delete(i.cache, key)
+		return nil, false
+	}
+	i.lru.MoveToFront(e)
+	return entry.introspection, true
+}
+
+// store caches the introspection, evicting the least recently used one if
+// the cache is full. It must be called with the mutex held.
+func (i *Introspector) store(key [sha256.Size]byte, introspection *Introspection, now time.Time) {
+	ttl := i.cacheTTL
+	if !introspection.Active {
+		ttl = i.inactiveCacheTTL
+	}
+	if ttl <= 0 || i.cacheSize <= 0 {
+		return
+	}
+	expires := now.Add(ttl)
+	if introspection.Active && introspection.ExpiresAt != 0 {
+		if exp := time.Unix(introspection.ExpiresAt, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+	if !now.Before(expires) {
+		return
+	}
+	if e, ok := i.cache[key]; ok {
+		i.lru.Remove(e)
+	}
+	i.cache[key] = i.lru.PushFront(&cachedIntrospection{key: key, introspection: introspection, expires: expires})
+	if i.lru.Len() > i.cacheSize {
+		oldest := i.lru.Back()
+		i.lru.Remove(oldest)
+		delete(i.cache, oldest.Value.(*cachedIntrospection).key)
+	}
+}
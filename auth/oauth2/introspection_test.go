@@ -0,0 +1,266 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+// authServer is a stand-in authorization server, with a client credentials
+// token endpoint at /token and an introspection endpoint at /introspect.
+type authServer struct {
+	*httptest.Server
+	expiresIn int
+
+	mtx            sync.Mutex
+	tokens         map[string]Introspection
+	issued         int64
+	introspections int64
+}
+
+func newAuthServer() *authServer {
+	s := &authServer{expiresIn: 3600, tokens: map[string]Introspection{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/introspect", s.introspect)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *authServer) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "client_credentials" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "bad credentials"})
+		return
+	}
+	s.mtx.Lock()
+	s.issued++
+	token := "token-" + strconv.FormatInt(s.issued, 10)
+	s.tokens[token] = Introspection{
+		Active:    true,
+		Scope:     r.PostFormValue("scope"),
+		ClientID:  id,
+		ExpiresAt: time.Now().Add(time.Duration(s.expiresIn) * time.Second).Unix(),
+	}
+	s.mtx.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"access_token": token, "token_type": "Bearer", "expires_in": s.expiresIn})
+}
+
+func (s *authServer) introspect(w http.ResponseWriter, r *http.Request) {
+	if id, secret, ok := r.BasicAuth(); !ok || id != "resource" || secret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	atomic.AddInt64(&s.introspections, 1)
+	s.mtx.Lock()
+	introspection := s.tokens[r.PostFormValue("token")]
+	s.mtx.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(introspection)
+}
+
+func (s *authServer) add(token string, introspection Introspection) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.tokens[token] = introspection
+}
+
+func introspect(introspector *Introspector, token string, scopes ...string) (*Introspection, error) {
+	ctx := context.Background()
+	if token != "" {
+		ctx = context.WithValue(ctx, AccessTokenContextKey, token)
+	}
+	response, err := introspector.Middleware(scopes...)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return ctx.Value(IntrospectionContextKey), nil
+	})(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*Introspection), nil
+}
+
+func TestIntrospector(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+	server.add("active", Introspection{Active: true, Scope: "read write", Subject: "alice", Audience: Audience{"api"}})
+	server.add("expired", Introspection{Active: true, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	introspector := NewIntrospector(server.URL+"/introspect", IntrospectorClientCredentials("resource", "secret"))
+
+	introspection, err := introspect(introspector, "active", "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "alice", introspection.Subject; want != have {
+		t.Errorf("want subject %q, have %q", want, have)
+	}
+	if _, err := introspect(introspector, "active", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(1), atomic.LoadInt64(&server.introspections); want != have {
+		t.Errorf("want %d introspections, have %d", want, have)
+	}
+
+	for _, tc := range []struct {
+		token  string
+		scopes []string
+		want   error
+	}{
+		{"", nil, ErrTokenContextMissing},
+		{"unknown", nil, ErrTokenInactive},
+		{"expired", nil, ErrTokenInactive},
+		{"active", []string{"read", "admin"}, &ScopeError{Required: []string{"read", "admin"}}},
+	} {
+		_, err := introspect(introspector, tc.token, tc.scopes...)
+		if tc.want.Error() != err.Error() {
+			t.Errorf("%q: want %v, have %v", tc.token, tc.want, err)
+		}
+	}
+
+	var scopeErr *ScopeError
+	_, err = introspect(introspector, "active", "admin")
+	if !errors.As(err, &scopeErr) {
+		t.Fatalf("want *ScopeError, have %v", err)
+	}
+	if want, have := http.StatusForbidden, scopeErr.StatusCode(); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := codes.PermissionDenied, status.Code(err); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := codes.Unauthenticated, status.Code(ErrTokenInactive); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// Failures to call the endpoint are not the caller's.
+	unauthorized := NewIntrospector(server.URL + "/introspect")
+	if _, err := introspect(unauthorized, "active"); !errors.Is(err, errkind.Unavailable) {
+		t.Errorf("want %v, have %v", errkind.Unavailable, err)
+	}
+}
+
+func TestIntrospectorCache(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+	for _, token := range []string{"a", "b", "c"} {
+		server.add(token, Introspection{Active: true})
+	}
+	introspector := NewIntrospector(server.URL+"/introspect", IntrospectorClientCredentials("resource", "secret"), IntrospectorCacheSize(2))
+
+	// The least recently used introspections are evicted first.
+	for _, c := range []struct {
+		token string
+		want  int64
+	}{
+		{"a", 1}, {"b", 2}, {"a", 2}, {"c", 3}, {"a", 3}, {"b", 4},
+	} {
+		if _, err := introspect(introspector, c.token); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := c.want, atomic.LoadInt64(&server.introspections); want != have {
+			t.Errorf("%q: want %d introspections, have %d", c.token, want, have)
+		}
+	}
+
+	// Inactive tokens aren't cached by default.
+	for want := int64(5); want <= 6; want++ {
+		if _, err := introspect(introspector, "unknown"); err != ErrTokenInactive {
+			t.Fatalf("want %v, have %v", ErrTokenInactive, err)
+		}
+		if have := atomic.LoadInt64(&server.introspections); want != have {
+			t.Errorf("want %d introspections, have %d", want, have)
+		}
+	}
+	introspector = NewIntrospector(server.URL+"/introspect", IntrospectorClientCredentials("resource", "secret"), IntrospectorInactiveCacheTTL(time.Minute))
+	for i := 0; i < 2; i++ {
+		if _, err := introspect(introspector, "unknown"); err != ErrTokenInactive {
+			t.Fatalf("want %v, have %v", ErrTokenInactive, err)
+		}
+	}
+	if want, have := int64(7), atomic.LoadInt64(&server.introspections); want != have {
+		t.Errorf("want %d introspections, have %d", want, have)
+	}
+}
+
+func TestIntrospectorConcurrentCalls(t *testing.T) {
+	var introspections int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&introspections, 1)
+		<-release
+		json.NewEncoder(w).Encode(Introspection{Active: true})
+	}))
+	defer server.Close()
+	introspector := NewIntrospector(server.URL)
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := introspect(introspector, "token")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Requests giving up don't fail the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := introspector.Introspect(ctx, "token"); err != context.Canceled {
+		t.Errorf("want %v, have %v", context.Canceled, err)
+	}
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("want no error, have %v", err)
+		}
+	}
+	if want, have := int64(1), atomic.LoadInt64(&introspections); want != have {
+		t.Errorf("want %d introspections, have %d", want, have)
+	}
+}
+
+func TestIntrospectorTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	introspector := NewIntrospector(server.URL, IntrospectorTimeout(10*time.Millisecond))
+	if _, err := introspect(introspector, "token"); !errors.Is(err, errkind.Unavailable) {
+		t.Errorf("want %v, have %v", errkind.Unavailable, err)
+	}
+}
+
+func TestIntrospectionUnmarshal(t *testing.T) {
+	var introspection Introspection
+	if err := json.Unmarshal([]byte(`{"active":true,"aud":"api","tenant":"acme"}`), &introspection); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(introspection.Audience); want != have || introspection.Audience[0] != "api" {
+		t.Errorf("want audience [api], have %v", introspection.Audience)
+	}
+	if want, have := "acme", introspection.Extra["tenant"]; want != have {
+		t.Errorf("want tenant %q, have %v", want, have)
+	}
+}
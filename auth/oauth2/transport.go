@@ -0,0 +1,81 @@
+package oauth2
+
+import (
+	"context"
+	stdhttp "net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/kit/transport/http"
+)
+
+const bearer string = "bearer"
+
+// HTTPToContext moves a bearer access token from request header to context.
+// Particularly useful for servers.
+func HTTPToContext() http.RequestFunc {
+	return func(ctx context.Context, r *stdhttp.Request) context.Context {
+		token, ok := extractTokenFromAuthHeader(r.Header.Get("Authorization"))
+		if !ok {
+			return ctx
+		}
+
+		return context.WithValue(ctx, AccessTokenContextKey, token)
+	}
+}
+
+// ContextToHTTP moves an access token from context to request header.
+// Particularly useful for clients.
+func ContextToHTTP() http.RequestFunc {
+	return func(ctx context.Context, r *stdhttp.Request) context.Context {
+		token, ok := ctx.Value(AccessTokenContextKey).(string)
+		if ok {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext moves a bearer access token from grpc metadata to context.
+// Particularly useful for servers.
+func GRPCToContext() grpc.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		// capital "Key" is illegal in HTTP/2.
+		authHeader, ok := md["authorization"]
+		if !ok {
+			return ctx
+		}
+
+		token, ok := extractTokenFromAuthHeader(authHeader[0])
+		if ok {
+			ctx = context.WithValue(ctx, AccessTokenContextKey, token)
+		}
+
+		return ctx
+	}
+}
+
+// ContextToGRPC moves an access token from context to grpc metadata.
+// Particularly useful for clients.
+func ContextToGRPC() grpc.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		token, ok := ctx.Value(AccessTokenContextKey).(string)
+		if ok {
+			// capital "Key" is illegal in HTTP/2.
+			(*md)["authorization"] = []string{"Bearer " + token}
+		}
+
+		return ctx
+	}
+}
+
+func extractTokenFromAuthHeader(val string) (token string, ok bool) {
+	authHeaderParts := strings.Split(val, " ")
+	if len(authHeaderParts) != 2 || !strings.EqualFold(authHeaderParts[0], bearer) {
+		return "", false
+	}
+
+	return authHeaderParts[1], true
+}
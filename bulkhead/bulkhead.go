@@ -0,0 +1,184 @@
+// Package bulkhead implements the bulkhead pattern, which isolates the
+// concurrency used by parts of a service, so that a single slow dependency
+// can't tie up every goroutine and connection. Each Bulkhead is a named
+// partition with a fixed number of slots, and an optional bounded queue for
+// requests waiting for one.
+package bulkhead
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+	"github.com/go-kit/kit/internal/waitqueue"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// RejectedError is returned by the middleware when a request can't get a slot
+// in a bulkhead. It implements the StatusCoder interface of package
+// transport/http, so DefaultErrorEncoder responds with 503 Service
+// Unavailable, and the GRPCStatus method recognized by package grpc/status, so
+// gRPC servers respond with RESOURCE_EXHAUSTED.
+type RejectedError struct {
+	// Partition is the name of the bulkhead that rejected the request.
+	Partition string
+
+	// Queued reports whether the request waited in the queue and timed out,
+	// rather than finding the queue full.
+	Queued bool
+}
+
+func (e *RejectedError) Error() string {
+	if e.Queued {
+		return fmt.Sprintf("bulkhead %s: timed out waiting for a slot", e.Partition)
+	}
+	return fmt.Sprintf("bulkhead %s: no slot available", e.Partition)
+}
+
+// StatusCode implements the StatusCoder interface of package transport/http.
+func (e *RejectedError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// GRPCStatus returns a RESOURCE_EXHAUSTED status.
+func (e *RejectedError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *RejectedError) ErrorKind() errkind.Kind {
+	return errkind.ResourceExhausted
+}
+
+// Bulkhead is a named partition that lets a fixed number of requests run
+// concurrently. Requests beyond that wait in a first-in, first-out queue if
+// one is configured, and are rejected with a *RejectedError otherwise. A
+// Bulkhead may be shared by several endpoints, which then share its slots.
+type Bulkhead struct {
+	name         string
+	concurrency  int
+	queueSize    int
+	queueTimeout time.Duration
+	occupancy    metrics.Gauge
+	queued       metrics.Gauge
+	rejected     metrics.Counter
+
+	mtx    sync.Mutex
+	active int
+	queue  *waitqueue.Queue
+}
+
+// Option sets an optional parameter for bulkheads.
+type Option func(*Bulkhead)
+
+// Queue makes requests that find every slot taken wait for one, in order. At
+// most size requests wait at once, each for at most timeout. By default,
+// there's no queue.
+func Queue(size int, timeout time.Duration) Option {
+	return func(b *Bulkhead) { b.queueSize, b.queueTimeout = size, timeout }
+}
+
+// OccupancyGauge sets a gauge that reports the number of slots in use.
+func OccupancyGauge(g metrics.Gauge) Option {
+	return func(b *Bulkhead) { b.occupancy = g }
+}
+
+// QueuedGauge sets a gauge that reports the number of requests waiting in the
+// queue.
+func QueuedGauge(g metrics.Gauge) Option {
+	return func(b *Bulkhead) { b.queued = g }
+}
+
+// RejectedCounter sets a counter that's incremented for every rejected
+// request.
+func RejectedCounter(c metrics.Counter) Option {
+	return func(b *Bulkhead) { b.rejected = c }
+}
+
+// New returns a Bulkhead named name, that lets concurrency requests run at
+// once. The name is reported in errors; metrics should be labeled by the
+// caller, e.g. with With("partition", name).
+func New(name string, concurrency int, options ...Option) *Bulkhead {
+	b := &Bulkhead{
+		name:        name,
+		concurrency: concurrency,
+		occupancy:   discard.NewGauge(),
+		queued:      discard.NewGauge(),
+		rejected:    discard.NewCounter(),
+	}
+	b.queue = waitqueue.New(&b.mtx)
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Middleware returns an endpoint.Middleware that runs requests within the
+// bulkhead b. Requests that can't get a slot fail with a *RejectedError, and
+// requests whose context is done while queued fail with the context's error.
+func Middleware(b *Bulkhead) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := b.acquire(ctx); err != nil {
+				return nil, err
+			}
+			defer b.release()
+			return next(ctx, request)
+		}
+	}
+}
+
+// Name returns the name of the bulkhead.
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// Inflight returns the number of slots in use.
+func (b *Bulkhead) Inflight() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.active
+}
+
+func (b *Bulkhead) acquire(ctx context.Context) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.active < b.concurrency {
+		b.active++
+		b.occupancy.Set(float64(b.active))
+		return nil
+	}
+	if b.queue.Len() >= b.queueSize || b.queueTimeout <= 0 {
+		b.rejected.Add(1)
+		return &RejectedError{Partition: b.name}
+	}
+	b.queued.Set(float64(b.queue.Len() + 1)) // including this request
+	err := b.queue.Wait(ctx, b.queueTimeout)
+	b.queued.Set(float64(b.queue.Len()))
+	if err == waitqueue.ErrTimeout {
+		b.rejected.Add(1)
+		return &RejectedError{Partition: b.name, Queued: true}
+	}
+	return err
+}
+
+func (b *Bulkhead) release() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	// Hand the slot over to the first queued request, if any.
+	if b.queue.Grant() {
+		b.queued.Set(float64(b.queue.Len()))
+		return
+	}
+	b.active--
+	b.occupancy.Set(float64(b.active))
+}
@@ -0,0 +1,160 @@
+package bulkhead_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/bulkhead"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics/generic"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func TestBulkheadRejects(t *testing.T) {
+	var (
+		occupancy = generic.NewGauge("occupancy")
+		rejected  = generic.NewCounter("rejected")
+		b         = bulkhead.New("db", 2, bulkhead.OccupancyGauge(occupancy), bulkhead.RejectedCounter(rejected))
+		block     = make(chan struct{})
+		e, wait   = blocking(b, block, 2)
+	)
+
+	_, err := e(context.Background(), struct{}{})
+	var rejectedErr *bulkhead.RejectedError
+	if !errors.As(err, &rejectedErr) {
+		t.Fatalf("want *RejectedError, have %v", err)
+	}
+	if want, have := "db", rejectedErr.Partition; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := 2.0, occupancy.Value(); want != have {
+		t.Errorf("occupancy: want %v, have %v", want, have)
+	}
+	if want, have := 1.0, rejected.Value(); want != have {
+		t.Errorf("rejected: want %v, have %v", want, have)
+	}
+
+	close(block)
+	wait()
+	if want, have := 0.0, occupancy.Value(); want != have {
+		t.Errorf("occupancy: want %v, have %v", want, have)
+	}
+	if _, err := e(context.Background(), struct{}{}); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	var (
+		queued  = generic.NewGauge("queued")
+		b       = bulkhead.New("db", 1, bulkhead.Queue(1, time.Second), bulkhead.QueuedGauge(queued))
+		block   = make(chan struct{})
+		e, wait = blocking(b, block, 1)
+		done    = make(chan error)
+	)
+
+	go func() { _, err := e(context.Background(), struct{}{}); done <- err }()
+	for queued.Value() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full.
+	if _, err := e(context.Background(), struct{}{}); err == nil {
+		t.Fatal("want error, have none")
+	}
+
+	close(block)
+	wait()
+	if err := <-done; err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+	if want, have := 0.0, queued.Value(); want != have {
+		t.Errorf("queued: want %v, have %v", want, have)
+	}
+	if want, have := 0, b.Inflight(); want != have {
+		t.Errorf("inflight: want %d, have %d", want, have)
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	var (
+		rejected = generic.NewCounter("rejected")
+		b        = bulkhead.New("db", 1, bulkhead.Queue(1, time.Millisecond), bulkhead.RejectedCounter(rejected))
+		block    = make(chan struct{})
+		e, wait  = blocking(b, block, 1)
+	)
+	defer wait()
+	defer close(block)
+
+	_, err := e(context.Background(), struct{}{})
+	var rejectedErr *bulkhead.RejectedError
+	if !errors.As(err, &rejectedErr) || !rejectedErr.Queued {
+		t.Fatalf("want queued *RejectedError, have %v", err)
+	}
+	if want, have := 1.0, rejected.Value(); want != have {
+		t.Errorf("rejected: want %v, have %v", want, have)
+	}
+}
+
+func TestBulkheadQueueContext(t *testing.T) {
+	var (
+		rejected    = generic.NewCounter("rejected")
+		b           = bulkhead.New("db", 1, bulkhead.Queue(1, time.Second), bulkhead.RejectedCounter(rejected))
+		block       = make(chan struct{})
+		e, wait     = blocking(b, block, 1)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer wait()
+	defer close(block)
+
+	cancel()
+	if _, err := e(ctx, struct{}{}); err != context.Canceled {
+		t.Errorf("want %v, have %v", context.Canceled, err)
+	}
+	if want, have := 0.0, rejected.Value(); want != have {
+		t.Errorf("rejected: want %v, have %v", want, have)
+	}
+}
+
+func TestRejectedErrorTransports(t *testing.T) {
+	err := &bulkhead.RejectedError{Partition: "db"}
+
+	rec := httptest.NewRecorder()
+	httptransport.DefaultErrorEncoder(context.Background(), err, rec)
+	if want, have := http.StatusServiceUnavailable, rec.Code; want != have {
+		t.Errorf("HTTP: want %d, have %d", want, have)
+	}
+
+	if want, have := codes.ResourceExhausted, status.Code(err); want != have {
+		t.Errorf("gRPC: want %v, have %v", want, have)
+	}
+}
+
+// blocking returns an endpoint guarded by b that blocks until block is
+// closed, after starting n requests that occupy it. wait returns once those
+// requests are done.
+func blocking(b *bulkhead.Bulkhead, block chan struct{}, n int) (e endpoint.Endpoint, wait func()) {
+	e = bulkhead.Middleware(b)(func(context.Context, interface{}) (interface{}, error) {
+		<-block
+		return struct{}{}, nil
+	})
+	done := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		go func() { e(context.Background(), struct{}{}); done <- struct{}{} }()
+	}
+	for b.Inflight() < n {
+		time.Sleep(time.Millisecond)
+	}
+	return e, func() {
+		for i := 0; i < n; i++ {
+			<-done
+		}
+	}
+}
@@ -6,5 +6,7 @@
 //
 // We provide several implementations in this package, but if you're looking
 // for guidance, Gobreaker is probably the best place to start.  It has a
-// simple and intuitive API, and is well-tested.
+// simple and intuitive API, and is well-tested. NativeBreaker doesn't depend
+// on a third-party package, and adds time-based windows, slow call detection,
+// and reporting through the log and metrics packages.
 package circuitbreaker
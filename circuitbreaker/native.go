@@ -0,0 +1,436 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// ErrCircuitOpen is returned by NativeBreaker when the circuit breaker
+// rejects a request.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a Breaker. Its numeric value is what's reported to
+// the gauge set with BreakerGauge.
+type State int
+
+const (
+	// StateClosed lets every request through, and records their outcome.
+	StateClosed State = iota
+
+	// StateOpen rejects every request, until the open timeout elapses.
+	StateOpen
+
+	// StateHalfOpen lets a limited number of trial requests through, to
+	// decide whether to close or open again.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a native circuit breaker, to be used with NativeBreaker. It
+// records the outcome of requests in a sliding window, either the most recent
+// calls or the most recent period of time, and opens when the share of failed
+// or slow calls in the window reaches a threshold. After the open timeout, it
+// lets a few trial requests through, and closes again if they succeed.
+type Breaker struct {
+	windowSize    int
+	windowPeriod  time.Duration
+	failureRate   float64
+	slowCall      time.Duration
+	slowRate      float64
+	minimumCalls  int
+	openTimeout   time.Duration
+	halfOpenCalls int
+	isFailure     func(error) bool
+	logger        log.Logger
+	gauge         metrics.Gauge
+	timeNow       func() time.Time
+
+	mtx        sync.Mutex
+	state      State
+	forced     bool
+	generation uint64 // incremented on every transition
+	window     window
+	openedAt   time.Time
+	trials     int // started in the half-open state
+	trial      struct {
+		completed, failures, slow int
+	}
+}
+
+// BreakerOption sets an optional parameter for a Breaker.
+type BreakerOption func(*Breaker)
+
+// CountWindow makes the breaker consider the outcome of the last size calls,
+// which must be at least the number of half-open calls. This is the default,
+// with a size of 100.
+func CountWindow(size int) BreakerOption {
+	return func(b *Breaker) { b.windowSize, b.windowPeriod = size, 0 }
+}
+
+// TimeWindow makes the breaker consider the outcome of the calls that
+// completed within the last period.
+func TimeWindow(period time.Duration) BreakerOption {
+	return func(b *Breaker) { b.windowSize, b.windowPeriod = 0, period }
+}
+
+// FailureRateThreshold sets the share of failed calls in the window, between
+// 0 and 1, at which the breaker opens. By default, it's 0.5.
+func FailureRateThreshold(rate float64) BreakerOption {
+	return func(b *Breaker) { b.failureRate = rate }
+}
+
+// SlowCallThreshold makes calls that take longer than d count as slow, and
+// sets the share of slow calls in the window, between 0 and 1, at which the
+// breaker opens. By default, slow calls are not considered.
+func SlowCallThreshold(d time.Duration, rate float64) BreakerOption {
+	return func(b *Breaker) { b.slowCall, b.slowRate = d, rate }
+}
+
+// MinimumCalls sets the number of calls the window must contain before the
+// breaker considers opening. By default, it's 10.
+func MinimumCalls(n int) BreakerOption {
+	return func(b *Breaker) { b.minimumCalls = n }
+}
+
+// OpenTimeout sets how long the breaker stays open before letting trial
+// requests through. By default, it's 60 seconds.
+func OpenTimeout(d time.Duration) BreakerOption {
+	return func(b *Breaker) { b.openTimeout = d }
+}
+
+// HalfOpenCalls sets the number of trial requests let through in the
+// half-open state. Once all of them have completed, the breaker closes if their
+// failure and slow call rates are below the thresholds, and opens again
+// otherwise. By default, it's 5.
+func HalfOpenCalls(n int) BreakerOption {
+	return func(b *Breaker) { b.halfOpenCalls = n }
+}
+
+// BreakerFailure sets the predicate deciding whether the error returned by a
+// call counts as a failure. By default, every non-nil error counts. Errors
+// that don't count as failures, e.g. business logic errors, count as
+// successes.
+func BreakerFailure(isFailure func(error) bool) BreakerOption {
+	return func(b *Breaker) { b.isFailure = isFailure }
+}
+
+// BreakerLogger sets a logger to which state changes are logged.
+func BreakerLogger(logger log.Logger) BreakerOption {
+	return func(b *Breaker) { b.logger = logger }
+}
+
+// BreakerGauge sets a gauge reporting the numeric value of the current state.
+func BreakerGauge(g metrics.Gauge) BreakerOption {
+	return func(b *Breaker) { b.gauge = g }
+}
+
+// NewBreaker returns a closed Breaker. It panics if a count window is smaller
+// than the number of half-open calls.
+func NewBreaker(options ...BreakerOption) *Breaker {
+	b := &Breaker{
+		windowSize:    100,
+		failureRate:   0.5,
+		minimumCalls:  10,
+		openTimeout:   60 * time.Second,
+		halfOpenCalls: 5,
+		isFailure:     func(err error) bool { return err != nil },
+		logger:        log.NewNopLogger(),
+		gauge:         discard.NewGauge(),
+		timeNow:       time.Now,
+	}
+	for _, option := range options {
+		option(b)
+	}
+	if b.windowPeriod <= 0 && b.windowSize < b.halfOpenCalls {
+		panic("circuitbreaker: count window smaller than the number of half-open calls")
+	}
+	b.window = b.newWindow()
+	b.gauge.Set(float64(StateClosed))
+	return b
+}
+
+// NativeBreaker returns an endpoint.Middleware that implements the circuit
+// breaker pattern using a native Breaker. Requests rejected by the breaker
+// fail with ErrCircuitOpen.
+func NativeBreaker(cb *Breaker) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			generation, ok := cb.allow()
+			if !ok {
+				return nil, ErrCircuitOpen
+			}
+
+			defer func(begin time.Time) {
+				cb.record(generation, cb.isFailure(err), cb.timeNow().Sub(begin))
+			}(cb.timeNow())
+
+			response, err = next(ctx, request)
+			return
+		}
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.expire()
+	return b.state
+}
+
+// ForceOpen opens the breaker and keeps it open, rejecting every request,
+// until Reset is called.
+func (b *Breaker) ForceOpen() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.transition(StateOpen, "forced")
+	b.forced = true
+}
+
+// ForceClosed closes the breaker and keeps it closed, letting every request
+// through regardless of its outcome, until Reset is called.
+func (b *Breaker) ForceClosed() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.transition(StateClosed, "forced")
+	b.forced = true
+}
+
+// Reset closes the breaker with an empty window, and resumes normal operation
+// if the state was forced.
+func (b *Breaker) Reset() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.forced = false
+	b.transition(StateClosed, "reset")
+}
+
+// allow reports whether a request may go through, and the generation it
+// belongs to.
+func (b *Breaker) allow() (uint64, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.expire()
+	switch b.state {
+	case StateOpen:
+		return 0, false
+	case StateHalfOpen:
+		if b.trials >= b.halfOpenCalls {
+			return 0, false
+		}
+		b.trials++
+	}
+	return b.generation, true
+}
+
+func (b *Breaker) record(generation uint64, failed bool, d time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if generation != b.generation || b.forced {
+		return // the breaker changed state since the call started
+	}
+
+	slow := b.slowCall > 0 && d > b.slowCall
+	if b.state == StateHalfOpen {
+		b.judgeTrial(failed, slow)
+		return
+	}
+
+	now := b.timeNow()
+	b.window.record(now, failed, slow)
+	total, failures, slows := b.window.counts(now)
+	if total < b.minimumCalls {
+		return
+	}
+	failureRate, slowRate := float64(failures)/float64(total), float64(slows)/float64(total)
+	if b.tripped(failureRate, slowRate) {
+		b.transition(StateOpen, reason(failureRate, b.failureRate))
+	}
+}
+
+// judgeTrial records the outcome of a trial call, and once every trial call
+// has completed, closes the breaker if their rates are below the thresholds,
+// or opens it again otherwise. Trial calls are counted apart from the window,
+// which may not hold all of them. It must be called with the mutex held.
+func (b *Breaker) judgeTrial(failed, slow bool) {
+	b.trial.completed++
+	if failed {
+		b.trial.failures++
+	}
+	if slow {
+		b.trial.slow++
+	}
+	if b.trial.completed < b.halfOpenCalls {
+		return
+	}
+	total := float64(b.trial.completed)
+	failureRate, slowRate := float64(b.trial.failures)/total, float64(b.trial.slow)/total
+	if b.tripped(failureRate, slowRate) {
+		b.transition(StateOpen, reason(failureRate, b.failureRate))
+	} else {
+		b.transition(StateClosed, "trial calls succeeded")
+	}
+}
+
+func (b *Breaker) tripped(failureRate, slowRate float64) bool {
+	return failureRate >= b.failureRate || (b.slowCall > 0 && slowRate >= b.slowRate)
+}
+
+func reason(failureRate, threshold float64) string {
+	if failureRate >= threshold {
+		return "failure rate"
+	}
+	return "slow call rate"
+}
+
+// expire moves an open breaker to half-open once the open timeout has
+// elapsed. It must be called with the mutex held.
+func (b *Breaker) expire() {
+	if b.state == StateOpen && !b.forced && b.timeNow().Sub(b.openedAt) >= b.openTimeout {
+		b.transition(StateHalfOpen, "open timeout elapsed")
+	}
+}
+
+// transition must be called with the mutex held.
+func (b *Breaker) transition(state State, reason string) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.window = b.newWindow()
+	b.trials = 0
+	b.trial.completed, b.trial.failures, b.trial.slow = 0, 0, 0
+	if state == StateOpen {
+		b.openedAt = b.timeNow()
+	}
+	b.gauge.Set(float64(state))
+	b.logger.Log("from", from, "to", state, "reason", reason)
+}
+
+func (b *Breaker) newWindow() window {
+	if b.windowPeriod > 0 {
+		return newTimeWindow(b.windowPeriod)
+	}
+	return newCountWindow(b.windowSize)
+}
+
+// window holds the outcome of recent calls.
+type window interface {
+	record(now time.Time, failed, slow bool)
+	counts(now time.Time) (total, failures, slow int)
+}
+
+type outcome struct {
+	failed, slow bool
+}
+
+// countWindow holds the outcome of the last calls in a ring buffer.
+type countWindow struct {
+	outcomes []outcome
+	next     int
+	failures int
+	slow     int
+}
+
+func newCountWindow(size int) *countWindow {
+	if size <= 0 {
+		size = 1
+	}
+	return &countWindow{outcomes: make([]outcome, 0, size)}
+}
+
+func (w *countWindow) record(_ time.Time, failed, slow bool) {
+	o := outcome{failed, slow}
+	if len(w.outcomes) < cap(w.outcomes) {
+		w.outcomes = append(w.outcomes, o)
+	} else {
+		w.subtract(w.outcomes[w.next])
+		w.outcomes[w.next] = o
+		w.next = (w.next + 1) % len(w.outcomes)
+	}
+	if failed {
+		w.failures++
+	}
+	if slow {
+		w.slow++
+	}
+}
+
+func (w *countWindow) subtract(o outcome) {
+	if o.failed {
+		w.failures--
+	}
+	if o.slow {
+		w.slow--
+	}
+}
+
+func (w *countWindow) counts(time.Time) (int, int, int) {
+	return len(w.outcomes), w.failures, w.slow
+}
+
+// timeWindowBuckets is the number of buckets a time window is divided into.
+const timeWindowBuckets = 10
+
+// timeWindow holds the outcome of the calls that completed within a period,
+// aggregated in buckets.
+type timeWindow struct {
+	bucket  time.Duration
+	buckets [timeWindowBuckets]struct {
+		index                  int64
+		total, failures, slows int
+	}
+}
+
+func newTimeWindow(period time.Duration) *timeWindow {
+	bucket := period / timeWindowBuckets
+	if bucket <= 0 {
+		bucket = 1
+	}
+	return &timeWindow{bucket: bucket}
+}
+
+func (w *timeWindow) record(now time.Time, failed, slow bool) {
+	index := now.UnixNano() / int64(w.bucket)
+	b := &w.buckets[index%timeWindowBuckets]
+	if b.index != index {
+		b.index, b.total, b.failures, b.slows = index, 0, 0, 0
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+	if slow {
+		b.slows++
+	}
+}
+
+func (w *timeWindow) counts(now time.Time) (total, failures, slow int) {
+	index := now.UnixNano() / int64(w.bucket)
+	for _, b := range w.buckets {
+		if index-b.index < timeWindowBuckets {
+			total += b.total
+			failures += b.failures
+			slow += b.slows
+		}
+	}
+	return total, failures, slow
+}
@@ -0,0 +1,254 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/circuitbreaker"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics/generic"
+)
+
+func TestNativeBreaker(t *testing.T) {
+	var (
+		breaker = circuitbreaker.NativeBreaker(circuitbreaker.NewBreaker(
+			circuitbreaker.CountWindow(10),
+			circuitbreaker.MinimumCalls(10),
+		))
+		primeWith        = 10
+		shouldPass       = func(n int) bool { return n < 5 } // 5 failures out of 10
+		circuitOpenError = "circuit breaker is open"
+	)
+	testFailingEndpoint(t, breaker, primeWith, shouldPass, 0, circuitOpenError)
+}
+
+func TestNativeBreakerTimeWindow(t *testing.T) {
+	var (
+		breaker = circuitbreaker.NativeBreaker(circuitbreaker.NewBreaker(
+			circuitbreaker.TimeWindow(time.Minute),
+			circuitbreaker.MinimumCalls(4),
+		))
+		primeWith        = 2
+		shouldPass       = func(n int) bool { return n < 2 } // 2 failures out of 4
+		circuitOpenError = "circuit breaker is open"
+	)
+	testFailingEndpoint(t, breaker, primeWith, shouldPass, 0, circuitOpenError)
+}
+
+func TestNativeBreakerHalfOpen(t *testing.T) {
+	var (
+		gauge = generic.NewGauge("state")
+		cb    = circuitbreaker.NewBreaker(
+			circuitbreaker.MinimumCalls(1),
+			circuitbreaker.OpenTimeout(10*time.Millisecond),
+			circuitbreaker.HalfOpenCalls(2),
+			circuitbreaker.BreakerGauge(gauge),
+		)
+		fail error
+		e    = circuitbreaker.NativeBreaker(cb)(func(context.Context, interface{}) (interface{}, error) { return struct{}{}, fail })
+		ctx  = context.Background()
+	)
+
+	fail = errors.New("fail")
+	e(ctx, struct{}{})
+	assertState(t, cb, gauge, circuitbreaker.StateOpen)
+
+	time.Sleep(10 * time.Millisecond)
+	assertState(t, cb, gauge, circuitbreaker.StateHalfOpen)
+
+	// The rates are judged once every trial has completed, so failed trials
+	// open the breaker again.
+	if _, err := e(ctx, struct{}{}); err != fail {
+		t.Fatalf("want %v, have %v", fail, err)
+	}
+	assertState(t, cb, gauge, circuitbreaker.StateHalfOpen)
+	if _, err := e(ctx, struct{}{}); err != fail {
+		t.Fatalf("want %v, have %v", fail, err)
+	}
+	assertState(t, cb, gauge, circuitbreaker.StateOpen)
+
+	// Successful trials close it.
+	time.Sleep(10 * time.Millisecond)
+	fail = nil
+	for i := 0; i < 2; i++ {
+		if _, err := e(ctx, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertState(t, cb, gauge, circuitbreaker.StateClosed)
+}
+
+func TestNativeBreakerHalfOpenFailureRate(t *testing.T) {
+	var (
+		gauge = generic.NewGauge("state")
+		cb    = circuitbreaker.NewBreaker(
+			circuitbreaker.MinimumCalls(1),
+			circuitbreaker.OpenTimeout(time.Millisecond),
+			circuitbreaker.HalfOpenCalls(5),
+			circuitbreaker.BreakerGauge(gauge),
+		)
+		ctx = context.Background()
+	)
+	circuitbreaker.NativeBreaker(cb)(failing)(ctx, struct{}{})
+	time.Sleep(time.Millisecond)
+	assertState(t, cb, gauge, circuitbreaker.StateHalfOpen)
+
+	// 1 failure out of 5 trials is below the failure rate threshold.
+	circuitbreaker.NativeBreaker(cb)(failing)(ctx, struct{}{})
+	assertState(t, cb, gauge, circuitbreaker.StateHalfOpen)
+	for i := 0; i < 4; i++ {
+		if _, err := circuitbreaker.NativeBreaker(cb)(endpoint.Nop)(ctx, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertState(t, cb, gauge, circuitbreaker.StateClosed)
+}
+
+func TestNativeBreakerHalfOpenTimeWindow(t *testing.T) {
+	var (
+		gauge = generic.NewGauge("state")
+		cb    = circuitbreaker.NewBreaker(
+			circuitbreaker.TimeWindow(20*time.Millisecond),
+			circuitbreaker.MinimumCalls(1),
+			circuitbreaker.OpenTimeout(time.Millisecond),
+			circuitbreaker.HalfOpenCalls(2),
+			circuitbreaker.BreakerGauge(gauge),
+		)
+		ctx = context.Background()
+	)
+	circuitbreaker.NativeBreaker(cb)(failing)(ctx, struct{}{})
+	time.Sleep(time.Millisecond)
+	assertState(t, cb, gauge, circuitbreaker.StateHalfOpen)
+
+	// Trials are judged even when the first ones fell out of the window.
+	if _, err := circuitbreaker.NativeBreaker(cb)(endpoint.Nop)(ctx, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := circuitbreaker.NativeBreaker(cb)(endpoint.Nop)(ctx, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, cb, gauge, circuitbreaker.StateClosed)
+}
+
+func TestNewBreakerWindowTooSmall(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic for a count window smaller than the half-open calls")
+		}
+	}()
+	circuitbreaker.NewBreaker(circuitbreaker.CountWindow(3))
+}
+
+func TestNativeBreakerHalfOpenLimitsTrials(t *testing.T) {
+	var (
+		cb = circuitbreaker.NewBreaker(
+			circuitbreaker.MinimumCalls(1),
+			circuitbreaker.OpenTimeout(time.Millisecond),
+			circuitbreaker.HalfOpenCalls(1),
+		)
+		started = make(chan struct{})
+		block   = make(chan struct{})
+		e       = circuitbreaker.NativeBreaker(cb)(func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-block
+			return struct{}{}, nil
+		})
+	)
+	circuitbreaker.NativeBreaker(cb)(failing)(context.Background(), struct{}{})
+	time.Sleep(time.Millisecond)
+
+	done := make(chan struct{})
+	go func() { e(context.Background(), struct{}{}); close(done) }()
+	<-started
+
+	// The single trial is in flight, so other requests are rejected.
+	if _, err := circuitbreaker.NativeBreaker(cb)(endpoint.Nop)(context.Background(), struct{}{}); err != circuitbreaker.ErrCircuitOpen {
+		t.Errorf("want %v, have %v", circuitbreaker.ErrCircuitOpen, err)
+	}
+
+	close(block)
+	<-done
+	if want, have := circuitbreaker.StateClosed, cb.State(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestNativeBreakerSlowCalls(t *testing.T) {
+	var (
+		cb = circuitbreaker.NewBreaker(
+			circuitbreaker.MinimumCalls(2),
+			circuitbreaker.SlowCallThreshold(time.Millisecond, 1),
+		)
+		e = circuitbreaker.NativeBreaker(cb)(func(context.Context, interface{}) (interface{}, error) {
+			time.Sleep(2 * time.Millisecond)
+			return struct{}{}, nil
+		})
+	)
+	e(context.Background(), struct{}{})
+	if want, have := circuitbreaker.StateClosed, cb.State(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	e(context.Background(), struct{}{})
+	if want, have := circuitbreaker.StateOpen, cb.State(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestNativeBreakerFailurePredicate(t *testing.T) {
+	var (
+		businessErr = errors.New("not found")
+		cb          = circuitbreaker.NewBreaker(
+			circuitbreaker.MinimumCalls(1),
+			circuitbreaker.BreakerFailure(func(err error) bool { return err != nil && err != businessErr }),
+		)
+		e = circuitbreaker.NativeBreaker(cb)(func(context.Context, interface{}) (interface{}, error) { return nil, businessErr })
+	)
+	for i := 0; i < 10; i++ {
+		if _, err := e(context.Background(), struct{}{}); err != businessErr {
+			t.Fatalf("want %v, have %v", businessErr, err)
+		}
+	}
+}
+
+func TestNativeBreakerForce(t *testing.T) {
+	var (
+		cb = circuitbreaker.NewBreaker(circuitbreaker.MinimumCalls(1))
+		e  = circuitbreaker.NativeBreaker(cb)
+	)
+
+	cb.ForceOpen()
+	if _, err := e(endpoint.Nop)(context.Background(), struct{}{}); err != circuitbreaker.ErrCircuitOpen {
+		t.Errorf("want %v, have %v", circuitbreaker.ErrCircuitOpen, err)
+	}
+
+	cb.ForceClosed()
+	for i := 0; i < 10; i++ {
+		e(failing)(context.Background(), struct{}{})
+	}
+	if want, have := circuitbreaker.StateClosed, cb.State(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	cb.Reset()
+	e(failing)(context.Background(), struct{}{})
+	if want, have := circuitbreaker.StateOpen, cb.State(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func failing(context.Context, interface{}) (interface{}, error) {
+	return nil, errors.New("fail")
+}
+
+func assertState(t *testing.T, cb *circuitbreaker.Breaker, gauge *generic.Gauge, want circuitbreaker.State) {
+	t.Helper()
+	if have := cb.State(); want != have {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+	if want, have := float64(want), gauge.Value(); want != have {
+		t.Fatalf("gauge: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,50 @@
+package endpoint
+
+import (
+	"context"
+)
+
+// Stream is a sequence of messages exchanged with a StreamEndpoint. The
+// endpoint reads requests with Recv, which returns io.EOF once there are no
+// more, and writes responses with Send.
+type Stream interface {
+	Send(response interface{}) error
+	Recv() (request interface{}, err error)
+}
+
+// StreamEndpoint is the streaming counterpart of Endpoint. It represents a
+// single streaming RPC method, be it client-streaming, server-streaming or
+// bidirectional. The call ends when the endpoint returns.
+type StreamEndpoint func(ctx context.Context, stream Stream) error
+
+// StreamMiddleware is a chainable behavior modifier for stream endpoints.
+type StreamMiddleware func(StreamEndpoint) StreamEndpoint
+
+// StreamChain is a helper function for composing stream middlewares. Calls
+// will traverse them in the order they're declared. That is, the first
+// middleware is treated as the outermost middleware.
+func StreamChain(outer StreamMiddleware, others ...StreamMiddleware) StreamMiddleware {
+	return func(next StreamEndpoint) StreamEndpoint {
+		for i := len(others) - 1; i >= 0; i-- { // reverse
+			next = others[i](next)
+		}
+		return outer(next)
+	}
+}
+
+// Streaming adapts a Middleware to stream endpoints. The middleware wraps the
+// call as a whole: it's given the Stream as the request, and the error the
+// stream endpoint returns, with a nil response. This suits middlewares that
+// only depend on the context and the outcome of the call, e.g. authentication,
+// tracing, circuit breakers or rate limiters.
+func Streaming(m Middleware) StreamMiddleware {
+	return func(next StreamEndpoint) StreamEndpoint {
+		e := m(func(ctx context.Context, request interface{}) (interface{}, error) {
+			return nil, next(ctx, request.(Stream))
+		})
+		return func(ctx context.Context, stream Stream) error {
+			_, err := e(ctx, stream)
+			return err
+		}
+	}
+}
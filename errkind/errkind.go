@@ -0,0 +1,211 @@
+// Package errkind provides a taxonomy of error kinds shared by all transports,
+// so that a business error renders consistently as an HTTP status, a gRPC
+// code or a problem details body. Errors are classified with Is and Of,
+// through the chain of wrapped errors:
+//
+//	var ErrNotFound = errkind.New(errkind.NotFound, "profile not found")
+//
+//	return errkind.Wrap(errkind.Unavailable, err)
+//
+//	if errkind.Is(err, errkind.NotFound) { ... }
+//
+// Is matches the errors of other packages implementing ErrorKinder as well.
+// errors.Is(err, errkind.NotFound) only matches the errors of this package,
+// and the kinds themselves, in the chain.
+package errkind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kind is the class of an error, which transports map to their own status
+// codes. Kind implements error, so that kinds are sentinel errors, matched by
+// errors.Is against the errors of that kind created by this package.
+type Kind int
+
+// The kinds of errors, with their HTTP status and gRPC code.
+const (
+	Unknown            Kind = iota // 500 Internal Server Error, UNKNOWN
+	Invalid                        // 400 Bad Request, INVALID_ARGUMENT
+	FailedPrecondition             // 400 Bad Request, FAILED_PRECONDITION
+	Unauthenticated                // 401 Unauthorized, UNAUTHENTICATED
+	PermissionDenied               // 403 Forbidden, PERMISSION_DENIED
+	NotFound                       // 404 Not Found, NOT_FOUND
+	AlreadyExists                  // 409 Conflict, ALREADY_EXISTS
+	Conflict                       // 409 Conflict, ABORTED
+	ResourceExhausted              // 429 Too Many Requests, RESOURCE_EXHAUSTED
+	Canceled                       // 499 Client Closed Request, CANCELLED
+	Internal                       // 500 Internal Server Error, INTERNAL
+	Unimplemented                  // 501 Not Implemented, UNIMPLEMENTED
+	Unavailable                    // 503 Service Unavailable, UNAVAILABLE
+	DeadlineExceeded               // 504 Gateway Timeout, DEADLINE_EXCEEDED
+)
+
+var kinds = []struct {
+	name   string
+	status int
+	code   codes.Code
+}{
+	Unknown:            {"unknown", http.StatusInternalServerError, codes.Unknown},
+	Invalid:            {"invalid", http.StatusBadRequest, codes.InvalidArgument},
+	FailedPrecondition: {"failed_precondition", http.StatusBadRequest, codes.FailedPrecondition},
+	Unauthenticated:    {"unauthenticated", http.StatusUnauthorized, codes.Unauthenticated},
+	PermissionDenied:   {"permission_denied", http.StatusForbidden, codes.PermissionDenied},
+	NotFound:           {"not_found", http.StatusNotFound, codes.NotFound},
+	AlreadyExists:      {"already_exists", http.StatusConflict, codes.AlreadyExists},
+	Conflict:           {"conflict", http.StatusConflict, codes.Aborted},
+	ResourceExhausted:  {"resource_exhausted", http.StatusTooManyRequests, codes.ResourceExhausted},
+	Canceled:           {"canceled", 499, codes.Canceled},
+	Internal:           {"internal", http.StatusInternalServerError, codes.Internal},
+	Unimplemented:      {"unimplemented", http.StatusNotImplemented, codes.Unimplemented},
+	Unavailable:        {"unavailable", http.StatusServiceUnavailable, codes.Unavailable},
+	DeadlineExceeded:   {"deadline_exceeded", http.StatusGatewayTimeout, codes.DeadlineExceeded},
+}
+
+func (k Kind) valid() bool {
+	return k >= 0 && int(k) < len(kinds)
+}
+
+// String returns the snake_case name of the kind, e.g. "not_found".
+func (k Kind) String() string {
+	if !k.valid() {
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+	return kinds[k].name
+}
+
+// Error implements error.
+func (k Kind) Error() string {
+	return k.String()
+}
+
+// HTTPStatus returns the HTTP status code of the kind.
+func (k Kind) HTTPStatus() int {
+	if !k.valid() {
+		return http.StatusInternalServerError
+	}
+	return kinds[k].status
+}
+
+// GRPCCode returns the gRPC status code of the kind.
+func (k Kind) GRPCCode() codes.Code {
+	if !k.valid() {
+		return codes.Unknown
+	}
+	return kinds[k].code
+}
+
+// ErrorKinder is implemented by errors that know their kind. It lets error
+// types of other packages take part in the taxonomy.
+type ErrorKinder interface {
+	ErrorKind() Kind
+}
+
+// Error is an error of a kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+// New returns an error of the kind with the message.
+func New(kind Kind, message string) error {
+	return &Error{Kind: kind, Err: errors.New(message)}
+}
+
+// Errorf returns an error of the kind with the formatted message. As with
+// fmt.Errorf, the %w verb wraps an error.
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap returns err as an error of the kind, or nil if err is nil.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e.
+func (e *Error) Is(target error) bool {
+	k, ok := target.(Kind)
+	return ok && k == e.Kind
+}
+
+// ErrorKind implements ErrorKinder.
+func (e *Error) ErrorKind() Kind {
+	return e.Kind
+}
+
+// Is reports whether err is of the kind: whether an error in its chain is the
+// kind, or implements ErrorKinder with the kind, or otherwise whether Of
+// classifies err as the kind.
+func Is(err error, kind Kind) bool {
+	if err == nil {
+		return false
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch x := e.(type) {
+		case Kind:
+			if x == kind {
+				return true
+			}
+		case ErrorKinder:
+			if x.ErrorKind() == kind {
+				return true
+			}
+		}
+	}
+	return Of(err) == kind
+}
+
+// Of returns the kind of err: the kind of the first error in its chain that
+// is a Kind or implements ErrorKinder. Otherwise, context cancelation and
+// deadline errors are Canceled and DeadlineExceeded, and errors carrying a
+// gRPC status, e.g. returned by gRPC clients, are of the kind of their code.
+// Other errors are Unknown.
+func Of(err error) Kind {
+	if err == nil {
+		return Unknown
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch x := e.(type) {
+		case Kind:
+			return x
+		case ErrorKinder:
+			return x.ErrorKind()
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) && grpcErr.GRPCStatus() != nil {
+		st := grpcErr.GRPCStatus()
+		for k := range kinds {
+			if kinds[k].code == st.Code() {
+				return Kind(k)
+			}
+		}
+	}
+	return Unknown
+}
@@ -0,0 +1,157 @@
+package errkind_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+func TestKinds(t *testing.T) {
+	errNotFound := errkind.New(errkind.NotFound, "profile not found")
+	wrapped := fmt.Errorf("get profile: %w", errNotFound)
+
+	if !errors.Is(wrapped, errkind.NotFound) {
+		t.Error("want wrapped error to be NotFound")
+	}
+	if errors.Is(wrapped, errkind.Invalid) {
+		t.Error("want wrapped error not to be Invalid")
+	}
+	if !errors.Is(wrapped, errNotFound) {
+		t.Error("want wrapped error to be the sentinel")
+	}
+	var e *errkind.Error
+	if !errors.As(wrapped, &e) || e.Kind != errkind.NotFound {
+		t.Errorf("want *errkind.Error of kind NotFound, have %v", e)
+	}
+	if want, have := "get profile: profile not found", wrapped.Error(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if errkind.Wrap(errkind.Internal, nil) != nil {
+		t.Error("want Wrap(nil) to be nil")
+	}
+
+	for _, tc := range []struct {
+		err  error
+		want errkind.Kind
+	}{
+		{wrapped, errkind.NotFound},
+		{fmt.Errorf("oops: %w", errkind.Unavailable), errkind.Unavailable},
+		{errkind.Errorf(errkind.Conflict, "version %d: %w", 2, context.Canceled), errkind.Conflict},
+		{fmt.Errorf("call: %w", context.Canceled), errkind.Canceled},
+		{context.DeadlineExceeded, errkind.DeadlineExceeded},
+		{status.Error(codes.PermissionDenied, "no"), errkind.PermissionDenied},
+		{kinder{}, errkind.ResourceExhausted},
+		{errors.New("oops"), errkind.Unknown},
+	} {
+		if want, have := tc.want, errkind.Of(tc.err); want != have {
+			t.Errorf("%v: want %v, have %v", tc.err, want, have)
+		}
+	}
+
+	// Is matches ErrorKinders of other packages as well as errors.As would.
+	for _, tc := range []struct {
+		err  error
+		kind errkind.Kind
+		want bool
+	}{
+		{wrapped, errkind.NotFound, true},
+		{fmt.Errorf("limit: %w", kinder{}), errkind.ResourceExhausted, true},
+		{fmt.Errorf("limit: %w", kinder{}), errkind.Unavailable, false},
+		{errkind.Wrap(errkind.Unavailable, kinder{}), errkind.ResourceExhausted, true},
+		{fmt.Errorf("call: %w", status.Error(codes.NotFound, "no")), errkind.NotFound, true},
+		{context.Canceled, errkind.Canceled, true},
+		{errors.New("oops"), errkind.Internal, false},
+		{nil, errkind.Unknown, false},
+	} {
+		if want, have := tc.want, errkind.Is(tc.err, tc.kind); want != have {
+			t.Errorf("Is(%v, %v): want %v, have %v", tc.err, tc.kind, want, have)
+		}
+	}
+
+	if want, have := http.StatusNotFound, errkind.NotFound.HTTPStatus(); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := codes.AlreadyExists, errkind.AlreadyExists.GRPCCode(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+type kinder struct{}
+
+func (kinder) Error() string                { return "slow down" }
+func (kinder) ErrorKind() errkind.Kind      { return errkind.ResourceExhausted }
+func (kinder) StatusCode() int              { return http.StatusServiceUnavailable }
+func (kinder) MarshalJSON() ([]byte, error) { return []byte(`{"retry_after":10}`), nil }
+
+func TestProblem(t *testing.T) {
+	p := errkind.ProblemOf(errkind.Wrap(errkind.NotFound, errors.New("no such profile")))
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"detail":"no such profile","kind":"not_found","status":404,"title":"Not Found","type":"about:blank"}`, string(b); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	// StatusCoder and json.Marshaler errors shape the problem.
+	b, err = json.Marshal(errkind.ProblemOf(kinder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"detail":"slow down","kind":"resource_exhausted","retry_after":10,"status":503,"title":"Service Unavailable","type":"about:blank"}`, string(b); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	// So do the errors they're wrapped in.
+	wb, err := json.Marshal(errkind.ProblemOf(fmt.Errorf("limit: %w", kinder{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"detail":"limit: slow down","kind":"resource_exhausted","retry_after":10,"status":503,"title":"Service Unavailable","type":"about:blank"}`, string(wb); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	// Decoded problems are errors of their kind.
+	var decoded errkind.Problem
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := errkind.ResourceExhausted, errkind.Of(&decoded); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := "slow down", decoded.Error(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := `10`, string(decoded.Extensions["retry_after"]); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+type detailer struct{ error }
+
+func (detailer) ProblemDetail() string { return "try again later" }
+
+func TestProblemDetail(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{errkind.New(errkind.Invalid, "bad name"), "bad name"},
+		{errors.New("dial tcp 10.0.0.1:5432: connection refused"), ""},
+		{errkind.Wrap(errkind.Internal, errors.New("pq: syntax error")), ""},
+		{errkind.Wrap(errkind.Unavailable, detailer{errors.New("pool exhausted")}), "try again later"},
+		{&errkind.Problem{Kind: errkind.Internal, Detail: "upstream"}, "upstream"},
+	} {
+		if want, have := tc.want, errkind.ProblemOf(tc.err).Detail; want != have {
+			t.Errorf("%v: want detail %q, have %q", tc.err, want, have)
+		}
+	}
+}
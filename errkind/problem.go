@@ -0,0 +1,157 @@
+package errkind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ProblemContentType is the media type of problem details documents.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 problem details object of an error, which the
+// transports' problem error encoders send as the body of error responses.
+type Problem struct {
+	Type   string
+	Title  string
+	Status int
+	Detail string
+	Kind   Kind
+
+	// Extensions are the additional members of the object. They're the
+	// members of the JSON object errors implementing json.Marshaler marshal
+	// to, which may override the standard members.
+	Extensions map[string]json.RawMessage
+}
+
+// ProblemDetailer is implemented by errors that set the detail of their
+// problem, e.g. to explain server errors without leaking internals.
+type ProblemDetailer interface {
+	ProblemDetail() string
+}
+
+// ProblemOf returns the problem details of err. The status is the one of the
+// StatusCode method of the first error in its chain that has one, as the http
+// transport's StatusCoder, and the HTTP status of its kind otherwise. The
+// extensions are the members of the first error in its chain implementing
+// json.Marshaler, if any. The detail is the one of the first error in its
+// chain implementing ProblemDetailer, if any. Otherwise, it's the error
+// message for the kinds of client errors, with a 4xx HTTP status, and empty
+// for the others, e.g. Unknown and Internal, whose messages may reveal
+// internals.
+func ProblemOf(err error) *Problem {
+	kind := Of(err)
+	p := &Problem{
+		Type:   "about:blank",
+		Status: kind.HTTPStatus(),
+		Kind:   kind,
+	}
+	var detailer ProblemDetailer
+	switch {
+	case errors.As(err, &detailer):
+		p.Detail = detailer.ProblemDetail()
+	case kind.HTTPStatus() < 500:
+		p.Detail = err.Error()
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		p.Status = sc.StatusCode()
+	}
+	p.Title = http.StatusText(p.Status)
+	var marshaler json.Marshaler
+	if errors.As(err, &marshaler) {
+		if b, marshalErr := marshaler.MarshalJSON(); marshalErr == nil {
+			var members map[string]json.RawMessage
+			if json.Unmarshal(b, &members) == nil {
+				p.Extensions = members
+			}
+		}
+	}
+	return p
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := map[string]interface{}{
+		"type":   p.Type,
+		"title":  p.Title,
+		"status": p.Status,
+		"kind":   p.Kind.String(),
+	}
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(members); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, so that clients can decode the
+// problem details of error responses.
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for name, dst := range map[string]interface{}{
+		"type": &p.Type, "title": &p.Title, "status": &p.Status, "detail": &p.Detail,
+	} {
+		if raw, ok := members[name]; ok {
+			if err := json.Unmarshal(raw, dst); err != nil {
+				return err
+			}
+			delete(members, name)
+		}
+	}
+	p.Kind = Unknown
+	if raw, ok := members["kind"]; ok {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return err
+		}
+		for k := range kinds {
+			if kinds[k].name == name {
+				p.Kind = Kind(k)
+			}
+		}
+		delete(members, "kind")
+	}
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return nil
+}
+
+// Error implements error, so that decoded problems can be returned as errors
+// of their kind.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// ProblemDetail implements ProblemDetailer, so that decoded problems keep
+// their detail when they're encoded again.
+func (p *Problem) ProblemDetail() string {
+	return p.Detail
+}
+
+// ErrorKind implements ErrorKinder.
+func (p *Problem) ErrorKind() Kind {
+	return p.Kind
+}
+
+// StatusCode returns the HTTP status of the problem.
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
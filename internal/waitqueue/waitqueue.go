@@ -0,0 +1,80 @@
+// Package waitqueue provides the first-in, first-out queue of requests
+// waiting for a slot of the concurrency limiters of package ratelimit and
+// bulkhead.
+package waitqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned by Wait when the timeout expires before the waiter
+// is granted a slot.
+var ErrTimeout = errors.New("timed out waiting for a slot")
+
+// Queue is a first-in, first-out queue of waiters. It's guarded by the lock
+// of the limiter owning the slots, which must be held when calling its
+// methods.
+type Queue struct {
+	mtx     sync.Locker
+	waiters []chan struct{} // closed when granted a slot
+}
+
+// New returns an empty queue guarded by mtx.
+func New(mtx sync.Locker) *Queue {
+	return &Queue{mtx: mtx}
+}
+
+// Len returns the number of waiters.
+func (q *Queue) Len() int {
+	return len(q.waiters)
+}
+
+// Wait queues the caller, and releases the lock until the caller is granted
+// a slot, the timeout expires, or the context is done. It returns with the
+// lock held: nil if the caller was granted a slot, and ErrTimeout or the
+// context's error otherwise. A caller granted a slot while giving up keeps
+// it, since its slot was handed over.
+func (q *Queue) Wait(ctx context.Context, timeout time.Duration) error {
+	granted := make(chan struct{})
+	q.waiters = append(q.waiters, granted)
+	q.mtx.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-granted:
+	case <-timer.C:
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mtx.Lock()
+	if err == nil {
+		return nil
+	}
+	for i, ch := range q.waiters {
+		if ch == granted {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return err
+		}
+	}
+	// Granted a slot while giving up, so use it.
+	return nil
+}
+
+// Grant hands a slot over to the first waiter, and reports whether there was
+// one.
+func (q *Queue) Grant() bool {
+	if len(q.waiters) == 0 {
+		return false
+	}
+	close(q.waiters[0])
+	q.waiters = q.waiters[1:]
+	return true
+}
@@ -0,0 +1,72 @@
+package waitqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueOrder(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		q     = New(&mtx)
+		order = make(chan int, 3)
+	)
+	for i := 0; i < cap(order); i++ {
+		mtx.Lock()
+		go func(i int) {
+			defer mtx.Unlock()
+			if err := q.Wait(context.Background(), time.Minute); err != nil {
+				t.Error(err)
+			}
+			order <- i
+		}(i)
+		// Wait until queued.
+		for {
+			mtx.Lock()
+			n := q.Len()
+			mtx.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < cap(order); i++ {
+		mtx.Lock()
+		if !q.Grant() {
+			t.Fatal("want a waiter to be granted a slot")
+		}
+		mtx.Unlock()
+		if want, have := i, <-order; want != have {
+			t.Errorf("want waiter %d, have %d", want, have)
+		}
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if q.Grant() {
+		t.Error("want no waiter left")
+	}
+}
+
+func TestQueueGiveUp(t *testing.T) {
+	var (
+		mtx sync.Mutex
+		q   = New(&mtx)
+	)
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := ErrTimeout, q.Wait(context.Background(), time.Millisecond); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if want, have := context.Canceled, q.Wait(ctx, time.Minute); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 0, q.Len(); want != have {
+		t.Errorf("want %d waiters, have %d", want, have)
+	}
+}
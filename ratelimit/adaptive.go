@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/internal/waitqueue"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// LimitAlgorithm computes the concurrency limit of an adaptive limiter. Update
+// is called whenever a request completes, with the current limit, the number
+// of requests that were in flight when it started, its latency, and whether
+// it was dropped, e.g. because it timed out. It returns the new limit. Update
+// is called with the limiter's lock held, so implementations needn't be safe
+// for concurrent use.
+type LimitAlgorithm interface {
+	Update(limit, inflight int, latency time.Duration, dropped bool) int
+}
+
+// AIMD returns a LimitAlgorithm that implements additive increase,
+// multiplicative decrease. The limit grows by one for every successful request
+// that completed within timeout while at least half of the limit was in use,
+// and is multiplied by backoff, e.g. 0.9, for every dropped or slower request.
+func AIMD(backoff float64, timeout time.Duration) LimitAlgorithm {
+	return &aimd{backoff: backoff, timeout: timeout}
+}
+
+type aimd struct {
+	backoff float64
+	timeout time.Duration
+}
+
+func (a *aimd) Update(limit, inflight int, latency time.Duration, dropped bool) int {
+	if dropped || (a.timeout > 0 && latency > a.timeout) {
+		return int(float64(limit) * a.backoff)
+	}
+	if inflight*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// Vegas returns a LimitAlgorithm modeled after TCP Vegas. It tracks the
+// lowest latency observed, which approximates the latency without queueing,
+// and estimates the number of queued requests from how much slower each
+// request was. The limit grows while the estimated queue is short, and shrinks
+// when it's long or a request was dropped.
+func Vegas() LimitAlgorithm {
+	return &vegas{}
+}
+
+type vegas struct {
+	noLoad time.Duration
+}
+
+func (v *vegas) Update(limit, inflight int, latency time.Duration, dropped bool) int {
+	if latency <= 0 {
+		return limit
+	}
+	if v.noLoad == 0 || latency < v.noLoad {
+		v.noLoad = latency
+	}
+
+	step := int(math.Max(1, math.Log10(float64(limit))))
+	if dropped {
+		return limit - step
+	}
+	if inflight*2 < limit {
+		return limit // not enough load to learn anything
+	}
+
+	var (
+		queue = int(math.Ceil(float64(limit) * (1 - float64(v.noLoad)/float64(latency))))
+		alpha = 3 * step
+		beta  = 6 * step
+	)
+	switch {
+	case queue <= step:
+		return limit + beta
+	case queue < alpha:
+		return limit + step
+	case queue > beta:
+		return limit - step
+	default:
+		return limit
+	}
+}
+
+// AdaptiveOption sets an optional parameter for adaptive limiters.
+type AdaptiveOption func(*adaptiveLimiter)
+
+// InitialLimit sets the concurrency limit before any request has completed.
+// By default, it's 20.
+func InitialLimit(n int) AdaptiveOption {
+	return func(l *adaptiveLimiter) { l.limit = n }
+}
+
+// LimitBounds sets the range within which the concurrency limit is kept. By
+// default, the limit is between 1 and 1000.
+func LimitBounds(min, max int) AdaptiveOption {
+	return func(l *adaptiveLimiter) { l.min, l.max = min, max }
+}
+
+// LimitQueue makes requests that exceed the limit wait for a free slot, in
+// order, instead of being rejected right away. At most size requests wait at
+// once, each for at most timeout. Requests that can't be queued or that wait
+// too long are rejected with ErrLimited.
+func LimitQueue(size int, timeout time.Duration) AdaptiveOption {
+	return func(l *adaptiveLimiter) { l.queueSize, l.queueTimeout = size, timeout }
+}
+
+// LimitGauge sets a gauge that reports the current concurrency limit.
+func LimitGauge(g metrics.Gauge) AdaptiveOption {
+	return func(l *adaptiveLimiter) { l.gauge = g }
+}
+
+// LimitDropped sets the predicate deciding whether the error returned by a
+// request means it was dropped. By default, requests that failed because
+// their context deadline was exceeded are considered dropped.
+func LimitDropped(dropped func(error) bool) AdaptiveOption {
+	return func(l *adaptiveLimiter) { l.dropped = dropped }
+}
+
+// NewAdaptiveLimiter returns an endpoint.Middleware that limits the number of
+// requests in flight. The limit is continuously adjusted by algorithm based on
+// the observed latencies, so that it tracks the capacity of the wrapped
+// endpoint. Requests that would exceed the limit are rejected with ErrLimited,
+// unless a queue is configured with LimitQueue.
+func NewAdaptiveLimiter(algorithm LimitAlgorithm, options ...AdaptiveOption) endpoint.Middleware {
+	l := &adaptiveLimiter{
+		algorithm: algorithm,
+		limit:     20,
+		min:       1,
+		max:       1000,
+		gauge:     discard.NewGauge(),
+		dropped:   func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+	}
+	for _, option := range options {
+		option(l)
+	}
+	l.limit = l.clamp(l.limit)
+	l.queue = waitqueue.New(&l.mtx)
+	l.gauge.Set(float64(l.limit))
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			inflight, err := l.acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+			begin := time.Now()
+			response, err := next(ctx, request)
+			l.release(inflight, time.Since(begin), l.dropped(err))
+			return response, err
+		}
+	}
+}
+
+type adaptiveLimiter struct {
+	algorithm    LimitAlgorithm
+	min, max     int
+	queueSize    int
+	queueTimeout time.Duration
+	gauge        metrics.Gauge
+	dropped      func(error) bool
+
+	mtx      sync.Mutex
+	limit    int
+	inflight int
+	queue    *waitqueue.Queue
+}
+
+// acquire waits for a slot and returns the number of requests in flight,
+// including this one.
+func (l *adaptiveLimiter) acquire(ctx context.Context) (int, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.inflight < l.limit {
+		l.inflight++
+		return l.inflight, nil
+	}
+	if l.queue.Len() >= l.queueSize || l.queueTimeout <= 0 {
+		return 0, ErrLimited
+	}
+	switch err := l.queue.Wait(ctx, l.queueTimeout); err {
+	case nil:
+		return l.inflight, nil
+	case waitqueue.ErrTimeout:
+		return 0, ErrLimited
+	default:
+		return 0, err
+	}
+}
+
+func (l *adaptiveLimiter) release(inflight int, latency time.Duration, dropped bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.inflight--
+	if limit := l.clamp(l.algorithm.Update(l.limit, inflight, latency, dropped)); limit != l.limit {
+		l.limit = limit
+		l.gauge.Set(float64(limit))
+	}
+
+	// Hand free slots over to queued requests.
+	for l.inflight < l.limit && l.queue.Grant() {
+		l.inflight++
+	}
+}
+
+func (l *adaptiveLimiter) clamp(limit int) int {
+	if limit < l.min {
+		return l.min
+	}
+	if limit > l.max {
+		return l.max
+	}
+	return limit
+}
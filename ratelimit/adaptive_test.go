@@ -0,0 +1,152 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/go-kit/kit/ratelimit"
+)
+
+func TestAdaptiveLimiterRejects(t *testing.T) {
+	var (
+		block   = make(chan struct{})
+		started = make(chan struct{})
+		e       = func(context.Context, interface{}) (interface{}, error) { started <- struct{}{}; <-block; return struct{}{}, nil }
+		limited = ratelimit.NewAdaptiveLimiter(fixedLimit{}, ratelimit.InitialLimit(2))(e)
+		errs    = make(chan error, 2)
+	)
+	for i := 0; i < 2; i++ {
+		go func() { _, err := limited(context.Background(), struct{}{}); errs <- err }()
+		<-started
+	}
+
+	if _, err := limited(context.Background(), struct{}{}); err != ratelimit.ErrLimited {
+		t.Errorf("want %v, have %v", ratelimit.ErrLimited, err)
+	}
+
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestAdaptiveLimiterQueue(t *testing.T) {
+	var (
+		block   = make(chan struct{})
+		started = make(chan struct{}, 2)
+		e       = func(context.Context, interface{}) (interface{}, error) { started <- struct{}{}; <-block; return struct{}{}, nil }
+		limited = ratelimit.NewAdaptiveLimiter(fixedLimit{},
+			ratelimit.InitialLimit(1),
+			ratelimit.LimitQueue(1, time.Second),
+		)(e)
+		errs = make(chan error, 2)
+	)
+	go func() { _, err := limited(context.Background(), struct{}{}); errs <- err }()
+	<-started
+	go func() { _, err := limited(context.Background(), struct{}{}); errs <- err }()
+	time.Sleep(10 * time.Millisecond) // let it queue
+
+	// The queue is full.
+	if _, err := limited(context.Background(), struct{}{}); err != ratelimit.ErrLimited {
+		t.Errorf("want %v, have %v", ratelimit.ErrLimited, err)
+	}
+
+	// Completing the first request lets the queued one through.
+	block <- struct{}{}
+	<-started
+	block <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestAdaptiveLimiterQueueTimeout(t *testing.T) {
+	var (
+		block   = make(chan struct{})
+		started = make(chan struct{})
+		e       = func(context.Context, interface{}) (interface{}, error) { started <- struct{}{}; <-block; return struct{}{}, nil }
+		limited = ratelimit.NewAdaptiveLimiter(fixedLimit{},
+			ratelimit.InitialLimit(1),
+			ratelimit.LimitQueue(1, 10*time.Millisecond),
+		)(e)
+	)
+	defer close(block)
+	go limited(context.Background(), struct{}{})
+	<-started
+
+	if _, err := limited(context.Background(), struct{}{}); err != ratelimit.ErrLimited {
+		t.Errorf("want %v, have %v", ratelimit.ErrLimited, err)
+	}
+}
+
+func TestAdaptiveLimiterGauge(t *testing.T) {
+	var (
+		gauge   = generic.NewGauge("limit")
+		e       = func(ctx context.Context, _ interface{}) (interface{}, error) { return nil, context.DeadlineExceeded }
+		limited = ratelimit.NewAdaptiveLimiter(ratelimit.AIMD(0.5, time.Second),
+			ratelimit.InitialLimit(8),
+			ratelimit.LimitGauge(gauge),
+		)(e)
+	)
+	if want, have := 8.0, gauge.Value(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	limited(context.Background(), struct{}{})
+	if want, have := 4.0, gauge.Value(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	aimd := ratelimit.AIMD(0.5, 100*time.Millisecond)
+	for _, tc := range []struct {
+		name     string
+		inflight int
+		latency  time.Duration
+		dropped  bool
+		want     int
+	}{
+		{"busy", 5, time.Millisecond, false, 11},
+		{"idle", 4, time.Millisecond, false, 10},
+		{"slow", 5, time.Second, false, 5},
+		{"dropped", 5, time.Millisecond, true, 5},
+	} {
+		if have := aimd.Update(10, tc.inflight, tc.latency, tc.dropped); tc.want != have {
+			t.Errorf("%s: want %d, have %d", tc.name, tc.want, have)
+		}
+	}
+}
+
+func TestVegas(t *testing.T) {
+	var (
+		vegas = ratelimit.Vegas()
+		limit = 10
+	)
+
+	// Steady latency means no queueing, so the limit grows.
+	for i := 0; i < 10; i++ {
+		limit = vegas.Update(limit, limit, 10*time.Millisecond, false)
+	}
+	if limit <= 10 {
+		t.Fatalf("want limit above 10, have %d", limit)
+	}
+
+	// Latency doubles, so half of the requests are queued and it shrinks.
+	grown := limit
+	for i := 0; i < 10; i++ {
+		limit = vegas.Update(limit, limit, 20*time.Millisecond, false)
+	}
+	if limit >= grown {
+		t.Fatalf("want limit below %d, have %d", grown, limit)
+	}
+}
+
+type fixedLimit struct{}
+
+func (fixedLimit) Update(limit, _ int, _ time.Duration, _ bool) int { return limit }
@@ -0,0 +1,4 @@
+// Package redis provides a ratelimit.Store backed by a server speaking the
+// Redis protocol, so that rate limits are shared by every replica of a
+// service.
+package redis
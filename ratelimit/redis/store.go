@@ -0,0 +1,251 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/ratelimit"
+)
+
+// Store implements ratelimit.Store on top of a Redis server. Compare-and-swap
+// is implemented with an optimistic WATCH/MULTI/EXEC transaction, so any
+// server implementing those commands, along with GET and SET, will do.
+// Connections are pooled.
+type Store struct {
+	dial     func(ctx context.Context) (net.Conn, error)
+	password string
+	timeout  time.Duration
+	pool     chan *conn
+}
+
+var _ ratelimit.Store = (*Store)(nil) // API check
+
+// Option sets an optional parameter for stores.
+type Option func(*Store)
+
+// Dialer sets the function used to open connections. By default, a TCP
+// connection is made to the address given to NewStore.
+func Dialer(dial func(ctx context.Context) (net.Conn, error)) Option {
+	return func(s *Store) { s.dial = dial }
+}
+
+// Password sets the password sent with AUTH on every new connection.
+func Password(password string) Option {
+	return func(s *Store) { s.password = password }
+}
+
+// PoolSize sets the maximum number of idle connections kept open. By default,
+// it's 10.
+func PoolSize(n int) Option {
+	return func(s *Store) { s.pool = make(chan *conn, n) }
+}
+
+// Timeout sets the deadline for every command, unless the context given to
+// the store has an earlier one. By default, it's 1 second.
+func Timeout(d time.Duration) Option {
+	return func(s *Store) { s.timeout = d }
+}
+
+// NewStore returns a Store that connects to the Redis server at addr.
+func NewStore(addr string, options ...Option) *Store {
+	s := &Store{
+		dial: func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", addr)
+		},
+		timeout: time.Second,
+		pool:    make(chan *conn, 10),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Close closes every idle connection.
+func (s *Store) Close() error {
+	for {
+		select {
+		case c := <-s.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Get implements ratelimit.Store.
+func (s *Store) Get(ctx context.Context, key string) (value int64, ok bool, err error) {
+	err = s.do(ctx, func(c *conn) error {
+		value, ok, err = c.get(key)
+		return err
+	})
+	return value, ok, err
+}
+
+// CompareAndSwap implements ratelimit.Store.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old int64, exists bool, value int64, ttl time.Duration) (swapped bool, err error) {
+	err = s.do(ctx, func(c *conn) error {
+		if _, err := c.command("WATCH", key); err != nil {
+			return err
+		}
+		current, ok, err := c.get(key)
+		if err != nil {
+			return err
+		}
+		if ok != exists || (ok && current != old) {
+			_, err := c.command("UNWATCH")
+			return err
+		}
+		if _, err := c.command("MULTI"); err != nil {
+			return err
+		}
+		ms := ttl.Nanoseconds() / int64(time.Millisecond)
+		if ms <= 0 {
+			ms = 1
+		}
+		if _, err := c.command("SET", key, strconv.FormatInt(value, 10), "PX", strconv.FormatInt(ms, 10)); err != nil {
+			return err
+		}
+		reply, err := c.command("EXEC")
+		if err != nil {
+			return err
+		}
+		swapped = reply != nil // a nil reply means the transaction was aborted
+		return nil
+	})
+	return swapped, err
+}
+
+// do runs f on a pooled connection. Connections are discarded after any
+// error, as they may be left in the middle of a transaction.
+func (s *Store) do(ctx context.Context, f func(*conn) error) error {
+	var c *conn
+	select {
+	case c = <-s.pool:
+	default:
+		nc, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		c = newConn(nc)
+		if s.password != "" {
+			if _, err := c.command("AUTH", s.password); err != nil {
+				c.Close()
+				return err
+			}
+		}
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+
+	if err := f(c); err != nil {
+		c.Close()
+		return err
+	}
+
+	select {
+	case s.pool <- c:
+	default:
+		c.Close()
+	}
+	return nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+}
+
+func (c *conn) get(key string) (int64, bool, error) {
+	reply, err := c.command("GET", key)
+	if err != nil || reply == nil {
+		return 0, false, err
+	}
+	b, ok := reply.([]byte)
+	if !ok {
+		return 0, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	value, err := strconv.ParseInt(string(b), 10, 64)
+	return value, err == nil, err
+}
+
+// command sends a command and reads its reply, which is either nil, a string
+// for status replies, an int64, a []byte for bulk strings, or an
+// []interface{} for arrays.
+func (c *conn) command(args ...string) (interface{}, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+}
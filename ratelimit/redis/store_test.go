@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/ratelimit"
+)
+
+func TestStore(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.Close()
+
+	var (
+		store = NewStore(server.Addr())
+		ctx   = context.Background()
+	)
+	defer store.Close()
+
+	if _, ok, err := store.Get(ctx, "k"); err != nil || ok {
+		t.Fatalf("want missing key, have ok=%v err=%v", ok, err)
+	}
+	if swapped, err := store.CompareAndSwap(ctx, "k", 0, true, 1, time.Minute); err != nil || swapped {
+		t.Fatalf("want no swap for missing key, have swapped=%v err=%v", swapped, err)
+	}
+	if swapped, err := store.CompareAndSwap(ctx, "k", 0, false, 1, time.Minute); err != nil || !swapped {
+		t.Fatalf("want swap, have swapped=%v err=%v", swapped, err)
+	}
+	if swapped, err := store.CompareAndSwap(ctx, "k", 2, true, 3, time.Minute); err != nil || swapped {
+		t.Fatalf("want no swap for stale value, have swapped=%v err=%v", swapped, err)
+	}
+	if swapped, err := store.CompareAndSwap(ctx, "k", 1, true, 2, time.Minute); err != nil || !swapped {
+		t.Fatalf("want swap, have swapped=%v err=%v", swapped, err)
+	}
+	if value, ok, err := store.Get(ctx, "k"); err != nil || !ok || value != 2 {
+		t.Fatalf("want 2, have value=%d ok=%v err=%v", value, ok, err)
+	}
+}
+
+func TestStoreSharedLimiter(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.Close()
+
+	var (
+		// Two replicas, each with its own connection pool.
+		limiters = []*ratelimit.SharedLimiter{
+			ratelimit.NewGCRALimiter(NewStore(server.Addr()), "test", 10, time.Hour, 9),
+			ratelimit.NewGCRALimiter(NewStore(server.Addr()), "test", 10, time.Hour, 9),
+		}
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(l *ratelimit.SharedLimiter) {
+			defer wg.Done()
+			if l.Allow() {
+				mtx.Lock()
+				allowed++
+				mtx.Unlock()
+			}
+		}(limiters[i%2])
+	}
+	wg.Wait()
+
+	if want, have := 10, allowed; want != have {
+		t.Errorf("want %d allowed, have %d", want, have)
+	}
+}
+
+// fakeServer speaks just enough of the Redis protocol for Store.
+type fakeServer struct {
+	net.Listener
+	mtx     sync.Mutex
+	values  map[string]string
+	version map[string]int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		Listener: ln,
+		values:   map[string]string{},
+		version:  map[string]int{},
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) Addr() string { return s.Listener.Addr().String() }
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	var (
+		r       = bufio.NewReader(c)
+		watched = map[string]int{}
+		queue   [][]string
+		multi   bool
+	)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range reply.([]interface{}) {
+			args = append(args, string(a.([]byte)))
+		}
+
+		switch cmd := strings.ToUpper(args[0]); {
+		case multi && cmd != "EXEC":
+			queue = append(queue, args)
+			fmt.Fprint(c, "+QUEUED\r\n")
+		case cmd == "WATCH":
+			s.mtx.Lock()
+			watched[args[1]] = s.version[args[1]]
+			s.mtx.Unlock()
+			fmt.Fprint(c, "+OK\r\n")
+		case cmd == "UNWATCH":
+			watched = map[string]int{}
+			fmt.Fprint(c, "+OK\r\n")
+		case cmd == "MULTI":
+			multi = true
+			fmt.Fprint(c, "+OK\r\n")
+		case cmd == "EXEC":
+			s.mtx.Lock()
+			aborted := false
+			for key, version := range watched {
+				if s.version[key] != version {
+					aborted = true
+				}
+			}
+			if aborted {
+				fmt.Fprint(c, "*-1\r\n")
+			} else {
+				fmt.Fprintf(c, "*%d\r\n", len(queue))
+				for _, args := range queue {
+					fmt.Fprint(c, s.exec(args))
+				}
+			}
+			s.mtx.Unlock()
+			watched, queue, multi = map[string]int{}, nil, false
+		default:
+			s.mtx.Lock()
+			fmt.Fprint(c, s.exec(args))
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// exec must be called with the mutex held. Expiry is ignored.
+func (s *fakeServer) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case "SET":
+		s.values[args[1]] = args[2]
+		s.version[args[1]]++
+		return "+OK\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
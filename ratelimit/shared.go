@@ -0,0 +1,316 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Store holds the state of SharedLimiters, so that every replica of a service
+// enforces the same limit. Values are opaque integers. Implementations must be
+// safe for concurrent use.
+type Store interface {
+	// Get returns the value stored under key, and whether it exists.
+	Get(ctx context.Context, key string) (value int64, ok bool, err error)
+
+	// CompareAndSwap stores value under key, to expire after ttl, only if the
+	// current value is still old, or if the key doesn't exist and exists is
+	// false. It reports whether the value was stored.
+	CompareAndSwap(ctx context.Context, key string, old int64, exists bool, value int64, ttl time.Duration) (bool, error)
+}
+
+// NewMemoryStore returns a Store that keeps its state in memory. It's useful
+// for tests, and to share limits between limiters in a single process.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		m:       map[string]memoryValue{},
+		timeNow: time.Now,
+	}
+}
+
+type memoryStore struct {
+	mtx     sync.Mutex
+	m       map[string]memoryValue
+	timeNow func() time.Time
+}
+
+type memoryValue struct {
+	value   int64
+	expires time.Time
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (int64, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	v, ok := s.get(key)
+	return v.value, ok, nil
+}
+
+func (s *memoryStore) CompareAndSwap(_ context.Context, key string, old int64, exists bool, value int64, ttl time.Duration) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	v, ok := s.get(key)
+	if ok != exists || (ok && v.value != old) {
+		return false, nil
+	}
+	s.m[key] = memoryValue{value: value, expires: s.timeNow().Add(ttl)}
+	return true, nil
+}
+
+// get must be called with the mutex held.
+func (s *memoryStore) get(key string) (memoryValue, bool) {
+	v, ok := s.m[key]
+	if ok && !s.timeNow().Before(v.expires) {
+		delete(s.m, key)
+		return memoryValue{}, false
+	}
+	return v, ok
+}
+
+// SharedLimiter is a rate limiter whose state lives in a Store, so that the
+// limit applies across every process sharing the store. It implements both
+// Allower and Waiter for a single key, and can limit requests per key, e.g.
+// per tenant or API key, with NewKeyedErroringLimiter and
+// NewKeyedDelayingLimiter.
+//
+// Replicas rely on their local clocks, which should be reasonably in sync.
+type SharedLimiter struct {
+	store   Store
+	key     string
+	take    func(ctx context.Context, key string, now time.Time) (ok bool, retryAfter time.Duration, err error)
+	limit   int64
+	period  time.Duration
+	burst   int64
+	timeNow func() time.Time
+}
+
+// NewGCRALimiter returns a SharedLimiter that implements the generic cell rate
+// algorithm. It allows limit requests per period, evenly spaced, plus bursts
+// of up to burst extra requests. Every key uses a single value in the store.
+// Keys in the store are prefixed with key. It panics if limit or period isn't
+// positive, or if burst is negative.
+func NewGCRALimiter(store Store, key string, limit int, period time.Duration, burst int) *SharedLimiter {
+	if limit <= 0 || period <= 0 {
+		panic("non-positive limit or period")
+	}
+	if burst < 0 {
+		panic("negative burst")
+	}
+	l := &SharedLimiter{
+		store:   store,
+		key:     key,
+		limit:   int64(limit),
+		period:  period,
+		burst:   int64(burst),
+		timeNow: time.Now,
+	}
+	l.take = l.takeGCRA
+	return l
+}
+
+// NewSlidingWindowLimiter returns a SharedLimiter that allows limit requests
+// within any window of the given duration. The count of the sliding window is
+// estimated from the counts of the current and previous fixed windows, so
+// every key uses two values in the store. Keys in the store are prefixed with
+// key. It panics if limit or window isn't positive.
+func NewSlidingWindowLimiter(store Store, key string, limit int, window time.Duration) *SharedLimiter {
+	if limit <= 0 || window <= 0 {
+		panic("non-positive limit or window")
+	}
+	l := &SharedLimiter{
+		store:   store,
+		key:     key,
+		limit:   int64(limit),
+		period:  window,
+		timeNow: time.Now,
+	}
+	l.take = l.takeSlidingWindow
+	return l
+}
+
+// Allow implements Allower for the limiter's own key. If the store can't be
+// reached, requests are allowed, but contention on the key counts as the
+// limit being reached.
+func (l *SharedLimiter) Allow() bool {
+	ok, _, err := l.AllowKey(context.Background(), "")
+	return ok || failOpen(err)
+}
+
+// failOpen reports whether a request should be allowed despite the error of
+// AllowKey, i.e. if the store can't be reached. Contention means the key is
+// busy, so it's treated as the limit being reached.
+func failOpen(err error) bool {
+	return err != nil && err != ErrContention
+}
+
+// Wait implements Waiter for the limiter's own key.
+func (l *SharedLimiter) Wait(ctx context.Context) error {
+	return l.WaitKey(ctx, "")
+}
+
+// AllowKey reports whether a request for the given key is allowed right now.
+// If it isn't, it also returns how long to wait before trying again. If the
+// key is updated concurrently too many times in a row, it returns
+// ErrContention, along with how long to back off.
+func (l *SharedLimiter) AllowKey(ctx context.Context, key string) (ok bool, retryAfter time.Duration, err error) {
+	storeKey := l.key
+	if key != "" {
+		storeKey += ":" + key
+	}
+	for i := 0; i < maxConflicts; i++ {
+		ok, retryAfter, err := l.take(ctx, storeKey, l.timeNow())
+		if err != errConflict {
+			return ok, retryAfter, err
+		}
+		if err := ctx.Err(); err != nil {
+			return false, 0, err
+		}
+	}
+	return false, time.Duration(int64(l.period) / l.limit), ErrContention
+}
+
+// WaitKey blocks until a request for the given key is allowed, or the context
+// is done, in which case it returns the context's error. As with Allow,
+// contention on the key counts as the limit being reached, so WaitKey backs
+// off and tries again, and if the store can't be reached, the request is
+// allowed.
+func (l *SharedLimiter) WaitKey(ctx context.Context, key string) error {
+	for {
+		ok, retryAfter, err := l.AllowKey(ctx, key)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ok || failOpen(err) {
+			return nil
+		}
+		t := time.NewTimer(retryAfter)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// errConflict signals that another process updated the store concurrently,
+// and the operation should be retried.
+var errConflict = errors.New("concurrent update")
+
+// ErrContention is returned by SharedLimiters when a key keeps being updated
+// concurrently by other processes, and a request couldn't be accounted for
+// after several attempts.
+var ErrContention = errors.New("rate limit store contention")
+
+// maxConflicts is the number of times a SharedLimiter tries to update a key
+// that's updated concurrently by other processes.
+const maxConflicts = 16
+
+// takeGCRA stores the theoretical arrival time of the next request.
+func (l *SharedLimiter) takeGCRA(ctx context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	var (
+		emission  = int64(l.period) / l.limit
+		tolerance = emission * l.burst
+		ttl       = time.Duration(emission + tolerance)
+	)
+	stored, exists, err := l.store.Get(ctx, key)
+	if err != nil {
+		return false, 0, err
+	}
+	tat := stored
+	if !exists || tat < now.UnixNano() {
+		tat = now.UnixNano()
+	}
+	if allowAt := tat - tolerance; now.UnixNano() < allowAt {
+		return false, time.Duration(allowAt - now.UnixNano()), nil
+	}
+
+	swapped, err := l.store.CompareAndSwap(ctx, key, stored, exists, tat+emission, ttl)
+	if err != nil {
+		return false, 0, err
+	}
+	if !swapped {
+		return false, 0, errConflict
+	}
+	return true, 0, nil
+}
+
+// takeSlidingWindow counts requests in fixed windows, and weighs the count of
+// the previous window by how much of it overlaps the sliding window.
+func (l *SharedLimiter) takeSlidingWindow(ctx context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	var (
+		window     = int64(l.period)
+		index      = now.UnixNano() / window
+		elapsed    = float64(now.UnixNano()%window) / float64(window)
+		currentKey = key + ":" + strconv.FormatInt(index, 10)
+		prevKey    = key + ":" + strconv.FormatInt(index-1, 10)
+	)
+	prev, _, err := l.store.Get(ctx, prevKey)
+	if err != nil {
+		return false, 0, err
+	}
+	current, exists, err := l.store.Get(ctx, currentKey)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if float64(prev)*(1-elapsed)+float64(current)+1 > float64(l.limit) {
+		// Wait until the previous window has slid far enough, or for the next
+		// window if the current one alone is full.
+		retryAfter := time.Duration(window - now.UnixNano()%window)
+		if prev > 0 && current < l.limit {
+			need := 1 - (float64(l.limit)-float64(current)-1)/float64(prev) // fraction of the window
+			if d := time.Duration(need*float64(window)) - time.Duration(now.UnixNano()%window); d > 0 && d < retryAfter {
+				retryAfter = d
+			}
+		}
+		return false, retryAfter, nil
+	}
+
+	swapped, err := l.store.CompareAndSwap(ctx, currentKey, current, exists, current+1, 2*l.period)
+	if err != nil {
+		return false, 0, err
+	}
+	if !swapped {
+		return false, 0, errConflict
+	}
+	return true, 0, nil
+}
+
+// KeyFunc extracts the key a request is limited by, e.g. a tenant or API key.
+type KeyFunc func(ctx context.Context, request interface{}) string
+
+// NewKeyedErroringLimiter returns an endpoint.Middleware that acts as a rate
+// limiter with a separate limit per key, as extracted by keyFunc. Requests
+// that would exceed the limit for their key, or whose key is too contended to
+// be accounted for, are rejected with ErrLimited. If the store can't be
+// reached, requests are allowed.
+func NewKeyedErroringLimiter(limit *SharedLimiter, keyFunc KeyFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if ok, _, err := limit.AllowKey(ctx, keyFunc(ctx, request)); !ok && !failOpen(err) {
+				return nil, ErrLimited
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// NewKeyedDelayingLimiter returns an endpoint.Middleware that acts as a
+// request throttler with a separate limit per key, as extracted by keyFunc.
+// Requests that would exceed the limit for their key are delayed, as per
+// WaitKey.
+func NewKeyedDelayingLimiter(limit *SharedLimiter, keyFunc KeyFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := limit.WaitKey(ctx, keyFunc(ctx, request)); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
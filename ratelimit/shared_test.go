@@ -0,0 +1,198 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/ratelimit"
+)
+
+func TestGCRALimiter(t *testing.T) {
+	limit := ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, time.Minute, 2)
+	for i := 0; i < 3; i++ {
+		if !limit.Allow() {
+			t.Fatalf("request %d: want allowed, have limited", i)
+		}
+	}
+	if limit.Allow() {
+		t.Error("want limited, have allowed")
+	}
+	ok, retryAfter, err := limit.AllowKey(context.Background(), "")
+	if err != nil || ok {
+		t.Fatalf("want limited, have ok=%v err=%v", ok, err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("want retry after up to 1m, have %v", retryAfter)
+	}
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	limit := ratelimit.NewSlidingWindowLimiter(ratelimit.NewMemoryStore(), "test", 3, time.Hour)
+	for i := 0; i < 3; i++ {
+		if !limit.Allow() {
+			t.Fatalf("request %d: want allowed, have limited", i)
+		}
+	}
+	if limit.Allow() {
+		t.Error("want limited, have allowed")
+	}
+}
+
+func TestSharedLimiterShared(t *testing.T) {
+	var (
+		store    = ratelimit.NewMemoryStore()
+		limiters = []*ratelimit.SharedLimiter{
+			ratelimit.NewSlidingWindowLimiter(store, "test", 50, time.Hour),
+			ratelimit.NewSlidingWindowLimiter(store, "test", 50, time.Hour),
+		}
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(l *ratelimit.SharedLimiter) {
+			defer wg.Done()
+			if l.Allow() {
+				mtx.Lock()
+				allowed++
+				mtx.Unlock()
+			}
+		}(limiters[i%2])
+	}
+	wg.Wait()
+
+	if want, have := 50, allowed; want != have {
+		t.Errorf("want %d allowed, have %d", want, have)
+	}
+}
+
+func TestSharedLimiterWait(t *testing.T) {
+	var (
+		limit = ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, 20*time.Millisecond, 0)
+		ctx   = context.Background()
+		begin = time.Now()
+	)
+	for i := 0; i < 3; i++ {
+		if err := limit.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := 40*time.Millisecond, time.Since(begin); have < want {
+		t.Errorf("want at least %v, have %v", want, have)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := limit.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, have %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestKeyedErroringLimiter(t *testing.T) {
+	var (
+		limit   = ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, time.Minute, 0)
+		keyFunc = func(_ context.Context, request interface{}) string { return request.(string) }
+		e       = ratelimit.NewKeyedErroringLimiter(limit, keyFunc)(nopEndpoint)
+		ctx     = context.Background()
+	)
+	for _, tenant := range []string{"a", "b"} {
+		if _, err := e(ctx, tenant); err != nil {
+			t.Errorf("%s: want allowed, have %v", tenant, err)
+		}
+		if _, err := e(ctx, tenant); err != ratelimit.ErrLimited {
+			t.Errorf("%s: want %v, have %v", tenant, ratelimit.ErrLimited, err)
+		}
+	}
+}
+
+func TestKeyedDelayingLimiter(t *testing.T) {
+	var (
+		limit   = ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, time.Minute, 0)
+		keyFunc = func(_ context.Context, request interface{}) string { return request.(string) }
+	)
+	testSuccessThenFailure(t, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return ratelimit.NewKeyedDelayingLimiter(limit, keyFunc)(nopEndpoint)(ctx, "tenant")
+	}, "deadline exceeded")
+}
+
+// contendedStore is a Store whose keys are always updated concurrently.
+type contendedStore struct {
+	ratelimit.Store
+	swaps int
+}
+
+func (s *contendedStore) CompareAndSwap(context.Context, string, int64, bool, int64, time.Duration) (bool, error) {
+	s.swaps++
+	return false, nil
+}
+
+func TestSharedLimiterContention(t *testing.T) {
+	store := &contendedStore{Store: ratelimit.NewMemoryStore()}
+	limit := ratelimit.NewGCRALimiter(store, "test", 1, time.Second, 0)
+	if _, _, err := limit.AllowKey(context.Background(), ""); err != ratelimit.ErrContention {
+		t.Errorf("want %v, have %v", ratelimit.ErrContention, err)
+	}
+	if store.swaps == 0 || store.swaps > 100 {
+		t.Errorf("want a bounded number of attempts, have %d", store.swaps)
+	}
+
+	// Contention counts as the limit being reached.
+	if limit.Allow() {
+		t.Error("want contended key not to be allowed")
+	}
+	e := ratelimit.NewKeyedErroringLimiter(limit, func(context.Context, interface{}) string { return "" })(endpoint.Nop)
+	if _, err := e(context.Background(), struct{}{}); err != ratelimit.ErrLimited {
+		t.Errorf("want %v, have %v", ratelimit.ErrLimited, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if want, have := context.DeadlineExceeded, limit.Wait(ctx); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+// unreachableStore is a Store that can't be reached.
+type unreachableStore struct {
+	ratelimit.Store
+}
+
+func (unreachableStore) Get(context.Context, string) (int64, bool, error) {
+	return 0, false, errors.New("unreachable")
+}
+
+func TestSharedLimiterUnreachable(t *testing.T) {
+	limit := ratelimit.NewGCRALimiter(unreachableStore{}, "test", 1, time.Second, 0)
+	if !limit.Allow() {
+		t.Error("want requests allowed when the store can't be reached")
+	}
+	e := ratelimit.NewKeyedErroringLimiter(limit, func(context.Context, interface{}) string { return "" })(endpoint.Nop)
+	if _, err := e(context.Background(), struct{}{}); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+	if err := limit.Wait(context.Background()); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+}
+
+func TestSharedLimiterInvalid(t *testing.T) {
+	for name, newLimiter := range map[string]func(){
+		"zero limit":      func() { ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 0, time.Second, 0) },
+		"zero period":     func() { ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, 0, 0) },
+		"negative burst":  func() { ratelimit.NewGCRALimiter(ratelimit.NewMemoryStore(), "test", 1, time.Second, -1) },
+		"zero window max": func() { ratelimit.NewSlidingWindowLimiter(ratelimit.NewMemoryStore(), "test", 0, time.Second) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want panic", name)
+				}
+			}()
+			newLimiter()
+		}()
+	}
+}
@@ -20,6 +20,7 @@ type endpointCache struct {
 	cache              map[string]endpointCloser
 	err                error
 	endpoints          []endpoint.Endpoint
+	instanceEndpoints  []InstanceEndpoint
 	logger             log.Logger
 	invalidateDeadline time.Time
 	timeNow            func() time.Time
@@ -100,31 +101,51 @@ func (c *endpointCache) updateCache(instances []string) {
 		}
 	}
 
-	// Populate the slice of endpoints.
-	endpoints := make([]endpoint.Endpoint, 0, len(cache))
+	// Populate the slices of endpoints.
+	var (
+		endpoints         = make([]endpoint.Endpoint, 0, len(cache))
+		instanceEndpoints = make([]InstanceEndpoint, 0, len(cache))
+	)
 	for _, instance := range instances {
 		// A bad factory may mean an instance is not present.
 		if _, ok := cache[instance]; !ok {
 			continue
 		}
 		endpoints = append(endpoints, cache[instance].Endpoint)
+		instanceEndpoints = append(instanceEndpoints, InstanceEndpoint{
+			Instance: instance,
+			Endpoint: cache[instance].Endpoint,
+		})
 	}
 
 	// Swap and trigger GC for old copies.
 	c.endpoints = endpoints
+	c.instanceEndpoints = instanceEndpoints
 	c.cache = cache
 }
 
 // Endpoints yields the current set of (presumably identical) endpoints, ordered
 // lexicographically by the corresponding instance string.
 func (c *endpointCache) Endpoints() ([]endpoint.Endpoint, error) {
+	endpoints, _, err := c.current()
+	return endpoints, err
+}
+
+// InstanceEndpoints yields the same set of endpoints as Endpoints, each paired
+// with the instance string it was created from.
+func (c *endpointCache) InstanceEndpoints() ([]InstanceEndpoint, error) {
+	_, instanceEndpoints, err := c.current()
+	return instanceEndpoints, err
+}
+
+func (c *endpointCache) current() ([]endpoint.Endpoint, []InstanceEndpoint, error) {
 	// in the steady state we're going to have many goroutines calling Endpoints()
 	// concurrently, so to minimize contention we use a shared R-lock.
 	c.mtx.RLock()
 
 	if c.err == nil || c.timeNow().Before(c.invalidateDeadline) {
 		defer c.mtx.RUnlock()
-		return c.endpoints, nil
+		return c.endpoints, c.instanceEndpoints, nil
 	}
 
 	c.mtx.RUnlock()
@@ -135,9 +156,9 @@ func (c *endpointCache) Endpoints() ([]endpoint.Endpoint, error) {
 
 	// re-check condition due to a race between RUnlock() and Lock().
 	if c.err == nil || c.timeNow().Before(c.invalidateDeadline) {
-		return c.endpoints, nil
+		return c.endpoints, c.instanceEndpoints, nil
 	}
 
 	c.updateCache(nil) // close any remaining active endpoints
-	return nil, c.err
+	return nil, nil, c.err
 }
@@ -3,6 +3,7 @@ package sd
 import (
 	"errors"
 	"io"
+	"reflect"
 	"testing"
 	"time"
 
@@ -149,6 +150,38 @@ func TestBadFactory(t *testing.T) {
 	assertEndpointsLen(t, cache, 0)
 }
 
+func TestEndpointCacheInstanceEndpoints(t *testing.T) {
+	var (
+		f     = func(instance string) (endpoint.Endpoint, io.Closer, error) { return endpoint.Nop, nil, nil }
+		cache = newEndpointCache(f, log.NewNopLogger(), endpointerOptions{})
+	)
+
+	cache.Update(Event{Instances: []string{"c", "a", "b"}})
+	instanceEndpoints, err := cache.InstanceEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, ie := range instanceEndpoints {
+		have = append(have, ie.Instance)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	cache.Update(Event{Instances: []string{"b"}})
+	instanceEndpoints, err = cache.InstanceEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(instanceEndpoints); want != have {
+		t.Fatalf("want %d, have %d", want, have)
+	}
+	if want, have := "b", instanceEndpoints[0].Instance; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
 func assertEndpointsLen(t *testing.T, cache *endpointCache, l int) {
 	endpoints, err := cache.Endpoints()
 	if err != nil {
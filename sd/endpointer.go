@@ -15,12 +15,44 @@ type Endpointer interface {
 	Endpoints() ([]endpoint.Endpoint, error)
 }
 
+// InstanceEndpoint is an endpoint paired with the instance string (e.g.
+// host:port) it was created from. The instance string is a stable identity for
+// the endpoint across updates from the service discovery system.
+type InstanceEndpoint struct {
+	Instance string
+	Endpoint endpoint.Endpoint
+}
+
+// InstanceEndpointer is an Endpointer that can also yield each endpoint along
+// with its instance string. Consumers that keep per-instance state, like
+// load-aware balancers, should prefer it over Endpoints.
+type InstanceEndpointer interface {
+	Endpointer
+	InstanceEndpoints() ([]InstanceEndpoint, error)
+}
+
 // FixedEndpointer yields a fixed set of endpoints.
 type FixedEndpointer []endpoint.Endpoint
 
 // Endpoints implements Endpointer.
 func (s FixedEndpointer) Endpoints() ([]endpoint.Endpoint, error) { return s, nil }
 
+// FixedInstanceEndpointer yields a fixed set of endpoints along with their
+// instance strings.
+type FixedInstanceEndpointer []InstanceEndpoint
+
+// Endpoints implements Endpointer.
+func (s FixedInstanceEndpointer) Endpoints() ([]endpoint.Endpoint, error) {
+	endpoints := make([]endpoint.Endpoint, len(s))
+	for i, ie := range s {
+		endpoints[i] = ie.Endpoint
+	}
+	return endpoints, nil
+}
+
+// InstanceEndpoints implements InstanceEndpointer.
+func (s FixedInstanceEndpointer) InstanceEndpoints() ([]InstanceEndpoint, error) { return s, nil }
+
 // NewEndpointer creates an Endpointer that subscribes to updates from Instancer src
 // and uses factory f to create Endpoints. If src notifies of an error, the Endpointer
 // keeps returning previously created Endpoints assuming they are still good, unless
@@ -88,3 +120,8 @@ func (de *DefaultEndpointer) Close() {
 func (de *DefaultEndpointer) Endpoints() ([]endpoint.Endpoint, error) {
 	return de.cache.Endpoints()
 }
+
+// InstanceEndpoints implements InstanceEndpointer.
+func (de *DefaultEndpointer) InstanceEndpoints() ([]InstanceEndpoint, error) {
+	return de.cache.InstanceEndpoints()
+}
@@ -0,0 +1,88 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Checker probes a single instance, e.g. host:port. It should return a nil
+// error if the instance is healthy, and honor the deadline of the context.
+type Checker interface {
+	Check(ctx context.Context, instance string) error
+}
+
+// CheckerFunc is an adapter that lets a function operate as if it implements
+// Checker.
+type CheckerFunc func(ctx context.Context, instance string) error
+
+// Check implements Checker.
+func (f CheckerFunc) Check(ctx context.Context, instance string) error {
+	return f(ctx, instance)
+}
+
+// TCPChecker returns a Checker that considers an instance healthy if a TCP
+// connection to it can be established.
+func TCPChecker() Checker {
+	return CheckerFunc(func(ctx context.Context, instance string) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", instance)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPChecker returns a Checker that issues a GET request for path to each
+// instance, using the given scheme, e.g. "http". The instance is healthy if
+// it responds with a 2xx status code. If client is nil, http.DefaultClient is
+// used.
+func HTTPChecker(client *http.Client, scheme, path string) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return CheckerFunc(func(ctx context.Context, instance string) error {
+		req, err := http.NewRequest("GET", scheme+"://"+instance+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// GRPCChecker returns a Checker that queries each instance with the standard
+// gRPC health checking protocol for the named service. An empty service name
+// queries the overall health of the server. The instance is healthy if it
+// reports SERVING. A connection is dialed for every check with the given
+// options, which usually include grpc.WithInsecure or transport credentials.
+func GRPCChecker(service string, options ...grpc.DialOption) Checker {
+	return CheckerFunc(func(ctx context.Context, instance string) error {
+		conn, err := grpc.DialContext(ctx, instance, options...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestTCPChecker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	if err := TCPChecker().Check(context.Background(), addr); err != nil {
+		t.Errorf("want healthy, have %v", err)
+	}
+
+	ln.Close()
+	if err := TCPChecker().Check(context.Background(), addr); err == nil {
+		t.Error("want unhealthy, have healthy")
+	}
+}
+
+func TestHTTPChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	instance := strings.TrimPrefix(server.URL, "http://")
+
+	if err := HTTPChecker(nil, "http", "/health").Check(context.Background(), instance); err != nil {
+		t.Errorf("want healthy, have %v", err)
+	}
+	if err := HTTPChecker(nil, "http", "/other").Check(context.Background(), instance); err == nil {
+		t.Error("want unhealthy, have healthy")
+	}
+}
+
+func TestGRPCChecker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		server = grpc.NewServer()
+		hs     = health.NewServer()
+	)
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(ln)
+	defer server.GracefulStop()
+
+	hs.SetServingStatus("up", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("down", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	instance := ln.Addr().String()
+
+	if err := GRPCChecker("up", grpc.WithInsecure()).Check(ctx, instance); err != nil {
+		t.Errorf("want healthy, have %v", err)
+	}
+	if err := GRPCChecker("down", grpc.WithInsecure()).Check(ctx, instance); err == nil {
+		t.Error("want unhealthy, have healthy")
+	}
+}
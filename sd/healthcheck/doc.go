@@ -0,0 +1,3 @@
+// Package healthcheck provides an Instancer that actively probes the instances
+// yielded by another Instancer, and only passes along the healthy ones.
+package healthcheck
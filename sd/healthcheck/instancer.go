@@ -0,0 +1,287 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/internal/instance"
+)
+
+// Instancer wraps another Instancer and probes each of its instances on a
+// fixed schedule. Only instances considered healthy are published to
+// registered observers. Errors from the wrapped Instancer are passed along.
+//
+// An instance enters the published set after passing its first probe, or
+// later after passing Rise consecutive probes, and leaves it after failing
+// Fall consecutive probes, so that a single flaky probe doesn't make the
+// instance set flap.
+//
+// Probes run in the background, so that events of the wrapped Instancer are
+// handled while they do. A scheduled probe is skipped if the previous one is
+// still running.
+type Instancer struct {
+	cache   *instance.Cache
+	src     sd.Instancer
+	ch      chan sd.Event
+	checker Checker
+	options options
+	logger  log.Logger
+	results chan probeResult
+	quit    chan struct{}
+	done    chan struct{}
+
+	// Accessed only by the loop goroutine.
+	instances map[string]*status
+	probing   bool // a scheduled probe of every instance is in flight
+	err       error
+}
+
+// Option allows control of Instancer behavior.
+type Option func(*options)
+
+// Rise sets the number of consecutive successful probes required for an
+// unhealthy instance to be considered healthy again. By default, it's 2.
+func Rise(n int) Option {
+	return func(opts *options) { opts.rise = n }
+}
+
+// Fall sets the number of consecutive failed probes required for a healthy
+// instance to be considered unhealthy. By default, it's 3.
+func Fall(n int) Option {
+	return func(opts *options) { opts.fall = n }
+}
+
+// Timeout sets the deadline given to each probe. By default, it's 1 second.
+func Timeout(d time.Duration) Option {
+	return func(opts *options) { opts.timeout = d }
+}
+
+type options struct {
+	rise    int
+	fall    int
+	timeout time.Duration
+	probed  func() // called once the results of a probe are recorded, for tests
+}
+
+type status struct {
+	healthy   bool
+	checked   bool // at least once
+	successes int  // consecutive
+	failures  int  // consecutive
+}
+
+// NewInstancer returns an Instancer that probes the instances of src with
+// checker every interval. The returned Instancer registers with src
+// immediately; Stop deregisters it, but doesn't stop src.
+func NewInstancer(src sd.Instancer, checker Checker, interval time.Duration, logger log.Logger, opts ...Option) *Instancer {
+	return NewInstancerDetailed(src, checker, time.NewTicker(interval), logger, opts...)
+}
+
+// NewInstancerDetailed is the same as NewInstancer, but allows users to
+// provide an explicit probe ticker instead of an interval.
+func NewInstancerDetailed(src sd.Instancer, checker Checker, refresh *time.Ticker, logger log.Logger, opts ...Option) *Instancer {
+	o := options{
+		rise:    2,
+		fall:    3,
+		timeout: time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	in := &Instancer{
+		cache:     instance.NewCache(),
+		src:       src,
+		ch:        make(chan sd.Event),
+		checker:   checker,
+		options:   o,
+		logger:    logger,
+		results:   make(chan probeResult),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+		instances: map[string]*status{},
+	}
+	go in.loop(refresh)
+	src.Register(in.ch)
+	return in
+}
+
+// Stop terminates the Instancer and deregisters it from the wrapped Instancer.
+func (in *Instancer) Stop() {
+	in.src.Deregister(in.ch)
+	close(in.quit)
+	<-in.done
+}
+
+// Register implements Instancer.
+func (in *Instancer) Register(ch chan<- sd.Event) {
+	in.cache.Register(ch)
+}
+
+// Deregister implements Instancer.
+func (in *Instancer) Deregister(ch chan<- sd.Event) {
+	in.cache.Deregister(ch)
+}
+
+func (in *Instancer) loop(t *time.Ticker) {
+	defer close(in.done)
+	defer t.Stop()
+	for {
+		select {
+		case event := <-in.ch:
+			in.update(event)
+
+		case <-t.C:
+			if !in.probing { // or else, skip the tick
+				in.probing = true
+				in.probe(in.all(), true)
+			}
+
+		case result := <-in.results:
+			in.apply(result)
+
+		case <-in.quit:
+			return
+		}
+	}
+}
+
+// update tracks the instances in event, probing the new ones right away.
+func (in *Instancer) update(event sd.Event) {
+	if event.Err != nil {
+		in.err = event.Err
+		in.cache.Update(sd.Event{Err: event.Err})
+		return
+	}
+	in.err = nil
+
+	var (
+		instances = make(map[string]*status, len(event.Instances))
+		fresh     []string
+	)
+	for _, instance := range event.Instances {
+		if s, ok := in.instances[instance]; ok {
+			instances[instance] = s
+			continue
+		}
+		instances[instance] = &status{}
+		fresh = append(fresh, instance)
+	}
+	removed := len(in.instances) > len(instances)-len(fresh)
+	in.instances = instances
+	if removed || len(fresh) == 0 {
+		in.publish() // or else, once the new instances are probed
+	}
+	if len(fresh) > 0 {
+		in.probe(fresh, false)
+	}
+}
+
+func (in *Instancer) all() []string {
+	instances := make([]string, 0, len(in.instances))
+	for instance := range in.instances {
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// probeResult holds the outcome of the checks of a probe.
+type probeResult struct {
+	statuses  []*status // of the instances when the probe started
+	instances []string
+	errs      []error
+	scheduled bool
+}
+
+// probe checks the given instances concurrently, in the background, so that
+// the loop keeps reading events from the wrapped Instancer meanwhile. The
+// results are sent back to the loop, to be recorded by apply.
+func (in *Instancer) probe(instances []string, scheduled bool) {
+	result := probeResult{
+		statuses:  make([]*status, len(instances)),
+		instances: instances,
+		errs:      make([]error, len(instances)),
+		scheduled: scheduled,
+	}
+	for i, instance := range instances {
+		result.statuses[i] = in.instances[instance]
+	}
+	go func() {
+		var wg sync.WaitGroup
+		for i, instance := range instances {
+			wg.Add(1)
+			go func(i int, instance string) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), in.options.timeout)
+				defer cancel()
+				result.errs[i] = in.checker.Check(ctx, instance)
+			}(i, instance)
+		}
+		wg.Wait()
+		select {
+		case in.results <- result:
+		case <-in.quit:
+		}
+	}()
+}
+
+// apply records the results of a probe, and publishes the resulting set of
+// healthy instances. Instances that are gone since the probe started are
+// skipped.
+func (in *Instancer) apply(result probeResult) {
+	if result.scheduled {
+		in.probing = false
+	}
+	for i, instance := range result.instances {
+		if s := in.instances[instance]; s != nil && s == result.statuses[i] {
+			in.record(instance, s, result.errs[i])
+		}
+	}
+	in.publish()
+	if in.options.probed != nil {
+		in.options.probed()
+	}
+}
+
+func (in *Instancer) record(instance string, s *status, err error) {
+	if err == nil {
+		s.successes++
+		s.failures = 0
+	} else {
+		s.failures++
+		s.successes = 0
+	}
+
+	switch {
+	case !s.checked:
+		s.checked = true
+		s.healthy = err == nil
+	case !s.healthy && s.successes >= in.options.rise:
+		s.healthy = true
+	case s.healthy && s.failures >= in.options.fall:
+		s.healthy = false
+	default:
+		return
+	}
+
+	if s.healthy {
+		in.logger.Log("instance", instance, "health", "up")
+	} else {
+		in.logger.Log("instance", instance, "health", "down", "err", err)
+	}
+}
+
+func (in *Instancer) publish() {
+	if in.err != nil {
+		return // keep reporting the error until src recovers
+	}
+	healthy := []string{}
+	for instance, s := range in.instances {
+		if s.healthy {
+			healthy = append(healthy, instance)
+		}
+	}
+	in.cache.Update(sd.Event{Instances: healthy})
+}
@@ -0,0 +1,140 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/internal/instance"
+)
+
+var _ sd.Instancer = (*Instancer)(nil) // API check
+
+func TestInstancer(t *testing.T) {
+	var (
+		src     = instance.NewCache()
+		checker = &fakeChecker{down: map[string]bool{"b": true}}
+		tickc   = make(chan time.Time)
+		ticker  = time.NewTicker(time.Second)
+		events  = make(chan sd.Event, 10)
+		probed  = make(chan struct{}, 10)
+		tick    = func() {
+			tickc <- time.Now()
+			<-probed // probes run in the background
+		}
+	)
+	ticker.Stop()
+	ticker.C = tickc
+
+	src.Update(sd.Event{Instances: []string{"a", "b"}})
+	instancer := NewInstancerDetailed(src, checker, ticker, log.NewNopLogger(), Rise(2), Fall(2), func(o *options) {
+		o.probed = func() { probed <- struct{}{} }
+	})
+	defer instancer.Stop()
+	instancer.Register(events)
+	<-probed
+
+	// Initial probe: b is down from the start.
+	waitFor(t, events, "a")
+
+	// b comes up, but needs two passing probes to rise.
+	checker.set("b", false)
+	tick()
+	tick()
+	waitFor(t, events, "a", "b")
+
+	// a goes down, but a single failed probe doesn't make it fall.
+	checker.set("a", true)
+	tick()
+	checker.set("a", false)
+	tick()
+	checker.set("a", true)
+	tick()
+	tick()
+	waitFor(t, events, "b")
+
+	// New instances are probed as soon as they appear.
+	src.Update(sd.Event{Instances: []string{"a", "b", "c"}})
+	waitFor(t, events, "b", "c")
+
+	// Errors are passed along.
+	src.Update(sd.Event{Err: errors.New("sd error")})
+	select {
+	case event := <-events:
+		if event.Err == nil {
+			t.Errorf("want error, have %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for error")
+	}
+}
+
+func TestInstancerSlowProbes(t *testing.T) {
+	var (
+		src     = instance.NewCache()
+		release = make(chan struct{})
+		checker = CheckerFunc(func(ctx context.Context, instance string) error {
+			if instance == "slow" {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		})
+		events = make(chan sd.Event, 10)
+	)
+	defer close(release)
+	src.Update(sd.Event{Instances: []string{"a", "b"}})
+	instancer := NewInstancer(src, checker, time.Hour, log.NewNopLogger(), Timeout(time.Minute))
+	defer instancer.Stop()
+	instancer.Register(events)
+	waitFor(t, events, "a", "b")
+
+	// Events keep being handled while a probe hangs.
+	src.Update(sd.Event{Instances: []string{"a", "b", "slow"}})
+	src.Update(sd.Event{Instances: []string{"a"}})
+	waitFor(t, events, "a")
+}
+
+type fakeChecker struct {
+	mtx  sync.Mutex
+	down map[string]bool
+}
+
+func (c *fakeChecker) set(instance string, down bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.down[instance] = down
+}
+
+func (c *fakeChecker) Check(_ context.Context, instance string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.down[instance] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+// waitFor reads events until one contains exactly the given instances.
+func waitFor(t *testing.T, events <-chan sd.Event, want ...string) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	var have sd.Event
+	for {
+		select {
+		case have = <-events:
+			if have.Err == nil && reflect.DeepEqual(want, have.Instances) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("want %v, last event %v", want, have)
+		}
+	}
+}
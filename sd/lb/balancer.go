@@ -1,6 +1,7 @@
 package lb
 
 import (
+	"context"
 	"errors"
 
 	"github.com/go-kit/kit/endpoint"
@@ -11,5 +12,12 @@ type Balancer interface {
 	Endpoint() (endpoint.Endpoint, error)
 }
 
+// RequestBalancer yields endpoints according to some heuristic that takes the
+// request into account, e.g. to route requests with the same key to the same
+// endpoint.
+type RequestBalancer interface {
+	Endpoint(ctx context.Context, request interface{}) (endpoint.Endpoint, error)
+}
+
 // ErrNoEndpoints is returned when no qualifying endpoints are available.
 var ErrNoEndpoints = errors.New("no endpoints available")
@@ -0,0 +1,163 @@
+package lb
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+// KeyFunc extracts the key used to route a request. Requests with the same key
+// are routed to the same endpoint.
+type KeyFunc func(ctx context.Context, request interface{}) string
+
+// DefaultReplicas is the number of times each instance is placed on the ring
+// of NewConsistentHash when no positive value is given. With fewer virtual
+// nodes, the share of keys owned by each instance is badly skewed.
+const DefaultReplicas = 128
+
+// NewConsistentHash returns a load balancer that routes each request to an
+// endpoint picked from a consistent hash ring, using the key extracted by
+// keyFunc. The ring is built from the instance strings when s implements
+// sd.InstanceEndpointer, so adding or removing an instance only moves the keys
+// owned by that instance. Each instance is placed on the ring replicas times;
+// more replicas spread keys more evenly at the cost of memory. A replicas
+// value <= 0 uses DefaultReplicas.
+//
+// When used with RequestRetry, subsequent attempts for the same request walk
+// the ring to the next distinct endpoints.
+func NewConsistentHash(s sd.Endpointer, replicas int, keyFunc KeyFunc) RequestBalancer {
+	if keyFunc == nil {
+		panic("nil KeyFunc")
+	}
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &consistentHash{
+		s:        s,
+		replicas: replicas,
+		keyFunc:  keyFunc,
+	}
+}
+
+type consistentHash struct {
+	s        sd.Endpointer
+	replicas int
+	keyFunc  KeyFunc
+
+	mtx  sync.RWMutex
+	ring *hashRing
+}
+
+func (ch *consistentHash) Endpoint(ctx context.Context, request interface{}) (endpoint.Endpoint, error) {
+	instanceEndpoints, err := instanceEndpoints(ch.s)
+	if err != nil {
+		return nil, err
+	}
+	if len(instanceEndpoints) <= 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	ring := ch.getRing(instanceEndpoints)
+	idx := ring.lookup(hashKey(ch.keyFunc(ctx, request)), attempt(ctx)-1)
+	return instanceEndpoints[idx].Endpoint, nil // the ring's copy may be stale
+}
+
+// getRing returns a ring for the given instances, rebuilding it only when the
+// set of instances has changed.
+func (ch *consistentHash) getRing(instanceEndpoints []sd.InstanceEndpoint) *hashRing {
+	ch.mtx.RLock()
+	ring := ch.ring
+	ch.mtx.RUnlock()
+	if ring != nil && ring.matches(instanceEndpoints) {
+		return ring
+	}
+
+	ring = newHashRing(instanceEndpoints, ch.replicas)
+	ch.mtx.Lock()
+	ch.ring = ring
+	ch.mtx.Unlock()
+	return ring
+}
+
+type hashRing struct {
+	endpoints []sd.InstanceEndpoint
+	points    []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash  uint64
+	index int // into endpoints
+}
+
+func newHashRing(instanceEndpoints []sd.InstanceEndpoint, replicas int) *hashRing {
+	points := make([]ringPoint, 0, len(instanceEndpoints)*replicas)
+	for i, ie := range instanceEndpoints {
+		for r := 0; r < replicas; r++ {
+			points = append(points, ringPoint{
+				hash:  hashKey(ie.Instance + "#" + strconv.Itoa(r)),
+				index: i,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		// Break (unlikely) collisions deterministically.
+		return instanceEndpoints[points[i].index].Instance < instanceEndpoints[points[j].index].Instance
+	})
+	return &hashRing{
+		endpoints: instanceEndpoints,
+		points:    points,
+	}
+}
+
+// matches reports whether the ring was built from the same instances.
+func (r *hashRing) matches(instanceEndpoints []sd.InstanceEndpoint) bool {
+	if len(r.endpoints) != len(instanceEndpoints) {
+		return false
+	}
+	for i := range instanceEndpoints {
+		if r.endpoints[i].Instance != instanceEndpoints[i].Instance {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the index of the endpoint owning hash, skipping past the
+// first skip distinct endpoints encountered when walking the ring clockwise.
+func (r *hashRing) lookup(hash uint64, skip int) int {
+	skip %= len(r.endpoints)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	seen := make(map[int]struct{}, skip+1)
+	for {
+		p := r.points[i%len(r.points)]
+		if _, ok := seen[p.index]; !ok {
+			if len(seen) == skip {
+				return p.index
+			}
+			seen[p.index] = struct{}{}
+		}
+		i++
+	}
+}
+
+// hashKey hashes s with FNV-1a, followed by a finalizer that spreads similar
+// strings, like instance strings that differ in one digit, across the ring.
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
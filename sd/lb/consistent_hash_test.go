@@ -0,0 +1,154 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+)
+
+func TestConsistentHashSameKeySameEndpoint(t *testing.T) {
+	var (
+		endpointer = instanceEndpointer(10)
+		balancer   = lb.NewConsistentHash(endpointer, 100, requestKey)
+	)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		first := owner(t, balancer, key)
+		for j := 0; j < 3; j++ {
+			if want, have := first, owner(t, balancer, key); want != have {
+				t.Fatalf("%s: want %s, have %s", key, want, have)
+			}
+		}
+	}
+}
+
+func TestConsistentHashMinimalDisruption(t *testing.T) {
+	var (
+		n      = 10
+		keys   = 10000
+		before = lb.NewConsistentHash(instanceEndpointer(n), 100, requestKey)
+		after  = lb.NewConsistentHash(instanceEndpointer(n+1), 100, requestKey)
+		counts = map[string]int{}
+		moved  int
+	)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		b, a := owner(t, before, key), owner(t, after, key)
+		counts[b]++
+		if a != b {
+			if a != fmt.Sprintf("instance-%d", n) {
+				t.Fatalf("%s: moved from %s to %s, not to the new instance", key, b, a)
+			}
+			moved++
+		}
+	}
+
+	// Ideally 1/(n+1) of the keys move to the new instance.
+	if want, have := keys/(n+1), moved; have > 2*want {
+		t.Errorf("want about %d keys moved, have %d", want, have)
+	}
+
+	// Keys should be spread reasonably evenly.
+	for instance, count := range counts {
+		if want := keys / n; count < want/2 || count > want*2 {
+			t.Errorf("%s: want about %d keys, have %d", instance, want, count)
+		}
+	}
+}
+
+func TestConsistentHashRetryFailsOver(t *testing.T) {
+	var (
+		calls      []string
+		endpointer = sd.FixedInstanceEndpointer{}
+	)
+	for i := 0; i < 3; i++ {
+		instance := fmt.Sprintf("instance-%d", i)
+		endpointer = append(endpointer, sd.InstanceEndpoint{
+			Instance: instance,
+			Endpoint: func(context.Context, interface{}) (interface{}, error) {
+				calls = append(calls, instance)
+				return nil, errors.New("fail")
+			},
+		})
+	}
+
+	var (
+		balancer = lb.NewConsistentHash(endpointer, 100, requestKey)
+		retry    = lb.RequestRetry(3, time.Second, balancer)
+	)
+	if _, err := retry(context.Background(), "some-key"); err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := 3, len(calls); want != have {
+		t.Fatalf("want %d calls, have %d", want, have)
+	}
+	seen := map[string]bool{}
+	for _, call := range calls {
+		if seen[call] {
+			t.Errorf("%s called twice in %v", call, calls)
+		}
+		seen[call] = true
+	}
+}
+
+func TestConsistentHashNoEndpoints(t *testing.T) {
+	balancer := lb.NewConsistentHash(sd.FixedEndpointer{}, 100, requestKey)
+	_, err := balancer.Endpoint(context.Background(), "key")
+	if want, have := lb.ErrNoEndpoints, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestConsistentHashDefaultReplicas(t *testing.T) {
+	const instances, keys = 4, 10000
+	balancer := lb.NewConsistentHash(instanceEndpointer(instances), 0, requestKey)
+	counts := map[string]int{}
+	for i := 0; i < keys; i++ {
+		counts[owner(t, balancer, fmt.Sprintf("key-%d", i))]++
+	}
+	for instance, count := range counts {
+		if share := float64(count) / keys; share < 0.15 || share > 0.35 {
+			t.Errorf("%s owns %.0f%% of the keys", instance, share*100)
+		}
+	}
+}
+
+func TestConsistentHashNilKeyFunc(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic for nil KeyFunc")
+		}
+	}()
+	lb.NewConsistentHash(instanceEndpointer(1), 0, nil)
+}
+
+func requestKey(_ context.Context, request interface{}) string {
+	return request.(string)
+}
+
+func instanceEndpointer(n int) sd.FixedInstanceEndpointer {
+	endpointer := make(sd.FixedInstanceEndpointer, n)
+	for i := range endpointer {
+		instance := fmt.Sprintf("instance-%d", i)
+		endpointer[i] = sd.InstanceEndpoint{
+			Instance: instance,
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return instance, nil },
+		}
+	}
+	return endpointer
+}
+
+func owner(t *testing.T, b lb.RequestBalancer, key string) string {
+	t.Helper()
+	e, err := b.Endpoint(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, _ := e(context.Background(), key)
+	return response.(string)
+}
@@ -0,0 +1,226 @@
+package lb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// HedgeDelay decides how long Hedge waits for outstanding attempts before
+// sending the request to another endpoint. When a request succeeds, Observe
+// is called with the latency of the successful attempt, and with the time
+// spent so far by the attempts still outstanding.
+type HedgeDelay interface {
+	Delay() time.Duration
+	Observe(latency time.Duration)
+}
+
+// FixedHedgeDelay returns a HedgeDelay that always waits for d.
+func FixedHedgeDelay(d time.Duration) HedgeDelay {
+	return fixedHedgeDelay(d)
+}
+
+type fixedHedgeDelay time.Duration
+
+func (d fixedHedgeDelay) Delay() time.Duration { return time.Duration(d) }
+
+func (d fixedHedgeDelay) Observe(time.Duration) {}
+
+// PercentileHedgeDelay returns a HedgeDelay that waits for the given
+// percentile, between 0 and 100, of the latencies of the last window
+// successful attempts. For example, with a percentile of 95, roughly one in
+// twenty requests is hedged. Until window latencies have been observed, it
+// waits for initial.
+func PercentileHedgeDelay(percentile float64, window int, initial time.Duration) HedgeDelay {
+	if window <= 0 {
+		window = 1
+	}
+	return &percentileHedgeDelay{
+		percentile: percentile,
+		initial:    initial,
+		samples:    make([]time.Duration, 0, window),
+	}
+}
+
+type percentileHedgeDelay struct {
+	percentile float64
+	initial    time.Duration
+
+	mtx     sync.Mutex
+	samples []time.Duration // ring buffer
+	next    int
+	delay   time.Duration // cached, zero if stale
+}
+
+func (p *percentileHedgeDelay) Delay() time.Duration {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if len(p.samples) < cap(p.samples) {
+		return p.initial
+	}
+	if p.delay == 0 {
+		sorted := make([]time.Duration, len(p.samples))
+		copy(sorted, p.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		idx := int(p.percentile / 100 * float64(len(sorted)))
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		if idx < 0 {
+			idx = 0
+		}
+		p.delay = sorted[idx]
+	}
+	return p.delay
+}
+
+func (p *percentileHedgeDelay) Observe(latency time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if len(p.samples) < cap(p.samples) {
+		p.samples = append(p.samples, latency)
+	} else {
+		p.samples[p.next] = latency
+		p.next = (p.next + 1) % len(p.samples)
+	}
+	p.delay = 0
+}
+
+// NonIdempotent returns a context that marks the request as not idempotent.
+// Hedge never sends such requests more than once.
+func NonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	nonIdempotent, _ := ctx.Value(nonIdempotentKey).(bool)
+	return !nonIdempotent
+}
+
+// Hedge wraps a service load balancer and returns an endpoint oriented load
+// balancer that hedges requests. A request is first sent to one endpoint. If
+// no attempt has succeeded when the delay elapses, the same request is sent to
+// another endpoint, up to max additional times. The first successful response
+// is returned, and the context given to the other attempts is canceled. If an
+// attempt fails while no other is outstanding, the next one is sent right
+// away. When every attempt has failed, the error of the last one is returned.
+//
+// Each attempt asks the balancer for an endpoint on its own, so that a
+// balancer picking endpoints at random may send a hedged attempt to the same
+// endpoint as a previous one. NewRoundRobin picks distinct endpoints as long
+// as there are enough of them; see also RequestHedge.
+//
+// Requests whose context was created with NonIdempotent are never hedged.
+func Hedge(max int, delay HedgeDelay, b Balancer) endpoint.Endpoint {
+	if b == nil {
+		panic("nil Balancer")
+	}
+	return hedge(max, delay, func(context.Context, interface{}) (endpoint.Endpoint, error) {
+		return b.Endpoint()
+	})
+}
+
+// RequestHedge is like Hedge, but for a RequestBalancer. The attempt number is
+// made available to the balancer via the context, as with RequestRetry, so
+// that balancers which always pick the same endpoint for a request, like
+// NewConsistentHash, send hedged attempts to the next distinct endpoints.
+func RequestHedge(max int, delay HedgeDelay, b RequestBalancer) endpoint.Endpoint {
+	if b == nil {
+		panic("nil RequestBalancer")
+	}
+	return hedge(max, delay, b.Endpoint)
+}
+
+func hedge(max int, delay HedgeDelay, pick func(context.Context, interface{}) (endpoint.Endpoint, error)) endpoint.Endpoint {
+	if max < 0 {
+		panic("negative max")
+	}
+
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		type result struct {
+			attempt  int
+			response interface{}
+			err      error
+		}
+
+		var (
+			newctx, cancel = context.WithCancel(ctx)
+			results        = make(chan result, max+1)
+			hedges         = max
+			attempts       int
+			outstanding    = map[int]time.Time{} // attempt to start time
+		)
+		defer cancel()
+
+		if !isIdempotent(ctx) {
+			hedges = 0
+		}
+
+		send := func() {
+			attempts++
+			outstanding[attempts] = time.Now()
+			go func(attempt int, attemptctx context.Context) {
+				e, err := pick(attemptctx, request)
+				if err != nil {
+					results <- result{attempt: attempt, err: err}
+					return
+				}
+				response, err := e(newctx, request)
+				results <- result{attempt, response, err}
+			}(attempts, context.WithValue(newctx, attemptKey, attempts))
+		}
+
+		timer := time.NewTimer(delay.Delay())
+		defer timer.Stop()
+		send()
+
+		for {
+			select {
+			case <-newctx.Done():
+				return nil, newctx.Err()
+
+			case <-timer.C:
+				if hedges > 0 {
+					hedges--
+					send()
+					timer.Reset(delay.Delay())
+				}
+
+			case r := <-results:
+				begin := outstanding[r.attempt]
+				delete(outstanding, r.attempt)
+				if r.err == nil {
+					// The attempts still outstanding are at least as slow as
+					// they've been so far. Observing that as well keeps the
+					// delay from being biased towards the fastest endpoints.
+					now := time.Now()
+					delay.Observe(now.Sub(begin))
+					for _, begin := range outstanding {
+						delay.Observe(now.Sub(begin))
+					}
+					return r.response, nil
+				}
+				if len(outstanding) > 0 {
+					continue
+				}
+				if hedges <= 0 {
+					return nil, r.err
+				}
+				hedges--
+				send()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay.Delay())
+			}
+		}
+	}
+}
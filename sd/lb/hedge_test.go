@@ -0,0 +1,196 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+)
+
+func TestHedgeSendsAfterDelay(t *testing.T) {
+	var (
+		canceled = make(chan struct{})
+		slow     = func(ctx context.Context, _ interface{}) (interface{}, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}
+		fast      = func(context.Context, interface{}) (interface{}, error) { return "fast", nil }
+		endpoints = sd.FixedEndpointer{slow, fast}
+		hedge     = lb.Hedge(1, lb.FixedHedgeDelay(10*time.Millisecond), lb.NewRoundRobin(endpoints))
+	)
+
+	response, err := hedge(context.Background(), struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "fast", response; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("slow attempt was not canceled")
+	}
+}
+
+func TestHedgeRespectsMax(t *testing.T) {
+	var (
+		calls int32
+		block = make(chan struct{})
+		e     = func(ctx context.Context, _ interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			select {
+			case <-block:
+				return struct{}{}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		hedge = lb.Hedge(2, lb.FixedHedgeDelay(time.Millisecond), lb.NewRoundRobin(sd.FixedEndpointer{e}))
+	)
+
+	go func() { time.Sleep(50 * time.Millisecond); close(block) }()
+	if _, err := hedge(context.Background(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(3), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+}
+
+func TestHedgeNonIdempotent(t *testing.T) {
+	var (
+		calls int32
+		e     = func(context.Context, interface{}) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(20 * time.Millisecond)
+			return struct{}{}, nil
+		}
+		hedge = lb.Hedge(5, lb.FixedHedgeDelay(time.Millisecond), lb.NewRoundRobin(sd.FixedEndpointer{e}))
+	)
+
+	if _, err := hedge(lb.NonIdempotent(context.Background()), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+}
+
+func TestHedgeAllFail(t *testing.T) {
+	var (
+		calls     int32
+		myErr     = errors.New("fail")
+		e         = func(context.Context, interface{}) (interface{}, error) { atomic.AddInt32(&calls, 1); return nil, myErr }
+		endpoints = sd.FixedEndpointer{e}
+		hedge     = lb.Hedge(2, lb.FixedHedgeDelay(time.Hour), lb.NewRoundRobin(endpoints))
+	)
+
+	// Failed attempts are followed up right away, without waiting an hour.
+	if _, err := hedge(context.Background(), struct{}{}); err != myErr {
+		t.Errorf("want %v, have %v", myErr, err)
+	}
+	if want, have := int32(3), atomic.LoadInt32(&calls); want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+}
+
+func TestPercentileHedgeDelay(t *testing.T) {
+	delay := lb.PercentileHedgeDelay(90, 10, time.Second)
+	if want, have := time.Second, delay.Delay(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	for i := 1; i <= 10; i++ {
+		delay.Observe(time.Duration(i) * time.Millisecond)
+	}
+	if want, have := 10*time.Millisecond, delay.Delay(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	for i := 0; i < 10; i++ {
+		delay.Observe(time.Millisecond)
+	}
+	if want, have := time.Millisecond, delay.Delay(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestRequestHedgeDistinctEndpoints(t *testing.T) {
+	var (
+		instances = instanceEndpointer(3)
+		calls     = make(chan string, 3)
+		slow      = make(sd.FixedInstanceEndpointer, len(instances))
+	)
+	for i, ie := range instances {
+		instance, e := ie.Instance, ie.Endpoint
+		slow[i] = sd.InstanceEndpoint{Instance: instance, Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+			calls <- instance
+			<-ctx.Done()
+			return e(ctx, request)
+		}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	hedge := lb.RequestHedge(2, lb.FixedHedgeDelay(time.Millisecond), lb.NewConsistentHash(slow, 0, requestKey))
+	hedge(ctx, "key")
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		instance := <-calls
+		if seen[instance] {
+			t.Errorf("%s called twice", instance)
+		}
+		seen[instance] = true
+	}
+}
+
+func TestHedgeNegativeMax(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic for negative max")
+		}
+	}()
+	lb.Hedge(-1, lb.FixedHedgeDelay(time.Millisecond), lb.NewRoundRobin(sd.FixedEndpointer{}))
+}
+
+type recordingHedgeDelay struct {
+	mtx       sync.Mutex
+	latencies []time.Duration
+}
+
+func (d *recordingHedgeDelay) Delay() time.Duration { return 10 * time.Millisecond }
+
+func (d *recordingHedgeDelay) Observe(latency time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.latencies = append(d.latencies, latency)
+}
+
+func TestHedgeObservesOutstandingAttempts(t *testing.T) {
+	var (
+		slow = func(ctx context.Context, _ interface{}) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		fast  = func(context.Context, interface{}) (interface{}, error) { return "fast", nil }
+		delay = &recordingHedgeDelay{}
+		hedge = lb.Hedge(1, delay, lb.NewRoundRobin(sd.FixedEndpointer{slow, fast}))
+	)
+	if _, err := hedge(context.Background(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	delay.mtx.Lock()
+	defer delay.mtx.Unlock()
+	if want, have := 2, len(delay.latencies); want != have {
+		t.Fatalf("want %d observations, have %d", want, have)
+	}
+	if slowest := delay.latencies[1]; slowest < 10*time.Millisecond {
+		t.Errorf("want the slow attempt observed at least at the delay, have %v", slowest)
+	}
+}
@@ -0,0 +1,57 @@
+package lb
+
+import (
+	"sync/atomic"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+// NewLeastLoaded returns a load balancer that selects the service with the
+// fewest outstanding requests. Ties are broken by the lowest moving average
+// latency, and then in sequence. Load is tracked per instance through the
+// returned endpoints, and survives updates from the service discovery system
+// when s implements sd.InstanceEndpointer.
+func NewLeastLoaded(s sd.Endpointer) Balancer {
+	return &leastLoaded{
+		s:     s,
+		loads: newLoads(),
+	}
+}
+
+type leastLoaded struct {
+	s     sd.Endpointer
+	loads *loads
+	c     uint64
+}
+
+func (ll *leastLoaded) Endpoint() (endpoint.Endpoint, error) {
+	instanceEndpoints, err := instanceEndpoints(ll.s)
+	if err != nil {
+		return nil, err
+	}
+	if len(instanceEndpoints) <= 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	var (
+		loads  = ll.loads.get(instanceEndpoints)
+		n      = uint64(len(loads))
+		offset = (atomic.AddUint64(&ll.c, 1) - 1) % n
+		best   = offset
+	)
+	for i := uint64(1); i < n; i++ {
+		idx := (offset + i) % n
+		if lessLoaded(loads[idx], loads[best]) {
+			best = idx
+		}
+	}
+	return loads[best].track(instanceEndpoints[best].Endpoint), nil
+}
+
+func lessLoaded(a, b *load) bool {
+	if ap, bp := a.Pending(), b.Pending(); ap != bp {
+		return ap < bp
+	}
+	return a.Latency() < b.Latency()
+}
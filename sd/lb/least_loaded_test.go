@@ -0,0 +1,134 @@
+package lb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+func TestLeastLoadedAvoidsPending(t *testing.T) {
+	var (
+		block     = make(chan struct{})
+		counts    = make([]int, 3)
+		endpoints = make([]endpoint.Endpoint, 3)
+	)
+	for i := range endpoints {
+		i0 := i
+		endpoints[i] = func(context.Context, interface{}) (interface{}, error) {
+			counts[i0]++
+			<-block
+			return struct{}{}, nil
+		}
+	}
+
+	balancer := NewLeastLoaded(sd.FixedEndpointer(endpoints))
+
+	// Each of the first three requests should go to an idle endpoint.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() { defer wg.Done(); e(context.Background(), struct{}{}) }()
+		waitPending(t, balancer.(*leastLoaded).loads, int64(i+1))
+	}
+	close(block)
+	wg.Wait()
+
+	for i, have := range counts {
+		if want := 1; want != have {
+			t.Errorf("%d: want %d, have %d", i, want, have)
+		}
+	}
+}
+
+func TestLeastLoadedKeepsStateAcrossUpdates(t *testing.T) {
+	var (
+		block      = make(chan struct{})
+		blocking   = func(context.Context, interface{}) (interface{}, error) { <-block; return struct{}{}, nil }
+		endpointer = &mutableEndpointer{}
+		balancer   = NewLeastLoaded(endpointer)
+	)
+	defer close(block)
+
+	endpointer.set(sd.FixedInstanceEndpointer{{Instance: "a", Endpoint: blocking}})
+	e, err := balancer.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go e(context.Background(), struct{}{})
+	waitPending(t, balancer.(*leastLoaded).loads, 1)
+
+	// Add an instance that sorts after a, the busy one.
+	var picked bool
+	endpointer.set(sd.FixedInstanceEndpointer{
+		{Instance: "a", Endpoint: blocking},
+		{Instance: "b", Endpoint: func(context.Context, interface{}) (interface{}, error) { picked = true; return struct{}{}, nil }},
+	})
+	for i := 0; i < 4; i++ {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked = false
+		e(context.Background(), struct{}{})
+		if !picked {
+			t.Fatalf("%d: want b, have a", i)
+		}
+	}
+}
+
+func TestLeastLoadedNoEndpoints(t *testing.T) {
+	balancer := NewLeastLoaded(sd.FixedEndpointer{})
+	_, err := balancer.Endpoint()
+	if want, have := ErrNoEndpoints, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+type mutableEndpointer struct {
+	mtx sync.Mutex
+	sd.FixedInstanceEndpointer
+}
+
+func (m *mutableEndpointer) set(s sd.FixedInstanceEndpointer) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.FixedInstanceEndpointer = s
+}
+
+func (m *mutableEndpointer) Endpoints() ([]endpoint.Endpoint, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.FixedInstanceEndpointer.Endpoints()
+}
+
+func (m *mutableEndpointer) InstanceEndpoints() ([]sd.InstanceEndpoint, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.FixedInstanceEndpointer.InstanceEndpoints()
+}
+
+// waitPending spins until the total number of in-flight requests reaches want.
+func waitPending(t *testing.T, ls *loads, want int64) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		ls.mtx.Lock()
+		var have int64
+		for _, l := range ls.m {
+			have += l.Pending()
+		}
+		ls.mtx.Unlock()
+		if have == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d pending requests", want)
+}
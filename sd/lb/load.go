@@ -0,0 +1,162 @@
+package lb
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+// ewmaWeight is the weight given to each new latency observation in the
+// exponentially weighted moving average kept per instance.
+const ewmaWeight = 0.3
+
+// ewmaDecay is the time constant with which the moving average decays
+// towards zero while an instance has no completed requests, so that an
+// instance that was slow once is tried again eventually.
+const ewmaDecay = 10 * time.Second
+
+// unmeasuredLatency is the latency assumed for instances with requests in
+// flight but none completed yet, so that an instance that never completes a
+// request, e.g. a hung one, doesn't take all the traffic.
+const unmeasuredLatency = time.Second
+
+// instanceEndpoints returns the current endpoints of s along with a stable
+// identity for each. Endpointers that implement sd.InstanceEndpointer are keyed
+// by instance string, so per-instance state survives updates from the service
+// discovery system. Other Endpointers are keyed by position, which is only
+// stable as long as the set of endpoints doesn't change.
+func instanceEndpoints(s sd.Endpointer) ([]sd.InstanceEndpoint, error) {
+	if ie, ok := s.(sd.InstanceEndpointer); ok {
+		return ie.InstanceEndpoints()
+	}
+	endpoints, err := s.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	instanceEndpoints := make([]sd.InstanceEndpoint, len(endpoints))
+	for i, e := range endpoints {
+		instanceEndpoints[i] = sd.InstanceEndpoint{Instance: strconv.Itoa(i), Endpoint: e}
+	}
+	return instanceEndpoints, nil
+}
+
+// load tracks the number of in-flight requests and the moving average latency
+// of a single instance.
+type load struct {
+	pending int64 // accessed atomically, keep first for alignment
+
+	mtx      sync.Mutex
+	ewma     time.Duration
+	observed time.Time // of the last completed request
+}
+
+// Pending returns the number of requests currently in flight.
+func (l *load) Pending() int64 {
+	return atomic.LoadInt64(&l.pending)
+}
+
+// Latency returns the moving average latency, decayed for the time since the
+// last request completed, or zero if no request has completed yet.
+func (l *load) Latency() time.Duration {
+	return l.latency(time.Now())
+}
+
+func (l *load) latency(now time.Time) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.decayed(now)
+}
+
+// decayed must be called with the mutex held.
+func (l *load) decayed(now time.Time) time.Duration {
+	idle := now.Sub(l.observed)
+	if l.ewma == 0 || idle <= 0 {
+		return l.ewma
+	}
+	return time.Duration(float64(l.ewma) * math.Exp(-float64(idle)/float64(ewmaDecay)))
+}
+
+// Cost estimates the latency a new request would see, given the requests
+// already in flight. Instances with no observations and nothing in flight
+// have zero cost, so they are tried promptly; once they have requests in
+// flight, unmeasuredLatency is assumed until one completes.
+func (l *load) Cost() float64 {
+	return l.cost(time.Now())
+}
+
+func (l *load) cost(now time.Time) float64 {
+	latency, pending := l.latency(now), l.Pending()
+	if latency == 0 && pending > 0 {
+		latency = unmeasuredLatency
+	}
+	return float64(latency) * float64(pending+1)
+}
+
+func (l *load) observe(d time.Duration, now time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.ewma == 0 {
+		l.ewma, l.observed = d, now
+		return
+	}
+	l.ewma = time.Duration(ewmaWeight*float64(d) + (1-ewmaWeight)*float64(l.decayed(now)))
+	l.observed = now
+}
+
+// track wraps e so that every request through it is accounted against l.
+func (l *load) track(e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		atomic.AddInt64(&l.pending, 1)
+		defer func(begin time.Time) {
+			now := time.Now()
+			l.observe(now.Sub(begin), now)
+			atomic.AddInt64(&l.pending, -1)
+		}(time.Now())
+		return e(ctx, request)
+	}
+}
+
+// loads holds the load of every known instance, keyed by instance string.
+type loads struct {
+	mtx sync.Mutex
+	m   map[string]*load
+}
+
+func newLoads() *loads {
+	return &loads{m: map[string]*load{}}
+}
+
+// get returns the load of each of the given instances, in the same order.
+// Instances seen for the first time start with no load, and instances that
+// are no longer present are forgotten.
+func (ls *loads) get(instanceEndpoints []sd.InstanceEndpoint) []*load {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	result := make([]*load, len(instanceEndpoints))
+	for i, ie := range instanceEndpoints {
+		l, ok := ls.m[ie.Instance]
+		if !ok {
+			l = &load{}
+			ls.m[ie.Instance] = l
+		}
+		result[i] = l
+	}
+
+	// Instance strings are unique, so a larger map means stale entries.
+	if len(ls.m) > len(instanceEndpoints) {
+		m := make(map[string]*load, len(instanceEndpoints))
+		for i, ie := range instanceEndpoints {
+			m[ie.Instance] = result[i]
+		}
+		ls.m = m
+	}
+
+	return result
+}
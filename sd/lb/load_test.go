@@ -0,0 +1,53 @@
+package lb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadCostUnmeasured(t *testing.T) {
+	var (
+		now      = time.Now()
+		fast     = &load{}
+		hung     = &load{}
+		measured = 10 * time.Millisecond
+	)
+	fast.observe(measured, now)
+	if want, have := float64(0), hung.cost(now); want != have {
+		t.Errorf("want idle unmeasured instance to cost %v, have %v", want, have)
+	}
+
+	// An instance that never completes a request loses once it has one in
+	// flight.
+	hung.pending = 1
+	if fast.cost(now) >= hung.cost(now) {
+		t.Errorf("want hung instance (%v) to cost more than measured one (%v)", hung.cost(now), fast.cost(now))
+	}
+	hung.pending = 2
+	if want, have := float64(3*unmeasuredLatency), hung.cost(now); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestLoadDecay(t *testing.T) {
+	var (
+		now = time.Now()
+		l   = &load{}
+	)
+	l.observe(time.Second, now)
+	if want, have := time.Second, l.latency(now); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// The latency of an instance without completed requests decays.
+	later := now.Add(ewmaDecay)
+	if have := l.latency(later); have >= 400*time.Millisecond {
+		t.Errorf("want latency decayed to about %v, have %v", 368*time.Millisecond, have)
+	}
+
+	// New observations are averaged with the decayed latency.
+	l.observe(10*time.Millisecond, later.Add(10*ewmaDecay))
+	if have := l.latency(later.Add(10 * ewmaDecay)); have >= 20*time.Millisecond {
+		t.Errorf("want latency close to %v, have %v", 10*time.Millisecond, have)
+	}
+}
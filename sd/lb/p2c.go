@@ -0,0 +1,57 @@
+package lb
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+// NewP2C returns a load balancer that implements the "power of two random
+// choices" strategy. It picks two services at random and selects the one with
+// the lower estimated cost, which is the moving average latency weighted by
+// the number of outstanding requests. Load is tracked per instance through the
+// returned endpoints, and survives updates from the service discovery system
+// when s implements sd.InstanceEndpointer.
+func NewP2C(s sd.Endpointer, seed int64) Balancer {
+	return &p2c{
+		s:     s,
+		r:     rand.New(rand.NewSource(seed)),
+		loads: newLoads(),
+	}
+}
+
+type p2c struct {
+	s     sd.Endpointer
+	mtx   sync.Mutex // protects r
+	r     *rand.Rand
+	loads *loads
+}
+
+func (p *p2c) Endpoint() (endpoint.Endpoint, error) {
+	instanceEndpoints, err := instanceEndpoints(p.s)
+	if err != nil {
+		return nil, err
+	}
+	if len(instanceEndpoints) <= 0 {
+		return nil, ErrNoEndpoints
+	}
+	if len(instanceEndpoints) == 1 {
+		return p.loads.get(instanceEndpoints)[0].track(instanceEndpoints[0].Endpoint), nil
+	}
+
+	p.mtx.Lock()
+	a := p.r.Intn(len(instanceEndpoints))
+	b := p.r.Intn(len(instanceEndpoints) - 1)
+	p.mtx.Unlock()
+	if b >= a {
+		b++ // distinct from a
+	}
+
+	loads := p.loads.get(instanceEndpoints)
+	if loads[b].Cost() < loads[a].Cost() {
+		a = b
+	}
+	return loads[a].track(instanceEndpoints[a].Endpoint), nil
+}
@@ -0,0 +1,63 @@
+package lb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+)
+
+func TestP2CPrefersFasterEndpoints(t *testing.T) {
+	var (
+		counts    = make([]int, 3)
+		delays    = []time.Duration{0, 0, 5 * time.Millisecond}
+		endpoints = make([]endpoint.Endpoint, len(delays))
+	)
+	for i := range endpoints {
+		i0 := i
+		endpoints[i] = func(context.Context, interface{}) (interface{}, error) {
+			counts[i0]++
+			time.Sleep(delays[i0])
+			return struct{}{}, nil
+		}
+	}
+
+	balancer := NewP2C(sd.FixedEndpointer(endpoints), 12345)
+	for i := 0; i < 300; i++ {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e(context.Background(), struct{}{})
+	}
+
+	// Once measured, the slow endpoint should lose every comparison.
+	if slow, fast := counts[2], counts[0]+counts[1]; slow*10 > fast {
+		t.Errorf("slow endpoint got %d requests, fast endpoints got %d", slow, fast)
+	}
+}
+
+func TestP2CSingleEndpoint(t *testing.T) {
+	var called bool
+	balancer := NewP2C(sd.FixedEndpointer{
+		func(context.Context, interface{}) (interface{}, error) { called = true; return struct{}{}, nil },
+	}, 1)
+	e, err := balancer.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e(context.Background(), struct{}{})
+	if !called {
+		t.Error("endpoint not called")
+	}
+}
+
+func TestP2CNoEndpoints(t *testing.T) {
+	balancer := NewP2C(sd.FixedEndpointer{}, 1415926)
+	_, err := balancer.Endpoint()
+	if want, have := ErrNoEndpoints, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
@@ -3,7 +3,9 @@ package lb
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
@@ -12,8 +14,15 @@ import (
 // RetryError is an error wrapper that is used by the retry mechanism. All
 // errors returned by the retry mechanism via its endpoint will be RetryErrors.
 type RetryError struct {
-	RawErrors []error // all errors encountered from endpoints directly
-	Final     error   // the final, terminating error
+	RawErrors []error   // all errors encountered from endpoints directly
+	Final     error     // the final, terminating error
+	Attempts  []Attempt // timings of the failed attempts, in the same order as RawErrors
+}
+
+// Attempt records the timing of a single attempt made by the retry mechanism.
+type Attempt struct {
+	Start    time.Time
+	Duration time.Duration
 }
 
 func (e RetryError) Error() string {
@@ -28,6 +37,12 @@ func (e RetryError) Error() string {
 	return fmt.Sprintf("%v%s", e.Final, suffix)
 }
 
+// Unwrap returns the final error, so that it can be inspected with errors.Is
+// and errors.As.
+func (e RetryError) Unwrap() error {
+	return e.Final
+}
+
 // Callback is a function that is given the current attempt count and the error
 // received from the underlying endpoint. It should return whether the Retry
 // function should continue trying to get a working endpoint, and a custom error
@@ -41,8 +56,8 @@ type Callback func(n int, received error) (keepTrying bool, replacement error)
 // automatically load balanced via the load balancer. Requests that return
 // errors will be retried until they succeed, up to max times, or until the
 // timeout is elapsed, whichever comes first.
-func Retry(max int, timeout time.Duration, b Balancer) endpoint.Endpoint {
-	return RetryWithCallback(timeout, b, maxRetries(max))
+func Retry(max int, timeout time.Duration, b Balancer, options ...RetryOption) endpoint.Endpoint {
+	return RetryWithCallback(timeout, b, maxRetries(max), options...)
 }
 
 func maxRetries(max int) Callback {
@@ -55,18 +70,161 @@ func alwaysRetry(int, error) (keepTrying bool, replacement error) {
 	return true, nil
 }
 
+// RetryIf returns a Callback that keeps trying as long as fewer than max
+// attempts have been made and the received error is retryable. Helpers like
+// transport/http.RetryableStatus and transport/grpc.RetryableCodes may be
+// used as the predicate.
+func RetryIf(max int, retryable func(err error) bool) Callback {
+	return func(n int, err error) (keepTrying bool, replacement error) {
+		return n < max && retryable(err), nil
+	}
+}
+
+// RetryOption sets an optional parameter for the retry mechanism.
+type RetryOption func(*retryOptions)
+
+// RetryBackoff sets the function deciding how long to wait after a failed
+// attempt before making the next one. By default, the next attempt is made
+// right away.
+func RetryBackoff(backoff Backoff) RetryOption {
+	return func(o *retryOptions) { o.backoff = backoff }
+}
+
+// RetryBudget sets a budget shared by every call through the endpoint, or by
+// several endpoints, that caps the number of retries. When the budget is
+// exhausted, the last error is returned as the final one.
+func RetryBudget(budget *Budget) RetryOption {
+	return func(o *retryOptions) { o.budget = budget }
+}
+
+type retryOptions struct {
+	backoff Backoff
+	budget  *Budget
+}
+
+// Backoff returns how long to wait after the given failed attempt, starting
+// at 1, before making the next one.
+type Backoff func(attempt int) time.Duration
+
+// ExponentialBackoff returns a Backoff that waits for a random duration
+// between zero and base times two to the power of the number of failed
+// attempts minus one, capped at max. This is known as "full jitter", and
+// prevents clients that failed at the same time from retrying in lockstep.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := max
+		if shift := uint(attempt - 1); shift < 63 {
+			if b := base << shift; b > 0 && b < max {
+				d = b
+			}
+		}
+		if d <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+// Budget is a token bucket that limits retries to a share of the requests
+// made, so that a degraded dependency doesn't trigger a retry storm. Every
+// request deposits ratio tokens, and every retry withdraws one. A Budget is
+// safe for concurrent use and is meant to be shared.
+type Budget struct {
+	ratio        float64
+	minPerSecond float64
+	max          float64
+
+	mtx     sync.Mutex
+	tokens  float64
+	last    time.Time
+	timeNow func() time.Time
+}
+
+// NewBudget returns a Budget that allows retries for up to ratio of the
+// requests, e.g. 0.1 for 10%, plus minPerSecond retries per second regardless
+// of the number of requests, so that clients with little traffic can still
+// retry. Unused tokens accumulate up to burst.
+func NewBudget(ratio, minPerSecond float64, burst int) *Budget {
+	return &Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		max:          float64(burst),
+		tokens:       float64(burst),
+		last:         time.Now(),
+		timeNow:      time.Now,
+	}
+}
+
+func (b *Budget) deposit() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.add(b.ratio)
+}
+
+func (b *Budget) withdraw() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.add(0)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// add must be called with the mutex held.
+func (b *Budget) add(tokens float64) {
+	now := b.timeNow()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		tokens += elapsed.Seconds() * b.minPerSecond
+	}
+	b.last = now
+	b.tokens += tokens
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
 // RetryWithCallback wraps a service load balancer and returns an endpoint
 // oriented load balancer for the specified service method. Requests to the
 // endpoint will be automatically load balanced via the load balancer. Requests
 // that return errors will be retried until they succeed, up to max times, until
 // the callback returns false, or until the timeout is elapsed, whichever comes
 // first.
-func RetryWithCallback(timeout time.Duration, b Balancer, cb Callback) endpoint.Endpoint {
+func RetryWithCallback(timeout time.Duration, b Balancer, cb Callback, options ...RetryOption) endpoint.Endpoint {
+	if b == nil {
+		panic("nil Balancer")
+	}
+	return retry(timeout, func(context.Context, interface{}) (endpoint.Endpoint, error) {
+		return b.Endpoint()
+	}, cb, options)
+}
+
+// RequestRetry is like Retry, but for a RequestBalancer. Each attempt asks the
+// balancer for an endpoint given the request, and the attempt number is made
+// available to the balancer via the context, so that balancers which always
+// pick the same endpoint for a request, like NewConsistentHash, can fail over
+// to another one.
+func RequestRetry(max int, timeout time.Duration, b RequestBalancer, options ...RetryOption) endpoint.Endpoint {
+	return RequestRetryWithCallback(timeout, b, maxRetries(max), options...)
+}
+
+// RequestRetryWithCallback is like RetryWithCallback, but for a
+// RequestBalancer. See RequestRetry for details.
+func RequestRetryWithCallback(timeout time.Duration, b RequestBalancer, cb Callback, options ...RetryOption) endpoint.Endpoint {
+	if b == nil {
+		panic("nil RequestBalancer")
+	}
+	return retry(timeout, b.Endpoint, cb, options)
+}
+
+func retry(timeout time.Duration, pick func(context.Context, interface{}) (endpoint.Endpoint, error), cb Callback, options []RetryOption) endpoint.Endpoint {
 	if cb == nil {
 		cb = alwaysRetry
 	}
-	if b == nil {
-		panic("nil Balancer")
+	var opts retryOptions
+	for _, option := range options {
+		option(&opts)
 	}
 
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
@@ -78,9 +236,14 @@ func RetryWithCallback(timeout time.Duration, b Balancer, cb Callback) endpoint.
 		)
 		defer cancel()
 
+		if opts.budget != nil {
+			opts.budget.deposit()
+		}
+
 		for i := 1; ; i++ {
-			go func() {
-				e, err := b.Endpoint()
+			begin := time.Now()
+			go func(attemptctx context.Context) {
+				e, err := pick(attemptctx, request)
 				if err != nil {
 					errs <- err
 					return
@@ -91,7 +254,7 @@ func RetryWithCallback(timeout time.Duration, b Balancer, cb Callback) endpoint.
 					return
 				}
 				responses <- response
-			}()
+			}(context.WithValue(newctx, attemptKey, i))
 
 			select {
 			case <-newctx.Done():
@@ -102,16 +265,54 @@ func RetryWithCallback(timeout time.Duration, b Balancer, cb Callback) endpoint.
 
 			case err := <-errs:
 				final.RawErrors = append(final.RawErrors, err)
+				final.Attempts = append(final.Attempts, Attempt{Start: begin, Duration: time.Since(begin)})
 				keepTrying, replacement := cb(i, err)
 				if replacement != nil {
 					err = replacement
 				}
-				if !keepTrying {
+				if !keepTrying || (opts.budget != nil && !opts.budget.withdraw()) {
 					final.Final = err
 					return nil, final
 				}
+				if opts.backoff != nil {
+					if err := sleep(newctx, opts.backoff(i)); err != nil {
+						return nil, err
+					}
+				}
 				continue
 			}
 		}
 	}
 }
+
+// sleep waits for d, or until ctx is done, in which case it returns the
+// context's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type contextKey int
+
+const (
+	attemptKey contextKey = iota
+	nonIdempotentKey
+)
+
+// attempt returns the 1-based attempt number set by the retry mechanism, or 1
+// if the context wasn't created by it.
+func attempt(ctx context.Context) int {
+	if n, ok := ctx.Value(attemptKey).(int); ok {
+		return n
+	}
+	return 1
+}
@@ -139,3 +139,138 @@ func TestHandleNilCallback(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRetryAttemptTimings(t *testing.T) {
+	var (
+		myErr = errors.New("fail")
+		e     = func(context.Context, interface{}) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return nil, myErr
+		}
+		endpoints = sd.FixedEndpointer{e}
+		retry     = lb.Retry(3, time.Second, lb.NewRoundRobin(endpoints))
+	)
+	_, err := retry(context.Background(), struct{}{})
+	var retryErr lb.RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("want RetryError, have %v", err)
+	}
+	if want, have := 3, len(retryErr.Attempts); want != have {
+		t.Fatalf("want %d attempts, have %d", want, have)
+	}
+	for i, a := range retryErr.Attempts {
+		if a.Duration < time.Millisecond {
+			t.Errorf("attempt %d: want at least 1ms, have %v", i, a.Duration)
+		}
+		if i > 0 && a.Start.Before(retryErr.Attempts[i-1].Start) {
+			t.Errorf("attempt %d: started before attempt %d", i, i-1)
+		}
+	}
+	if !errors.Is(err, myErr) {
+		t.Errorf("want errors.Is(err, %v)", myErr)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var (
+		attempts  []int
+		e         = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		backoff   = func(n int) time.Duration { attempts = append(attempts, n); return 10 * time.Millisecond }
+		endpoints = sd.FixedEndpointer{e}
+		retry     = lb.Retry(3, time.Second, lb.NewRoundRobin(endpoints), lb.RetryBackoff(backoff))
+		begin     = time.Now()
+	)
+	if _, err := retry(context.Background(), struct{}{}); err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := 20*time.Millisecond, time.Since(begin); have < want {
+		t.Errorf("want at least %v, have %v", want, have)
+	}
+	if want, have := []int{1, 2}, attempts; len(want) != len(have) || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestRetryBackoffTimeout(t *testing.T) {
+	var (
+		e         = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		endpoints = sd.FixedEndpointer{e}
+		backoff   = lb.ExponentialBackoff(time.Hour, time.Hour)
+		retry     = lb.Retry(3, 10*time.Millisecond, lb.NewRoundRobin(endpoints), lb.RetryBackoff(backoff))
+	)
+	if _, err := retry(context.Background(), struct{}{}); err != context.DeadlineExceeded {
+		t.Errorf("want %v, have %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	var (
+		base    = time.Millisecond
+		max     = 10 * time.Millisecond
+		backoff = lb.ExponentialBackoff(base, max)
+	)
+	for attempt, ceiling := range map[int]time.Duration{
+		1:   base,
+		2:   2 * base,
+		3:   4 * base,
+		4:   8 * base,
+		5:   max,
+		100: max,
+	} {
+		for i := 0; i < 100; i++ {
+			if d := backoff(attempt); d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: want between 0 and %v, have %v", attempt, ceiling, d)
+			}
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var (
+		calls     int
+		e         = func(context.Context, interface{}) (interface{}, error) { calls++; return nil, errors.New("fail") }
+		endpoints = sd.FixedEndpointer{e}
+		budget    = lb.NewBudget(0.5, 0, 1)
+		retry     = lb.Retry(10, time.Second, lb.NewRoundRobin(endpoints), lb.RetryBudget(budget))
+	)
+
+	// The initial burst allows a single retry, plus half a token deposited by
+	// the request itself.
+	retry(context.Background(), struct{}{})
+	if want, have := 2, calls; want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+
+	// Every other request may retry once.
+	calls = 0
+	for i := 0; i < 4; i++ {
+		retry(context.Background(), struct{}{})
+	}
+	if want, have := 6, calls; want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+}
+
+func TestRetryIf(t *testing.T) {
+	var (
+		calls     int
+		retryable = errors.New("retryable")
+		permanent = errors.New("permanent")
+		e         = func(context.Context, interface{}) (interface{}, error) {
+			if calls++; calls < 3 {
+				return nil, retryable
+			}
+			return nil, permanent
+		}
+		endpoints = sd.FixedEndpointer{e}
+		cb        = lb.RetryIf(10, func(err error) bool { return err == retryable })
+		retry     = lb.RetryWithCallback(time.Second, lb.NewRoundRobin(endpoints), cb)
+	)
+	_, err := retry(context.Background(), struct{}{})
+	if want, have := permanent, err.(lb.RetryError).Final; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 3, calls; want != have {
+		t.Errorf("want %d calls, have %d", want, have)
+	}
+}
@@ -0,0 +1,318 @@
+package sd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// OutlierEndpointer decorates an InstanceEndpointer with passive outlier
+// detection. It watches the result of every call made through the endpoints it
+// yields, and temporarily ejects instances that fail too often, so that they
+// are no longer yielded until their ejection expires.
+type OutlierEndpointer struct {
+	src     InstanceEndpointer
+	options outlierOptions
+	logger  log.Logger
+	timeNow func() time.Time
+
+	mtx       sync.Mutex
+	instances map[string]*outlierInstance
+	ejected   int
+}
+
+// OutlierOption allows control of OutlierEndpointer behavior.
+type OutlierOption func(*outlierOptions)
+
+// ConsecutiveFailures ejects an instance after n consecutive failed calls.
+// By default, n is 5. Zero disables this check.
+func ConsecutiveFailures(n int) OutlierOption {
+	return func(opts *outlierOptions) { opts.consecutiveFailures = n }
+}
+
+// FailureRate ejects an instance when the ratio of failed calls among its last
+// window calls reaches threshold, between 0 and 1. By default, this check is
+// disabled.
+func FailureRate(threshold float64, window int) OutlierOption {
+	return func(opts *outlierOptions) {
+		opts.failureRate = threshold
+		opts.failureWindow = window
+	}
+}
+
+// EjectionBackoff sets how long an instance stays ejected. The duration starts
+// at base, doubles every time the same instance is ejected again, and is
+// capped at max. It resets only once the instance has stayed in service for
+// max since its last ejection, and has served enough consecutive successful
+// calls to be considered healthy again, so that a flapping instance keeps
+// being ejected for longer. By default, base is 30 seconds and max is 5
+// minutes.
+func EjectionBackoff(base, max time.Duration) OutlierOption {
+	return func(opts *outlierOptions) {
+		opts.baseEjection = base
+		opts.maxEjection = max
+	}
+}
+
+// MaxEjectionPercent caps the share of instances that may be ejected at the
+// same time, between 0 and 100. Failing instances beyond the cap remain in
+// use. Unless the percentage is 0, one instance may always be ejected, so
+// that small pools, down to a single instance, eject outliers too. By
+// default, at most 50 percent of instances are ejected.
+func MaxEjectionPercent(percent int) OutlierOption {
+	return func(opts *outlierOptions) { opts.maxEjectionPercent = percent }
+}
+
+// OutlierFailure sets the predicate deciding whether the error returned by a
+// call counts as a failure. By default, every non-nil error counts.
+func OutlierFailure(isFailure func(error) bool) OutlierOption {
+	return func(opts *outlierOptions) { opts.isFailure = isFailure }
+}
+
+// EjectionCounter sets a counter that's incremented every time an instance is
+// ejected.
+func EjectionCounter(c metrics.Counter) OutlierOption {
+	return func(opts *outlierOptions) { opts.ejections = c }
+}
+
+type outlierOptions struct {
+	consecutiveFailures int
+	failureRate         float64
+	failureWindow       int
+	baseEjection        time.Duration
+	maxEjection         time.Duration
+	maxEjectionPercent  int
+	isFailure           func(error) bool
+	ejections           metrics.Counter
+}
+
+// NewOutlierEndpointer returns an OutlierEndpointer that yields the endpoints
+// of src, minus the ones currently ejected. Ejections and returns to service
+// are logged to logger. The returned OutlierEndpointer is itself an
+// InstanceEndpointer, so it can be used with load balancers that keep
+// per-instance state.
+func NewOutlierEndpointer(src InstanceEndpointer, logger log.Logger, options ...OutlierOption) *OutlierEndpointer {
+	opts := outlierOptions{
+		consecutiveFailures: 5,
+		baseEjection:        30 * time.Second,
+		maxEjection:         5 * time.Minute,
+		maxEjectionPercent:  50,
+		isFailure:           func(err error) bool { return err != nil },
+		ejections:           discard.NewCounter(),
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return &OutlierEndpointer{
+		src:       src,
+		options:   opts,
+		logger:    logger,
+		timeNow:   time.Now,
+		instances: map[string]*outlierInstance{},
+	}
+}
+
+// Endpoints implements Endpointer.
+func (oe *OutlierEndpointer) Endpoints() ([]endpoint.Endpoint, error) {
+	instanceEndpoints, err := oe.InstanceEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]endpoint.Endpoint, len(instanceEndpoints))
+	for i, ie := range instanceEndpoints {
+		endpoints[i] = ie.Endpoint
+	}
+	return endpoints, nil
+}
+
+// InstanceEndpoints implements InstanceEndpointer.
+func (oe *OutlierEndpointer) InstanceEndpoints() ([]InstanceEndpoint, error) {
+	instanceEndpoints, err := oe.src.InstanceEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	oe.mtx.Lock()
+	defer oe.mtx.Unlock()
+
+	oe.forget(instanceEndpoints)
+	oe.readmit(oe.timeNow())
+
+	result := make([]InstanceEndpoint, 0, len(instanceEndpoints))
+	for _, ie := range instanceEndpoints {
+		inst, ok := oe.instances[ie.Instance]
+		if !ok {
+			inst = &outlierInstance{}
+			oe.instances[ie.Instance] = inst
+		}
+		if !inst.ejectedUntil.IsZero() {
+			continue
+		}
+		result = append(result, InstanceEndpoint{
+			Instance: ie.Instance,
+			Endpoint: oe.observe(ie.Instance, inst, ie.Endpoint),
+		})
+	}
+	return result, nil
+}
+
+// forget drops the state of instances no longer yielded by src. It must be
+// called with the mutex held.
+func (oe *OutlierEndpointer) forget(instanceEndpoints []InstanceEndpoint) {
+	if len(oe.instances) <= len(instanceEndpoints) {
+		return // instance strings are unique, so nothing is stale
+	}
+	current := make(map[string]struct{}, len(instanceEndpoints))
+	for _, ie := range instanceEndpoints {
+		current[ie.Instance] = struct{}{}
+	}
+	for instance, inst := range oe.instances {
+		if _, ok := current[instance]; ok {
+			continue
+		}
+		if !inst.ejectedUntil.IsZero() {
+			oe.ejected--
+		}
+		delete(oe.instances, instance)
+	}
+}
+
+// readmit returns the instances whose ejection has expired to service, so
+// that they count as ejected only for as long as their ejection lasts. It
+// must be called with the mutex held.
+func (oe *OutlierEndpointer) readmit(now time.Time) {
+	if oe.ejected == 0 {
+		return
+	}
+	for instance, inst := range oe.instances {
+		if inst.ejectedUntil.IsZero() || now.Before(inst.ejectedUntil) {
+			continue
+		}
+		inst.ejectedUntil = time.Time{}
+		inst.returned = now
+		oe.ejected--
+		oe.logger.Log("instance", instance, "outlier", "returned")
+	}
+}
+
+// observe wraps e so that the result of every call is recorded against inst.
+func (oe *OutlierEndpointer) observe(instance string, inst *outlierInstance, e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := e(ctx, request)
+		oe.record(instance, inst, oe.options.isFailure(err))
+		return response, err
+	}
+}
+
+func (oe *OutlierEndpointer) record(instance string, inst *outlierInstance, failed bool) {
+	oe.mtx.Lock()
+	defer oe.mtx.Unlock()
+
+	now := oe.timeNow()
+	oe.readmit(now)
+	if oe.instances[instance] != inst || !inst.ejectedUntil.IsZero() {
+		return // late result from an instance that's gone or already ejected
+	}
+
+	inst.push(failed, oe.options.failureWindow)
+	if !failed {
+		inst.consecutiveFailures = 0
+		inst.consecutiveSuccesses++
+		if inst.ejections > 0 && inst.consecutiveSuccesses >= oe.healthyAfter() &&
+			now.Sub(inst.returned) >= oe.options.maxEjection {
+			inst.ejections = 0
+		}
+		return
+	}
+	inst.consecutiveFailures++
+	inst.consecutiveSuccesses = 0
+
+	var reason string
+	switch {
+	case oe.options.consecutiveFailures > 0 && inst.consecutiveFailures >= oe.options.consecutiveFailures:
+		reason = "consecutive failures"
+	case oe.options.failureWindow > 0 && len(inst.window) >= oe.options.failureWindow &&
+		float64(inst.failures)/float64(len(inst.window)) >= oe.options.failureRate:
+		reason = "failure rate"
+	default:
+		return
+	}
+
+	if oe.ejected >= oe.maxEjected() {
+		oe.logger.Log("instance", instance, "outlier", "not ejected", "reason", reason, "err", "max ejection percent reached")
+		return
+	}
+
+	d := oe.options.baseEjection << uint(inst.ejections)
+	if d > oe.options.maxEjection || d <= 0 {
+		d = oe.options.maxEjection
+	}
+	inst.ejections++
+	inst.ejectedUntil = now.Add(d)
+	inst.reset()
+	oe.ejected++
+	oe.options.ejections.Add(1)
+	oe.logger.Log("instance", instance, "outlier", "ejected", "reason", reason, "duration", d)
+}
+
+// maxEjected is the number of instances that may be ejected at the same time.
+func (oe *OutlierEndpointer) maxEjected() int {
+	if oe.options.maxEjectionPercent <= 0 {
+		return 0
+	}
+	if max := len(oe.instances) * oe.options.maxEjectionPercent / 100; max > 1 {
+		return max
+	}
+	return 1
+}
+
+// healthyAfter is the number of consecutive successful calls after which an
+// instance's ejection backoff is reset.
+func (oe *OutlierEndpointer) healthyAfter() int {
+	if n := oe.options.consecutiveFailures; n > 0 {
+		return n
+	}
+	if n := oe.options.failureWindow; n > 0 {
+		return n
+	}
+	return 1
+}
+
+type outlierInstance struct {
+	consecutiveFailures  int
+	consecutiveSuccesses int
+	window               []bool // most recent results, true for failure
+	failures             int    // number of failures in window
+	ejections            int
+	ejectedUntil         time.Time
+	returned             time.Time // when the last ejection expired
+}
+
+// push records a result in the sliding window of the given size.
+func (inst *outlierInstance) push(failed bool, size int) {
+	if size <= 0 {
+		return
+	}
+	if len(inst.window) >= size {
+		if inst.window[0] {
+			inst.failures--
+		}
+		inst.window = inst.window[1:]
+	}
+	inst.window = append(inst.window, failed)
+	if failed {
+		inst.failures++
+	}
+}
+
+func (inst *outlierInstance) reset() {
+	inst.consecutiveFailures = 0
+	inst.consecutiveSuccesses = 0
+	inst.window = nil
+	inst.failures = 0
+}
@@ -0,0 +1,215 @@
+package sd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/generic"
+)
+
+func TestOutlierConsecutiveFailures(t *testing.T) {
+	var (
+		failing    = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		src        = FixedInstanceEndpointer{{"a", endpoint.Nop}, {"b", failing}}
+		counter    = generic.NewCounter("ejections")
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(),
+			ConsecutiveFailures(3),
+			EjectionBackoff(time.Minute, 4*time.Minute),
+			EjectionCounter(counter),
+		)
+		now = time.Now()
+	)
+	endpointer.timeNow = func() time.Time { return now }
+
+	callAll(endpointer, 2)
+	assertInstances(t, endpointer, "a", "b") // not enough failures yet
+
+	callAll(endpointer, 1)
+	assertInstances(t, endpointer, "a")
+	if want, have := 1.0, counter.Value(); want != have {
+		t.Errorf("want %v ejections, have %v", want, have)
+	}
+
+	// Returns once the backoff elapses.
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a", "b")
+
+	// A second ejection lasts twice as long.
+	callAll(endpointer, 3)
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a")
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a", "b")
+}
+
+func TestOutlierFailureRate(t *testing.T) {
+	var (
+		n     int
+		flaky = func(context.Context, interface{}) (interface{}, error) {
+			if n++; n%2 == 0 {
+				return nil, errors.New("fail")
+			}
+			return struct{}{}, nil
+		}
+		src        = FixedInstanceEndpointer{{"a", endpoint.Nop}, {"b", flaky}}
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(), ConsecutiveFailures(0), FailureRate(0.5, 10))
+	)
+
+	callAll(endpointer, 9)
+	assertInstances(t, endpointer, "a", "b") // window not full yet
+
+	callAll(endpointer, 1)
+	assertInstances(t, endpointer, "a")
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	var (
+		failing    = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		src        = FixedInstanceEndpointer{{"a", failing}, {"b", failing}, {"c", failing}, {"d", failing}}
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(), ConsecutiveFailures(1), MaxEjectionPercent(50))
+	)
+
+	for i := 0; i < 4; i++ {
+		callAll(endpointer, 1)
+	}
+	if want, have := 2, len(mustInstanceEndpoints(t, endpointer)); want != have {
+		t.Errorf("want %d instances, have %d", want, have)
+	}
+
+	// One instance may always be ejected, even if it's all of them.
+	for _, tc := range []struct {
+		src     FixedInstanceEndpointer
+		percent int
+		want    int
+	}{
+		{FixedInstanceEndpointer{{"a", failing}}, 50, 0},
+		{FixedInstanceEndpointer{{"a", failing}, {"b", failing}}, 10, 1},
+		{FixedInstanceEndpointer{{"a", failing}}, 0, 1},
+	} {
+		endpointer := NewOutlierEndpointer(tc.src, log.NewNopLogger(), ConsecutiveFailures(1), MaxEjectionPercent(tc.percent))
+		for i := 0; i < len(tc.src); i++ {
+			callAll(endpointer, 1)
+		}
+		if want, have := tc.want, len(mustInstanceEndpoints(t, endpointer)); want != have {
+			t.Errorf("%d instances, %d%%: want %d instances, have %d", len(tc.src), tc.percent, want, have)
+		}
+	}
+}
+
+func TestOutlierForgetsRemovedInstances(t *testing.T) {
+	var (
+		failing    = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		src        = &FixedInstanceEndpointer{{"a", endpoint.Nop}, {"b", failing}}
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(), ConsecutiveFailures(1))
+	)
+
+	callAll(endpointer, 1)
+	assertInstances(t, endpointer, "a")
+
+	// b goes away, and the ejection no longer counts against the cap.
+	*src = FixedInstanceEndpointer{{"a", endpoint.Nop}, {"c", failing}}
+	assertInstances(t, endpointer, "a", "c")
+	callAll(endpointer, 1)
+	assertInstances(t, endpointer, "a")
+}
+
+// callAll calls every endpoint yielded by e n times.
+func callAll(e *OutlierEndpointer, n int) {
+	for i := 0; i < n; i++ {
+		endpoints, _ := e.Endpoints()
+		for _, e := range endpoints {
+			e(context.Background(), struct{}{})
+		}
+	}
+}
+
+func mustInstanceEndpoints(t *testing.T, e InstanceEndpointer) []InstanceEndpoint {
+	t.Helper()
+	instanceEndpoints, err := e.InstanceEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instanceEndpoints
+}
+
+func assertInstances(t *testing.T, e InstanceEndpointer, want ...string) {
+	t.Helper()
+	var have []string
+	for _, ie := range mustInstanceEndpoints(t, e) {
+		have = append(have, ie.Instance)
+	}
+	if len(want) != len(have) {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+	for i := range want {
+		if want[i] != have[i] {
+			t.Fatalf("want %v, have %v", want, have)
+		}
+	}
+}
+
+func TestOutlierFlappingBackoff(t *testing.T) {
+	var (
+		fail     bool
+		flapping = func(context.Context, interface{}) (interface{}, error) {
+			if fail {
+				return nil, errors.New("fail")
+			}
+			return struct{}{}, nil
+		}
+		src        = FixedInstanceEndpointer{{"a", endpoint.Nop}, {"b", flapping}}
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(),
+			ConsecutiveFailures(1),
+			EjectionBackoff(time.Minute, 8*time.Minute),
+		)
+		now = time.Now()
+	)
+	endpointer.timeNow = func() time.Time { return now }
+
+	fail = true
+	callAll(endpointer, 1)
+	now = now.Add(time.Minute)
+
+	// Successes right after a return don't reset the backoff.
+	fail = false
+	callAll(endpointer, 5)
+	fail = true
+	callAll(endpointer, 1)
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a") // ejected for 2 minutes
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a", "b")
+
+	// Staying healthy for the max ejection does.
+	fail = false
+	now = now.Add(8 * time.Minute)
+	callAll(endpointer, 1)
+	fail = true
+	callAll(endpointer, 1)
+	now = now.Add(time.Minute)
+	assertInstances(t, endpointer, "a", "b") // ejected for 1 minute
+}
+
+func TestOutlierReadmitsOnTime(t *testing.T) {
+	var (
+		failing    = func(context.Context, interface{}) (interface{}, error) { return nil, errors.New("fail") }
+		src        = FixedInstanceEndpointer{{"a", failing}, {"b", failing}}
+		endpointer = NewOutlierEndpointer(src, log.NewNopLogger(), ConsecutiveFailures(1), MaxEjectionPercent(50))
+		now        = time.Now()
+	)
+	endpointer.timeNow = func() time.Time { return now }
+
+	endpoints := mustInstanceEndpoints(t, endpointer)
+	endpoints[0].Endpoint(context.Background(), nil) // a is ejected
+	endpoints[1].Endpoint(context.Background(), nil) // b isn't, at the cap
+
+	// Once a's ejection expires, it no longer counts against the cap, even
+	// though no endpoints were requested in between.
+	now = now.Add(time.Minute)
+	endpoints[1].Endpoint(context.Background(), nil)
+	assertInstances(t, endpointer, "a")
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 	"github.com/streadway/amqp"
@@ -248,7 +249,40 @@ func ReplyErrorEncoder(
 	ch Channel,
 	pub *amqp.Publishing,
 ) {
+	response := DefaultErrorResponse{err.Error()}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	pub.Body = b
+
+	publishReply(ctx, deliv, ch, pub)
+}
+
+// ProblemReplyErrorEncoder serializes the error as an RFC 7807 problem details
+// document, with the status and kind classified by the errkind package, and
+// sends the message to the ReplyTo address, with a content type of
+// application/problem+json.
+func ProblemReplyErrorEncoder(
+	ctx context.Context,
+	err error,
+	deliv *amqp.Delivery,
+	ch Channel,
+	pub *amqp.Publishing,
+) {
+	b, err := errkind.ProblemOf(err).MarshalJSON()
+	if err != nil {
+		return
+	}
+	pub.Body = b
+	pub.ContentType = errkind.ProblemContentType
+
+	publishReply(ctx, deliv, ch, pub)
+}
 
+// publishReply publishes pub to the reply address of the delivery.
+func publishReply(ctx context.Context, deliv *amqp.Delivery, ch Channel, pub *amqp.Publishing) {
 	if pub.CorrelationId == "" {
 		pub.CorrelationId = deliv.CorrelationId
 	}
@@ -259,14 +293,6 @@ func ReplyErrorEncoder(
 		replyTo = deliv.ReplyTo
 	}
 
-	response := DefaultErrorResponse{err.Error()}
-
-	b, err := json.Marshal(response)
-	if err != nil {
-		return
-	}
-	pub.Body = b
-
 	ch.Publish(
 		replyExchange,
 		replyTo,
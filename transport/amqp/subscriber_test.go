@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/errkind"
 	amqptransport "github.com/go-kit/kit/transport/amqp"
 	"github.com/streadway/amqp"
 )
@@ -106,6 +107,50 @@ func TestSubscriberBadEndpoint(t *testing.T) {
 	}
 }
 
+// TestProblemReplyErrorEncoder checks that errors are replied as problem
+// details documents.
+func TestProblemReplyErrorEncoder(t *testing.T) {
+	sub := amqptransport.NewSubscriber(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, errkind.New(errkind.Unavailable, "try again")
+		},
+		func(context.Context, *amqp.Delivery) (interface{}, error) { return struct{}{}, nil },
+		func(context.Context, *amqp.Publishing, interface{}) error {
+			return nil
+		},
+		amqptransport.SubscriberErrorEncoder(amqptransport.ProblemReplyErrorEncoder),
+	)
+
+	outputChan := make(chan amqp.Publishing, 1)
+	ch := &mockChannel{f: nullFunc, c: outputChan}
+	sub.ServeDelivery(ch)(&amqp.Delivery{CorrelationId: "1"})
+
+	var msg amqp.Publishing
+	select {
+	case msg = <-outputChan:
+		break
+
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Timed out waiting for publishing")
+	}
+	if want, have := errkind.ProblemContentType, msg.ContentType; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if want, have := "1", msg.CorrelationId; want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	var problem errkind.Problem
+	if err := json.Unmarshal(msg.Body, &problem); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := errkind.Unavailable, problem.Kind; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 503, problem.Status; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
 // TestSubscriberBadEncoder checks if encoder errors are handled properly.
 func TestSubscriberBadEncoder(t *testing.T) {
 	sub := amqptransport.NewSubscriber(
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 )
@@ -86,6 +87,14 @@ func DefaultErrorEncoder(ctx context.Context, err error) ([]byte, error) {
 	return nil, err
 }
 
+// ProblemErrorEncoder encodes the error as the response payload, an RFC 7807
+// problem details document, with the status and kind classified by the
+// errkind package. The invocation itself succeeds, which suits functions
+// behind an API gateway or invoked by other services expecting a payload.
+func ProblemErrorEncoder(ctx context.Context, err error) ([]byte, error) {
+	return errkind.ProblemOf(err).MarshalJSON()
+}
+
 // Invoke represents implementation of the AWS lambda.Handler interface.
 func (h *Handler) Invoke(
 	ctx context.Context,
@@ -8,6 +8,7 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 )
@@ -33,6 +34,17 @@ func TestDefaultErrorEncoder(t *testing.T) {
 	}
 }
 
+func TestProblemErrorEncoder(t *testing.T) {
+	b, err := ProblemErrorEncoder(context.Background(), errkind.Wrap(errkind.NotFound, fmt.Errorf("root")))
+	if err != nil {
+		t.Fatalf("ProblemErrorEncoder should encode the error as the payload, have %v", err)
+	}
+	want := `{"detail":"root","kind":"not_found","status":404,"title":"Not Found","type":"about:blank"}`
+	if have := string(b); want != have {
+		t.Fatalf("want %s, have %s", want, have)
+	}
+}
+
 func TestInvokeHappyPath(t *testing.T) {
 	svc := serviceTest01{}
 
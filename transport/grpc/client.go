@@ -6,7 +6,9 @@ import (
 	"reflect"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/go-kit/kit/endpoint"
 )
@@ -138,3 +140,21 @@ func (c Client) Endpoint() endpoint.Endpoint {
 // Note: err may be nil. There maybe also no additional response parameters depending on
 // when an error occurs.
 type ClientFinalizerFunc func(ctx context.Context, err error)
+
+// RetryableCodes returns a predicate, suitable for sd/lb.RetryIf, that
+// reports whether an error is a gRPC status error with one of the given codes,
+// e.g. codes.Unavailable.
+func RetryableCodes(retryable ...codes.Code) func(err error) bool {
+	return func(err error) bool {
+		s, ok := status.FromError(err)
+		if !ok || s.Code() == codes.OK {
+			return false
+		}
+		for _, code := range retryable {
+			if s.Code() == code {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -2,12 +2,16 @@ package grpc_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"testing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	grpctransport "github.com/go-kit/kit/transport/grpc"
 	test "github.com/go-kit/kit/transport/grpc/_grpc_test"
 	"github.com/go-kit/kit/transport/grpc/_grpc_test/pb"
 )
@@ -59,3 +63,20 @@ func TestGRPCClient(t *testing.T) {
 		t.Fatalf("want %q, have %q", want, have)
 	}
 }
+
+func TestRetryableCodes(t *testing.T) {
+	retryable := grpctransport.RetryableCodes(codes.Unavailable, codes.ResourceExhausted)
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, "unavailable"), true},
+		{status.Error(codes.ResourceExhausted, "exhausted"), true},
+		{status.Error(codes.InvalidArgument, "invalid"), false},
+		{errors.New("not a status"), false},
+	} {
+		if have := retryable(tc.err); tc.want != have {
+			t.Errorf("%v: want %v, have %v", tc.err, tc.want, have)
+		}
+	}
+}
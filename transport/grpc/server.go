@@ -2,11 +2,14 @@ package grpc
 
 import (
 	"context"
+	"errors"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 )
@@ -27,6 +30,7 @@ type Server struct {
 	after        []ServerResponseFunc
 	finalizer    []ServerFinalizerFunc
 	errorHandler transport.ErrorHandler
+	errorEncoder ErrorEncoder
 }
 
 // NewServer constructs a new server, which implements wraps the provided
@@ -45,6 +49,7 @@ func NewServer(
 		dec:          dec,
 		enc:          enc,
 		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		errorEncoder: DefaultErrorEncoder,
 	}
 	for _, option := range options {
 		option(s)
@@ -80,6 +85,14 @@ func ServerErrorHandler(errorHandler transport.ErrorHandler) ServerOption {
 	return func(s *Server) { s.errorHandler = errorHandler }
 }
 
+// ServerErrorEncoder is used to encode the errors returned by the request
+// decoder, the endpoint and the response encoder into the error returned to
+// gRPC, whose status is sent to the client. By default, errors are returned
+// as they are, with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *Server) { s.errorEncoder = ee }
+}
+
 // ServerFinalizer is executed at the end of every gRPC request.
 // By default, no finalizer is registered.
 func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
@@ -115,13 +128,13 @@ func (s Server) ServeGRPC(ctx context.Context, req interface{}) (retctx context.
 	request, err = s.dec(ctx, req)
 	if err != nil {
 		s.errorHandler.Handle(ctx, err)
-		return ctx, nil, err
+		return ctx, nil, s.errorEncoder(ctx, err)
 	}
 
 	response, err = s.e(ctx, request)
 	if err != nil {
 		s.errorHandler.Handle(ctx, err)
-		return ctx, nil, err
+		return ctx, nil, s.errorEncoder(ctx, err)
 	}
 
 	var mdHeader, mdTrailer metadata.MD
@@ -132,7 +145,7 @@ func (s Server) ServeGRPC(ctx context.Context, req interface{}) (retctx context.
 	grpcResp, err = s.enc(ctx, response)
 	if err != nil {
 		s.errorHandler.Handle(ctx, err)
-		return ctx, nil, err
+		return ctx, nil, s.errorEncoder(ctx, err)
 	}
 
 	if len(mdHeader) > 0 {
@@ -152,6 +165,34 @@ func (s Server) ServeGRPC(ctx context.Context, req interface{}) (retctx context.
 	return ctx, grpcResp, nil
 }
 
+// ErrorEncoder is responsible for encoding an error into the error returned
+// to gRPC. Users are encouraged to use custom ErrorEncoders to map their own
+// error types to gRPC status codes.
+type ErrorEncoder func(ctx context.Context, err error) error
+
+// DefaultErrorEncoder returns the error as it is. gRPC sends the status of
+// errors implementing GRPCStatus() *status.Status, and UNKNOWN otherwise.
+func DefaultErrorEncoder(_ context.Context, err error) error {
+	return err
+}
+
+// KindErrorEncoder returns errors implementing GRPCStatus() *status.Status as
+// they are, and errors wrapping one as its status, with the message of the
+// wrapping error. Other errors are returned as a status with the gRPC code of
+// their kind, as classified by errkind.Of, and the error message.
+func KindErrorEncoder(_ context.Context, err error) error {
+	if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+		return err
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) && grpcErr.GRPCStatus() != nil {
+		st := grpcErr.GRPCStatus().Proto()
+		st.Message = err.Error()
+		return status.ErrorProto(st)
+	}
+	return status.Error(errkind.Of(err).GRPCCode(), err.Error())
+}
+
 // ServerFinalizerFunc can be used to perform work at the end of an gRPC
 // request, after the response has been written to the client.
 type ServerFinalizerFunc func(ctx context.Context, err error)
@@ -0,0 +1,39 @@
+package grpc_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/errkind"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+)
+
+func TestServerErrorEncoder(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("get: %w", errkind.New(errkind.NotFound, "no such profile")), codes.NotFound},
+		{status.Error(codes.Aborted, "aborted"), codes.Aborted},
+		{fmt.Errorf("call: %w", status.Error(codes.ResourceExhausted, "quota")), codes.ResourceExhausted},
+		{fmt.Errorf("oops"), codes.Unknown},
+	} {
+		s := grpctransport.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return nil, tc.err },
+			func(_ context.Context, req interface{}) (interface{}, error) { return req, nil },
+			func(_ context.Context, resp interface{}) (interface{}, error) { return resp, nil },
+			grpctransport.ServerErrorEncoder(grpctransport.KindErrorEncoder),
+		)
+		_, _, err := s.ServeGRPC(context.Background(), struct{}{})
+		if want, have := tc.want, status.Code(err); want != have {
+			t.Errorf("%v: want %v, have %v", tc.err, want, have)
+		}
+		if want, have := status.Convert(tc.err).Message(), status.Convert(err).Message(); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
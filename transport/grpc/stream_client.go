@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// StreamClient wraps a gRPC connection and provides a method that implements
+// endpoint.StreamEndpoint, for a single streaming remote method.
+type StreamClient struct {
+	client    *grpc.ClientConn
+	method    string
+	enc       EncodeRequestFunc
+	dec       DecodeResponseFunc
+	grpcReply reflect.Type
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	finalizer []ClientFinalizerFunc
+}
+
+// NewStreamClient constructs a usable StreamClient for a single remote
+// streaming method, be it client-streaming, server-streaming or
+// bidirectional. Pass a zero-value protobuf message of the RPC response type
+// as the grpcReply argument.
+func NewStreamClient(
+	cc *grpc.ClientConn,
+	serviceName string,
+	method string,
+	enc EncodeRequestFunc,
+	dec DecodeResponseFunc,
+	grpcReply interface{},
+	options ...StreamClientOption,
+) *StreamClient {
+	c := &StreamClient{
+		client: cc,
+		method: fmt.Sprintf("/%s/%s", serviceName, method),
+		enc:    enc,
+		dec:    dec,
+		grpcReply: reflect.TypeOf(
+			reflect.Indirect(
+				reflect.ValueOf(grpcReply),
+			).Interface(),
+		),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// StreamClientOption sets an optional parameter for stream clients.
+type StreamClientOption func(*StreamClient)
+
+// StreamClientBefore sets the RequestFuncs that are applied to the metadata
+// of the outgoing stream before it's opened.
+func StreamClientBefore(before ...ClientRequestFunc) StreamClientOption {
+	return func(c *StreamClient) { c.before = append(c.before, before...) }
+}
+
+// StreamClientAfter sets the ClientResponseFuncs that are applied once the
+// response header is received, prior to the first response being decoded.
+// The trailer isn't received until the end of the stream, so it's empty.
+func StreamClientAfter(after ...ClientResponseFunc) StreamClientOption {
+	return func(c *StreamClient) { c.after = append(c.after, after...) }
+}
+
+// StreamClientFinalizer is executed at the end of every gRPC stream.
+// By default, no finalizer is registered.
+func StreamClientFinalizer(f ...ClientFinalizerFunc) StreamClientOption {
+	return func(c *StreamClient) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// Endpoint returns a usable stream endpoint that invokes the streaming gRPC
+// method specified by the client. The stream it's given is the caller's end:
+// requests to send are read from it with Recv until io.EOF, which closes the
+// sending direction, and the responses received are written to it with Send.
+// The endpoint returns once the server closed the stream, with the status of
+// the call.
+//
+// Requests are read from the caller's stream by a goroutine, which the
+// endpoint can't interrupt while it's blocked in Recv. If the endpoint returns
+// before Recv returned io.EOF, e.g. because the server ended the call early,
+// the caller must make Recv return, with io.EOF or an error, for the goroutine
+// to exit.
+func (c StreamClient) Endpoint() endpoint.StreamEndpoint {
+	return func(ctx context.Context, stream endpoint.Stream) (err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, c.method)
+
+		md := &metadata.MD{}
+		for _, f := range c.before {
+			ctx = f(ctx, md)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, *md)
+
+		cs, err := c.client.NewStream(ctx, &grpc.StreamDesc{
+			ClientStreams: true,
+			ServerStreams: true,
+		}, c.method)
+		if err != nil {
+			return err
+		}
+
+		// Requests are sent concurrently. If that fails, the call is canceled,
+		// and the error sending is returned instead of the cancelation.
+		sendc := make(chan error, 1)
+		go func(ctx context.Context) {
+			err := c.send(ctx, cs, stream)
+			sendc <- err
+			if err != nil {
+				cancel()
+			}
+		}(ctx)
+		fail := func(err error) error {
+			select {
+			case sendErr := <-sendc:
+				if sendErr != nil {
+					return sendErr
+				}
+			default:
+			}
+			return err
+		}
+
+		header, err := cs.Header()
+		if err != nil {
+			return fail(err)
+		}
+		for _, f := range c.after {
+			ctx = f(ctx, header, nil)
+		}
+
+		for {
+			grpcReply := reflect.New(c.grpcReply).Interface()
+			if err = cs.RecvMsg(grpcReply); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fail(err)
+			}
+			var response interface{}
+			if response, err = c.dec(ctx, grpcReply); err != nil {
+				return fail(err)
+			}
+			if err = stream.Send(response); err != nil {
+				return fail(err)
+			}
+		}
+	}
+}
+
+// send reads requests from the caller's stream, and sends them on cs, until
+// the caller's stream ends.
+func (c StreamClient) send(ctx context.Context, cs grpc.ClientStream, stream endpoint.Stream) error {
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return cs.CloseSend()
+		} else if err != nil {
+			return err
+		}
+		req, err := c.enc(ctx, request)
+		if err != nil {
+			return err
+		}
+		if err := cs.SendMsg(req); err == io.EOF {
+			return nil // the stream was closed, RecvMsg gets its status
+		} else if err != nil {
+			return err
+		}
+	}
+}
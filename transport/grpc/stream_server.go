@@ -0,0 +1,208 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+)
+
+// StreamServer wraps a stream endpoint, and serves streaming gRPC methods
+// with it. The incoming requests, and the responses sent by the endpoint, are
+// from the caller business domain, not gRPC request and reply types.
+type StreamServer struct {
+	e            endpoint.StreamEndpoint
+	dec          DecodeRequestFunc
+	enc          EncodeResponseFunc
+	grpcRequest  reflect.Type
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+	errorEncoder ErrorEncoder
+}
+
+// NewStreamServer constructs a new stream server. Pass a zero-value protobuf
+// message of the RPC request type as the grpcRequest argument. Consumers
+// should write bindings that adapt the concrete gRPC methods from their
+// compiled protobuf definitions to ServeGRPCStream, for client-streaming and
+// bidirectional methods, or ServeGRPCServerStream, for server-streaming
+// methods.
+func NewStreamServer(
+	e endpoint.StreamEndpoint,
+	dec DecodeRequestFunc,
+	enc EncodeResponseFunc,
+	grpcRequest interface{},
+	options ...StreamServerOption,
+) *StreamServer {
+	s := &StreamServer{
+		e:   e,
+		dec: dec,
+		enc: enc,
+		grpcRequest: reflect.TypeOf(
+			reflect.Indirect(
+				reflect.ValueOf(grpcRequest),
+			).Interface(),
+		),
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		errorEncoder: DefaultErrorEncoder,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// StreamServerOption sets an optional parameter for stream servers.
+type StreamServerOption func(*StreamServer)
+
+// StreamServerBefore functions are executed on the gRPC metadata of the
+// incoming stream, before any request is decoded.
+func StreamServerBefore(before ...ServerRequestFunc) StreamServerOption {
+	return func(s *StreamServer) { s.before = append(s.before, before...) }
+}
+
+// StreamServerAfter functions are executed once, before the first response
+// is sent, or when the endpoint returns if it sends none. The header they set
+// is sent right away, and the trailer at the end of the stream.
+func StreamServerAfter(after ...ServerResponseFunc) StreamServerOption {
+	return func(s *StreamServer) { s.after = append(s.after, after...) }
+}
+
+// StreamServerErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored.
+func StreamServerErrorHandler(errorHandler transport.ErrorHandler) StreamServerOption {
+	return func(s *StreamServer) { s.errorHandler = errorHandler }
+}
+
+// StreamServerErrorEncoder is used to encode the error returned by the stream
+// endpoint into the error returned to gRPC, whose status is sent to the
+// client. By default, errors are returned as they are.
+func StreamServerErrorEncoder(ee ErrorEncoder) StreamServerOption {
+	return func(s *StreamServer) { s.errorEncoder = ee }
+}
+
+// StreamServerFinalizer is executed at the end of every gRPC stream.
+// By default, no finalizer is registered.
+func StreamServerFinalizer(f ...ServerFinalizerFunc) StreamServerOption {
+	return func(s *StreamServer) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// ServeGRPCStream serves a client-streaming or bidirectional gRPC method.
+func (s StreamServer) ServeGRPCStream(stream grpc.ServerStream) error {
+	return s.serve(stream, nil, false)
+}
+
+// ServeGRPCServerStream serves a server-streaming gRPC method, whose single
+// request was already received by the generated code. The endpoint receives
+// it, decoded, followed by io.EOF.
+func (s StreamServer) ServeGRPCServerStream(req interface{}, stream grpc.ServerStream) error {
+	return s.serve(stream, req, true)
+}
+
+func (s StreamServer) serve(stream grpc.ServerStream, req interface{}, serverStreaming bool) (err error) {
+	ctx := stream.Context()
+
+	// Retrieve gRPC metadata.
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	if method, ok := grpc.MethodFromServerStream(stream); ok {
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, method)
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, md)
+	}
+
+	ss := &serverStream{s: s, stream: stream, ctx: ctx, req: req, serverStreaming: serverStreaming}
+	if err = s.e(ctx, ss); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return s.errorEncoder(ctx, err)
+	}
+	if err = ss.runAfter(); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// serverStream implements endpoint.Stream on top of a grpc.ServerStream.
+type serverStream struct {
+	s      StreamServer
+	stream grpc.ServerStream
+	ctx    context.Context
+
+	// Server-streaming methods have a single request, already received by
+	// the generated code.
+	serverStreaming bool
+	req             interface{}
+
+	afterOnce sync.Once
+	afterCtx  context.Context // returned by the ServerAfter funcs
+	afterErr  error
+}
+
+func (ss *serverStream) Recv() (interface{}, error) {
+	var grpcReq interface{}
+	if ss.serverStreaming {
+		if ss.req == nil {
+			return nil, io.EOF
+		}
+		grpcReq, ss.req = ss.req, nil
+	} else {
+		grpcReq = reflect.New(ss.s.grpcRequest).Interface()
+		if err := ss.stream.RecvMsg(grpcReq); err != nil {
+			return nil, err
+		}
+	}
+	return ss.s.dec(ss.ctx, grpcReq)
+}
+
+func (ss *serverStream) Send(response interface{}) error {
+	if err := ss.runAfter(); err != nil {
+		return err
+	}
+	grpcResp, err := ss.s.enc(ss.afterCtx, response)
+	if err != nil {
+		return err
+	}
+	return ss.stream.SendMsg(grpcResp)
+}
+
+// runAfter runs the ServerAfter funcs, and sends the header they set.
+func (ss *serverStream) runAfter() error {
+	ss.afterOnce.Do(func() {
+		mdHeader, mdTrailer := metadata.MD{}, metadata.MD{}
+		ss.afterCtx = ss.ctx
+		for _, f := range ss.s.after {
+			ss.afterCtx = f(ss.afterCtx, &mdHeader, &mdTrailer)
+		}
+		if len(mdHeader) > 0 {
+			if ss.afterErr = ss.stream.SendHeader(mdHeader); ss.afterErr != nil {
+				return
+			}
+		}
+		if len(mdTrailer) > 0 {
+			ss.stream.SetTrailer(mdTrailer)
+		}
+	})
+	return ss.afterErr
+}
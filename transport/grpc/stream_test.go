@@ -0,0 +1,305 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/kit/transport/grpc/_grpc_test/pb"
+)
+
+// echo sends a response for every request, and one more at the end with the
+// number of requests, so it works as a bidirectional, client-streaming or
+// server-streaming endpoint.
+func echo(ctx context.Context, stream endpoint.Stream) error {
+	if _, ok := ctx.Value(jwt.JWTClaimsContextKey).(*stdjwt.StandardClaims); !ok {
+		return status.Error(codes.Unauthenticated, "no claims")
+	}
+	var n int64
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return stream.Send(fmt.Sprintf("%d requests", n))
+		}
+		if err != nil {
+			return err
+		}
+		req := request.(*pb.TestRequest)
+		if req.B < 0 {
+			return status.Error(codes.InvalidArgument, "negative")
+		}
+		if err := stream.Send(fmt.Sprintf("%s = %d", req.A, req.B)); err != nil {
+			return err
+		}
+		n++
+	}
+}
+
+var (
+	streamKey    = []byte("test")
+	streamMethod = stdjwt.SigningMethodHS256
+)
+
+func startStreamServer(t *testing.T, finalized chan<- error) (cc *grpc.ClientConn, stop func()) {
+	t.Helper()
+
+	s := grpctransport.NewStreamServer(
+		endpoint.Streaming(jwt.NewParser(
+			func(*stdjwt.Token) (interface{}, error) { return streamKey, nil },
+			streamMethod,
+			jwt.StandardClaimsFactory,
+		))(echo),
+		func(_ context.Context, req interface{}) (interface{}, error) { return req, nil },
+		func(_ context.Context, res interface{}) (interface{}, error) {
+			return &pb.TestResponse{V: res.(string)}, nil
+		},
+		pb.TestRequest{},
+		grpctransport.StreamServerBefore(jwt.GRPCToContext()),
+		grpctransport.StreamServerAfter(
+			grpctransport.SetResponseHeader("hdr", "value"),
+			grpctransport.SetResponseTrailer("trlr", "value"),
+		),
+		grpctransport.StreamServerFinalizer(func(ctx context.Context, err error) {
+			if method, _ := ctx.Value(grpctransport.ContextKeyRequestMethod).(string); method == "" {
+				t.Error("no method in context")
+			}
+			finalized <- err
+		}),
+	)
+
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "pb.Stream",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Bidi",
+				Handler:       func(_ interface{}, stream grpc.ServerStream) error { return s.ServeGRPCStream(stream) },
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+			{
+				StreamName: "List",
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					req := new(pb.TestRequest)
+					if err := stream.RecvMsg(req); err != nil {
+						return err
+					}
+					return s.ServeGRPCServerStream(req, stream)
+				},
+				ServerStreams: true,
+			},
+		},
+	}, struct{}{})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+
+	cc, err = grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc, func() { cc.Close(); server.Stop() }
+}
+
+func streamClient(cc *grpc.ClientConn, method string, header *metadata.MD, options ...grpctransport.StreamClientOption) endpoint.StreamEndpoint {
+	options = append(options,
+		grpctransport.StreamClientBefore(jwt.ContextToGRPC()),
+		grpctransport.StreamClientAfter(func(ctx context.Context, md metadata.MD, _ metadata.MD) context.Context {
+			*header = md
+			return ctx
+		}),
+	)
+	return endpoint.Streaming(jwt.NewSigner("kid", streamKey, streamMethod, stdjwt.StandardClaims{}))(
+		grpctransport.NewStreamClient(
+			cc, "pb.Stream", method,
+			func(_ context.Context, req interface{}) (interface{}, error) { return req, nil },
+			func(_ context.Context, res interface{}) (interface{}, error) { return res.(*pb.TestResponse).V, nil },
+			pb.TestResponse{},
+			options...,
+		).Endpoint(),
+	)
+}
+
+// sliceStream is the caller's end of a stream, which sends requests from a
+// slice and collects the responses.
+type sliceStream struct {
+	requests  []interface{}
+	responses []interface{}
+}
+
+func (s *sliceStream) Recv() (interface{}, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *sliceStream) Send(response interface{}) error {
+	s.responses = append(s.responses, response)
+	return nil
+}
+
+func TestStreamBidi(t *testing.T) {
+	var (
+		finalized = make(chan error, 1)
+		cc, stop  = startStreamServer(t, finalized)
+		header    metadata.MD
+		e         = streamClient(cc, "Bidi", &header)
+		stream    = &sliceStream{requests: []interface{}{
+			&pb.TestRequest{A: "a", B: 1},
+			&pb.TestRequest{A: "b", B: 2},
+		}}
+	)
+	defer stop()
+
+	if err := e(context.Background(), stream); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := fmt.Sprint([]interface{}{"a = 1", "b = 2", "2 requests"}), fmt.Sprint(stream.responses); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if want, have := []string{"value"}, header.Get("hdr"); fmt.Sprint(want) != fmt.Sprint(have) {
+		t.Errorf("header: want %v, have %v", want, have)
+	}
+	if err := <-finalized; err != nil {
+		t.Errorf("finalizer: want no error, have %v", err)
+	}
+}
+
+func TestStreamServerStreaming(t *testing.T) {
+	var (
+		finalized = make(chan error, 1)
+		cc, stop  = startStreamServer(t, finalized)
+		header    metadata.MD
+		e         = streamClient(cc, "List", &header)
+		stream    = &sliceStream{requests: []interface{}{&pb.TestRequest{A: "a", B: 1}}}
+	)
+	defer stop()
+
+	if err := e(context.Background(), stream); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := fmt.Sprint([]interface{}{"a = 1", "1 requests"}), fmt.Sprint(stream.responses); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	<-finalized
+}
+
+func TestStreamErrors(t *testing.T) {
+	var (
+		finalized = make(chan error, 1)
+		cc, stop  = startStreamServer(t, finalized)
+		header    metadata.MD
+	)
+	defer stop()
+
+	// An error returned by the server's endpoint is the status of the call.
+	e := streamClient(cc, "Bidi", &header)
+	err := e(context.Background(), &sliceStream{requests: []interface{}{&pb.TestRequest{B: -1}}})
+	if want, have := codes.InvalidArgument, status.Code(err); want != have {
+		t.Errorf("want %v, have %v (%v)", want, have, err)
+	}
+	if want, have := codes.InvalidArgument, status.Code(<-finalized); want != have {
+		t.Errorf("finalizer: want %v, have %v", want, have)
+	}
+
+	// Unauthenticated calls don't get through the server's middleware.
+	unsigned := grpctransport.NewStreamClient(
+		cc, "pb.Stream", "Bidi",
+		func(_ context.Context, req interface{}) (interface{}, error) { return req, nil },
+		func(_ context.Context, res interface{}) (interface{}, error) { return res, nil },
+		pb.TestResponse{},
+	).Endpoint()
+	if err := unsigned(context.Background(), &sliceStream{}); err == nil {
+		t.Error("want error, have none")
+	}
+	<-finalized
+
+	// An error encoding a request cancels the call.
+	encodeErr := errors.New("encode")
+	failing := grpctransport.NewStreamClient(
+		cc, "pb.Stream", "Bidi",
+		func(context.Context, interface{}) (interface{}, error) { return nil, encodeErr },
+		func(_ context.Context, res interface{}) (interface{}, error) { return res, nil },
+		pb.TestResponse{},
+		grpctransport.StreamClientBefore(jwt.ContextToGRPC()),
+	).Endpoint()
+	if want, have := encodeErr, failing(context.Background(), &sliceStream{requests: []interface{}{&pb.TestRequest{}}}); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+// chanStream is the caller's end of a stream, which sends requests from a
+// channel, blocking in Recv until it's closed.
+type chanStream struct {
+	requests chan interface{}
+}
+
+func (s chanStream) Recv() (interface{}, error) {
+	req, ok := <-s.requests
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s chanStream) Send(interface{}) error {
+	return nil
+}
+
+func TestStreamClientSendExits(t *testing.T) {
+	var (
+		finalized = make(chan error, 1)
+		cc, stop  = startStreamServer(t, finalized)
+		header    metadata.MD
+		e         = streamClient(cc, "Bidi", &header)
+		stream    = chanStream{requests: make(chan interface{}, 1)}
+	)
+	defer stop()
+
+	// The server ends the call while the caller's stream is still open.
+	stream.requests <- &pb.TestRequest{B: -1}
+	if want, have := codes.InvalidArgument, status.Code(e(context.Background(), stream)); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	<-finalized
+	if !sending() {
+		t.Fatal("want goroutine blocked in Recv, have none")
+	}
+
+	// Ending the caller's stream lets the goroutine reading it exit.
+	close(stream.requests)
+	for deadline := time.Now().Add(time.Second); sending(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("goroutine reading the caller's stream didn't exit")
+		}
+	}
+}
+
+// sending reports whether a goroutine sending the requests of a stream
+// client is running.
+func sending() bool {
+	buf := make([]byte, 1<<20)
+	return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "grpc.StreamClient.send")
+}
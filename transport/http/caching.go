@@ -0,0 +1,200 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagger is checked by servers built with ServerCaching. If a response
+// implements ETagger, the entity tag it returns, e.g. `"v42"` or `W/"v42"`,
+// is used as the ETag of the response, instead of one computed from the
+// encoded response. Unquoted entity tags are quoted.
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier is checked by servers built with ServerCaching. If a response
+// implements LastModifier, the time it returns is used as the Last-Modified
+// time of the response.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// CachingOption sets an optional parameter of the caching of servers.
+type CachingOption func(*caching)
+
+// CachingCacheControl sets the Cache-Control header of successful responses,
+// e.g. "max-age=60" or "no-cache", unless the response already has one. By
+// default, no Cache-Control header is set.
+func CachingCacheControl(value string) CachingOption {
+	return func(c *caching) { c.cacheControl = value }
+}
+
+// CachingComputeETag sets whether the ETag of responses implementing neither
+// ETagger nor LastModifier is computed, as a weak entity tag of a hash of the
+// encoded response. It's true by default, which requires buffering the
+// encoded response.
+func CachingComputeETag(compute bool) CachingOption {
+	return func(c *caching) { c.computeETag = compute }
+}
+
+// ServerCaching makes the server support conditional GET and HEAD requests,
+// as per RFC 7232. The ETag and Last-Modified headers of successful
+// responses are set from the response, if it implements ETagger or
+// LastModifier, or computed from the encoded response otherwise. Requests
+// with a matching If-None-Match header, or else an If-Modified-Since header
+// no older than the Last-Modified time, are answered with 304 Not Modified
+// and no body. The endpoint is invoked in any case.
+func ServerCaching(options ...CachingOption) ServerOption {
+	c := &caching{computeETag: true}
+	for _, option := range options {
+		option(c)
+	}
+	return func(s *Server) { s.caching = c }
+}
+
+type caching struct {
+	cacheControl string
+	computeETag  bool
+}
+
+// encoder returns the EncodeResponseFunc of the response to the request.
+func (c *caching) encoder(r *http.Request, enc EncodeResponseFunc) EncodeResponseFunc {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return enc
+	}
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		var (
+			etag     string
+			modified time.Time
+		)
+		if e, ok := response.(ETagger); ok {
+			etag = quoteETag(e.ETag())
+		}
+		if m, ok := response.(LastModifier); ok {
+			modified = m.LastModified()
+		}
+
+		if etag != "" || !modified.IsZero() || !c.computeETag {
+			code := http.StatusOK
+			if sc, ok := response.(StatusCoder); ok {
+				code = sc.StatusCode()
+			}
+			if c.validate(w, r, response, code, etag, modified) {
+				return nil
+			}
+			return enc(ctx, w, response)
+		}
+
+		bw := &bufferingWriter{ResponseWriter: w, code: http.StatusOK}
+		if err := enc(ctx, bw, response); err != nil {
+			return err
+		}
+		if bw.code == http.StatusOK {
+			sum := sha256.Sum256(bw.buf.Bytes())
+			etag = `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		}
+		if c.validate(w, r, response, bw.code, etag, modified) {
+			return nil
+		}
+		w.WriteHeader(bw.code)
+		_, err := w.Write(bw.buf.Bytes())
+		return err
+	}
+}
+
+// validate sets the validators and Cache-Control header of successful
+// responses, and writes 304 Not Modified if the request preconditions
+// don't hold, in which case it returns true. The Cache-Control header isn't
+// set if the response sets its own, as a Headerer.
+func (c *caching) validate(w http.ResponseWriter, r *http.Request, response interface{}, code int, etag string, modified time.Time) bool {
+	if code != http.StatusOK {
+		return false
+	}
+	h := w.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	cacheControl, own := c.cacheControl, ""
+	if headerer, ok := response.(Headerer); ok {
+		own = headerer.Headers().Get("Cache-Control")
+	}
+	if !notModified(r, etag, modified) {
+		if own == "" && cacheControl != "" && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", cacheControl)
+		}
+		return false
+	}
+	if own != "" {
+		cacheControl = own
+	}
+	if cacheControl != "" && h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// notModified evaluates the If-None-Match header of the request, or else
+// its If-Modified-Since header, as per RFC 7232 section 6.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// weakETag returns the opaque tag of the entity tag, for weak comparison.
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+// bufferingWriter buffers the response, so that it's written once its
+// status and validators are known.
+type bufferingWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (w *bufferingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+}
+
+func (w *bufferingWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.buf.Write(p)
+}
@@ -0,0 +1,297 @@
+package http_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+type versionedResponse struct {
+	Name    string `json:"name"`
+	Version int    `json:"-"`
+}
+
+func (r versionedResponse) ETag() string { return "v" + strconv.Itoa(r.Version) }
+
+func TestServerCaching(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	newServer := func(response interface{}) *httptest.Server {
+		return httptest.NewServer(httptransport.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return response, nil },
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONResponse,
+			httptransport.ServerCaching(httptransport.CachingCacheControl("max-age=60")),
+		))
+	}
+	do := func(url string, header ...string) *http.Response {
+		req, _ := http.NewRequest("GET", url, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// Computed ETag.
+	server := newServer(map[string]string{"name": "kit"})
+	defer server.Close()
+	resp := do(server.URL)
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("want weak ETag, have %q", etag)
+	}
+	if want, have := "max-age=60", resp.Header.Get("Cache-Control"); want != have {
+		t.Errorf("want Cache-Control %q, have %q", want, have)
+	}
+	for _, tc := range []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	} {
+		resp := do(server.URL, "If-None-Match", tc.ifNoneMatch)
+		if want, have := tc.want, resp.StatusCode; want != have {
+			t.Errorf("If-None-Match %s: want %d, have %d", tc.ifNoneMatch, want, have)
+		}
+		if want, have := etag, resp.Header.Get("ETag"); want != have {
+			t.Errorf("want ETag %q, have %q", want, have)
+		}
+	}
+
+	// ETagger response.
+	tagged := newServer(versionedResponse{Name: "kit", Version: 2})
+	defer tagged.Close()
+	if want, have := `"v2"`, do(tagged.URL).Header.Get("ETag"); want != have {
+		t.Errorf("want ETag %q, have %q", want, have)
+	}
+	if want, have := http.StatusNotModified, do(tagged.URL, "If-None-Match", `W/"v2"`).StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	// LastModifier response.
+	dated := newServer(lastModifiedResponse(modified))
+	defer dated.Close()
+	if want, have := modified.Format(http.TimeFormat), do(dated.URL).Header.Get("Last-Modified"); want != have {
+		t.Errorf("want Last-Modified %q, have %q", want, have)
+	}
+	for _, tc := range []struct {
+		ifModifiedSince time.Time
+		want            int
+	}{
+		{modified, http.StatusNotModified},
+		{modified.Add(time.Hour), http.StatusNotModified},
+		{modified.Add(-time.Hour), http.StatusOK},
+	} {
+		resp := do(dated.URL, "If-Modified-Since", tc.ifModifiedSince.Format(http.TimeFormat))
+		if want, have := tc.want, resp.StatusCode; want != have {
+			t.Errorf("If-Modified-Since %v: want %d, have %d", tc.ifModifiedSince, want, have)
+		}
+	}
+}
+
+type lastModifiedResponse time.Time
+
+func (r lastModifiedResponse) LastModified() time.Time { return time.Time(r) }
+
+func TestClientCache(t *testing.T) {
+	var (
+		hits, revalidations int64
+		cacheControl        = "max-age=60"
+		etag                = `"v1"`
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt64(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello " + r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	store := httptransport.NewMemoryCacheStore(10)
+	call := func(method, language string) string {
+		client := httptransport.NewClient(
+			method, u,
+			func(_ context.Context, r *http.Request, _ interface{}) error {
+				r.Header.Set("Accept-Language", language)
+				return nil
+			},
+			func(_ context.Context, resp *http.Response) (interface{}, error) {
+				b, err := ioutil.ReadAll(resp.Body)
+				return string(b), err
+			},
+			httptransport.ClientCache(store),
+		)
+		response, err := client.Endpoint()(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.(string)
+	}
+	check := func(response, want string, wantHits, wantRevalidations int64) {
+		t.Helper()
+		if response != want {
+			t.Errorf("want %q, have %q", want, response)
+		}
+		if want, have := wantHits, atomic.LoadInt64(&hits); want != have {
+			t.Errorf("want %d hits, have %d", want, have)
+		}
+		if want, have := wantRevalidations, atomic.LoadInt64(&revalidations); want != have {
+			t.Errorf("want %d revalidations, have %d", want, have)
+		}
+	}
+
+	check(call("GET", "en"), "hello en", 1, 0)
+	check(call("GET", "en"), "hello en", 1, 0) // fresh
+	check(call("GET", "fr"), "hello fr", 2, 0) // varies
+	check(call("POST", "fr"), "", 3, 0)        // invalidates
+	check(call("GET", "fr"), "hello fr", 4, 0)
+
+	cacheControl = "no-cache"
+	check(call("GET", "de"), "hello de", 5, 0)
+	check(call("GET", "de"), "hello de", 6, 1) // revalidated
+
+	cacheControl = "no-store"
+	etag = `"v2"`
+	check(call("GET", "de"), "hello de", 7, 1)
+	check(call("GET", "de"), "hello de", 8, 1)
+}
+
+func TestClientCacheAuthorization(t *testing.T) {
+	var (
+		hits         int64
+		cacheControl = "max-age=60"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte("hello " + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	store := httptransport.NewMemoryCacheStore(10)
+	call := func(authorization string) string {
+		client := httptransport.NewClient(
+			"GET", u,
+			func(_ context.Context, r *http.Request, _ interface{}) error {
+				r.Header.Set("Authorization", authorization)
+				return nil
+			},
+			func(_ context.Context, resp *http.Response) (interface{}, error) {
+				b, err := ioutil.ReadAll(resp.Body)
+				return string(b), err
+			},
+			httptransport.ClientCache(store),
+		)
+		response, err := client.Endpoint()(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.(string)
+	}
+	check := func(response, want string, wantHits int64) {
+		t.Helper()
+		if response != want {
+			t.Errorf("want %q, have %q", want, response)
+		}
+		if want, have := wantHits, atomic.LoadInt64(&hits); want != have {
+			t.Errorf("want %d hits, have %d", want, have)
+		}
+	}
+
+	// Responses to authorized requests aren't shared by default...
+	check(call("alice"), "hello alice", 1)
+	check(call("bob"), "hello bob", 2)
+	check(call("alice"), "hello alice", 3)
+
+	// ...unless they're explicitly public.
+	cacheControl = "public, max-age=60"
+	check(call("alice"), "hello alice", 4)
+	check(call("bob"), "hello alice", 4)
+}
+
+func TestClientCacheMaxBodySize(t *testing.T) {
+	var (
+		hits int64
+		body = "hello"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Query().Get("chunked") != "" {
+			w.(http.Flusher).Flush() // no Content-Length
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	store := httptransport.NewMemoryCacheStore(10)
+	call := func(rawurl string) string {
+		u, _ := url.Parse(rawurl)
+		client := httptransport.NewClient(
+			"GET", u,
+			httptransport.EncodeJSONRequest,
+			func(_ context.Context, resp *http.Response) (interface{}, error) {
+				b, err := ioutil.ReadAll(resp.Body)
+				return string(b), err
+			},
+			httptransport.ClientCache(store, httptransport.ClientCacheMaxBodySize(5)),
+		)
+		response, err := client.Endpoint()(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.(string)
+	}
+
+	for _, rawurl := range []string{server.URL + "/small", server.URL + "/small"} {
+		if want, have := "hello", call(rawurl); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+	if want, have := int64(1), atomic.LoadInt64(&hits); want != have {
+		t.Errorf("want %d hits, have %d", want, have)
+	}
+
+	// Larger responses are passed through whole, and not cached, whether
+	// their length is known or not.
+	body = "hello, world"
+	for _, rawurl := range []string{server.URL + "/large", server.URL + "/large?chunked=1"} {
+		for i := 0; i < 2; i++ {
+			if want, have := body, call(rawurl); want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		}
+	}
+	if want, have := int64(5), atomic.LoadInt64(&hits); want != have {
+		t.Errorf("want %d hits, have %d", want, have)
+	}
+}
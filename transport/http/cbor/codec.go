@@ -0,0 +1,30 @@
+// Package cbor provides the CBOR codec of the HTTP transport's content
+// negotiation, to be registered in an httptransport.Codecs:
+//
+//	codecs := httptransport.NewCodecs()
+//	codecs.Register(cbor.ContentType, cbor.Codec)
+package cbor
+
+import (
+	"github.com/fxamacker/cbor"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// ContentType is the media type of CBOR bodies.
+const ContentType = "application/cbor"
+
+// Codec is the Codec of CBOR bodies. Struct fields are named after their
+// cbor tag, or else their json tag, so that the same types can be marshaled
+// as JSON and CBOR. Map keys are sorted canonically.
+var Codec httptransport.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v, cbor.EncOptions{Sort: cbor.SortCanonical})
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
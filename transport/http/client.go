@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/go-kit/kit/endpoint"
 )
@@ -27,6 +29,8 @@ type Client struct {
 	after          []ClientResponseFunc
 	finalizer      []ClientFinalizerFunc
 	bufferedStream bool
+	compression    *compression
+	cache          *cache
 }
 
 // NewClient constructs a usable Client for a single remote method.
@@ -92,14 +96,20 @@ func (c Client) Endpoint() endpoint.Endpoint {
 		ctx, cancel := context.WithCancel(ctx)
 
 		var (
-			resp *http.Response
-			err  error
+			resp    *http.Response
+			counter *countingReader
+			err     error
 		)
 		if c.finalizer != nil {
 			defer func() {
 				if resp != nil {
+					uncompressed := resp.ContentLength
+					if counter != nil {
+						uncompressed = counter.n
+					}
 					ctx = context.WithValue(ctx, ContextKeyResponseHeaders, resp.Header)
 					ctx = context.WithValue(ctx, ContextKeyResponseSize, resp.ContentLength)
+					ctx = context.WithValue(ctx, ContextKeyResponseUncompressedSize, uncompressed)
 				}
 				for _, f := range c.finalizer {
 					f(ctx, err)
@@ -117,12 +127,28 @@ func (c Client) Endpoint() endpoint.Endpoint {
 			ctx = f(ctx, req)
 		}
 
-		resp, err = c.client.Do(req.WithContext(ctx))
+		if c.compression != nil && req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", strings.Join(c.compression.encodings(), ", "))
+		}
+
+		if c.cache != nil {
+			resp, err = c.cache.do(c.client, req.WithContext(ctx))
+		} else {
+			resp, err = c.client.Do(req.WithContext(ctx))
+		}
 		if err != nil {
 			cancel()
 			return nil, err
 		}
 
+		if c.compression != nil {
+			if counter, err = c.compression.decompressResponse(resp); err != nil {
+				resp.Body.Close()
+				cancel()
+				return nil, err
+			}
+		}
+
 		// If the caller asked for a buffered stream, we don't cancel the
 		// context when the endpoint returns. Instead, we should call the
 		// cancel func when closing the response body.
@@ -199,6 +225,26 @@ func EncodeXMLRequest(c context.Context, r *http.Request, request interface{}) e
 	return xml.NewEncoder(&b).Encode(request)
 }
 
+// RetryableStatus returns a predicate, suitable for sd/lb.RetryIf, that
+// reports whether an error carries one of the given HTTP status codes, e.g.
+// http.StatusServiceUnavailable. Errors carry a status code if they, or any
+// error they wrap, implement StatusCoder; DecodeResponseFuncs are expected to
+// return such errors for unsuccessful responses.
+func RetryableStatus(codes ...int) func(err error) bool {
+	return func(err error) bool {
+		var sc StatusCoder
+		if !errors.As(err, &sc) {
+			return false
+		}
+		for _, code := range codes {
+			if sc.StatusCode() == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 //
 //
 //
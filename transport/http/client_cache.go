@@ -0,0 +1,496 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore stores the responses cached by clients, serialized, by key.
+// Implementations must be safe for concurrent use. Errors of the store are
+// treated as cache misses.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewMemoryCacheStore returns a CacheStore keeping the responses in memory.
+// Once it holds maxEntries responses, the least recently used is evicted. If
+// maxEntries is zero, there's no limit.
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	return &memoryCacheStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+type memoryCacheStore struct {
+	mtx        sync.Mutex
+	maxEntries int
+	lru        *list.List // of *memoryCacheEntry, most recently used first
+	entries    map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+func (s *memoryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).value, true, nil
+}
+
+func (s *memoryCacheStore) Set(_ context.Context, key string, value []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*memoryCacheEntry).value = value
+		s.lru.MoveToFront(e)
+		return nil
+	}
+	s.entries[key] = s.lru.PushFront(&memoryCacheEntry{key: key, value: value})
+	if s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+func (s *memoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// ClientCache makes the client cache responses in the store, as a private
+// cache per RFC 7234, so that repeated requests are served from the cache
+// while the cached response is fresh, and revalidated with a conditional
+// request once it's stale. Only responses to GET requests are cached,
+// according to the Cache-Control, Expires and Vary headers of the requests
+// and responses. Successful responses to unsafe requests, e.g. POST,
+// invalidate the responses cached for their URL. Requests that carry their
+// own conditional headers bypass the cache.
+//
+// Responses are cached by URL, and the store may be shared, so responses to
+// requests with an Authorization header are only stored if they explicitly
+// allow shared caching, with the public, s-maxage or must-revalidate
+// Cache-Control directives, as per RFC 7234 section 3.2. Otherwise, they'd be
+// served to requests with other credentials, or none.
+//
+// Responses with bodies larger than the maximum body size, 1 MiB by default,
+// are streamed to the decoder without being cached.
+func ClientCache(store CacheStore, options ...ClientCacheOption) ClientOption {
+	c := &cache{store: store, maxBodySize: 1 << 20}
+	for _, option := range options {
+		option(c)
+	}
+	return func(client *Client) { client.cache = c }
+}
+
+// ClientCacheOption sets an optional parameter of the response cache of
+// clients.
+type ClientCacheOption func(*cache)
+
+// ClientCacheMaxBodySize sets the size in bytes of the largest response body
+// that's cached. By default, it's 1 MiB.
+func ClientCacheMaxBodySize(n int64) ClientCacheOption {
+	return func(c *cache) { c.maxBodySize = n }
+}
+
+type cache struct {
+	store       CacheStore
+	maxBodySize int64
+}
+
+// cachedResponse is a stored response, serialized as JSON.
+type cachedResponse struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	RequestTime  time.Time
+	ResponseTime time.Time
+
+	// Vary holds the request headers nominated by the Vary response header.
+	Vary http.Header
+}
+
+// do sends the request with client, unless a fresh response to it is
+// cached.
+func (c *cache) do(client HTTPClient, req *http.Request) (*http.Response, error) {
+	ctx, key := req.Context(), req.URL.String()
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return client.Do(req)
+	default:
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode < 400 {
+			c.invalidate(ctx, req, resp)
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return client.Do(req)
+	}
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return client.Do(req)
+	}
+
+	cached := c.lookup(ctx, key, req)
+	if cached != nil && cached.fresh(reqCC, req.Header, time.Now()) {
+		return cached.response(req, time.Now()), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok && cached == nil {
+		return &http.Response{
+			Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	}
+
+	outreq := req
+	if cached != nil {
+		outreq = req.Clone(ctx)
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			outreq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			outreq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	requestTime := time.Now()
+	resp, err := client.Do(outreq)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := time.Now()
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		for k, v := range resp.Header {
+			if k != "Content-Length" {
+				cached.Header[k] = v
+			}
+		}
+		cached.RequestTime, cached.ResponseTime = requestTime, responseTime
+		c.save(ctx, key, cached)
+		return cached.response(req, time.Now()), nil
+	}
+
+	if !storable(req, resp) || resp.ContentLength > c.maxBodySize {
+		if cached != nil {
+			c.store.Delete(ctx, key)
+		}
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > c.maxBodySize {
+		// Too large to cache: stream what's been read, and the rest.
+		if cached != nil {
+			c.store.Delete(ctx, key)
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	entry := &cachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+		Vary:         http.Header{},
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if values, ok := req.Header[name]; ok {
+			entry.Vary[name] = values
+		}
+	}
+	c.save(ctx, key, entry)
+	return resp, nil
+}
+
+func (c *cache) lookup(ctx context.Context, key string, req *http.Request) *cachedResponse {
+	b, ok, err := c.store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil
+	}
+	for _, name := range varyHeaders(entry.Header) {
+		if strings.Join(req.Header[name], ", ") != strings.Join(entry.Vary[name], ", ") {
+			return nil
+		}
+	}
+	return &entry
+}
+
+func (c *cache) save(ctx context.Context, key string, entry *cachedResponse) {
+	if b, err := json.Marshal(entry); err == nil {
+		c.store.Set(ctx, key, b)
+	}
+}
+
+// invalidate deletes the responses cached for the URL of the unsafe request,
+// and for the Location and Content-Location of its response, if they're of
+// the same host, as per RFC 7234 section 4.4.
+func (c *cache) invalidate(ctx context.Context, req *http.Request, resp *http.Response) {
+	c.store.Delete(ctx, req.URL.String())
+	for _, name := range []string{"Location", "Content-Location"} {
+		if loc := resp.Header.Get(name); loc != "" {
+			if u, err := req.URL.Parse(loc); err == nil && sameOrigin(u, req.URL) {
+				c.store.Delete(ctx, u.String())
+			}
+		}
+	}
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+// storable reports whether the response may be stored, as per RFC 7234
+// section 3, and is worth storing, being fresh or having validators.
+func storable(req *http.Request, resp *http.Response) bool {
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && !sharable(respCC) {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	entry := &cachedResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+	explicit := entry.explicitLifetime()
+	if !cacheableByDefault(resp.StatusCode) && explicit < 0 {
+		return false
+	}
+	return entry.lifetime() > 0 || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// sharable reports whether the response to a request with an Authorization
+// header may be stored by a shared cache, as per RFC 7234 section 3.2.
+func sharable(respCC map[string]string) bool {
+	for _, directive := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := respCC[directive]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheableByDefault(code int) bool {
+	switch code {
+	case 200, 203, 204, 300, 301, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// fresh reports whether the cached response may be served without
+// validation, as per RFC 7234 sections 4.2 and 5.2.1.
+func (e *cachedResponse) fresh(reqCC map[string]string, reqHeader http.Header, now time.Time) bool {
+	respCC := parseCacheControl(e.Header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if len(reqCC) == 0 && strings.Contains(strings.ToLower(reqHeader.Get("Pragma")), "no-cache") {
+		return false
+	}
+	age, lifetime := e.age(now), e.lifetime()
+	if maxAge, ok := directiveSeconds(reqCC, "max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := directiveSeconds(reqCC, "min-fresh"); ok {
+		age += minFresh
+	}
+	if age < lifetime {
+		return true
+	}
+	if _, ok := respCC["must-revalidate"]; ok {
+		return false
+	}
+	if v, ok := reqCC["max-stale"]; ok {
+		if v == "" {
+			return true
+		}
+		maxStale, _ := directiveSeconds(reqCC, "max-stale")
+		return age-lifetime <= maxStale
+	}
+	return false
+}
+
+// lifetime returns the freshness lifetime of the response, as per RFC 7234
+// section 4.2.1, with the heuristic of 10% of the time since it was last
+// modified.
+func (e *cachedResponse) lifetime() time.Duration {
+	if explicit := e.explicitLifetime(); explicit >= 0 {
+		return explicit
+	}
+	if !cacheableByDefault(e.StatusCode) {
+		return 0
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		if since := e.date().Sub(lastModified); since > 0 {
+			return since / 10
+		}
+	}
+	return 0
+}
+
+// explicitLifetime returns the freshness lifetime given by the max-age
+// directive or the Expires header, or -1 if there's none.
+func (e *cachedResponse) explicitLifetime() time.Duration {
+	if maxAge, ok := directiveSeconds(parseCacheControl(e.Header), "max-age"); ok {
+		return maxAge
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid dates are in the past
+		}
+		if lifetime := t.Sub(e.date()); lifetime > 0 {
+			return lifetime
+		}
+		return 0
+	}
+	return -1
+}
+
+// age returns the current age of the response, as per RFC 7234 section
+// 4.2.3.
+func (e *cachedResponse) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(e.ResponseTime)
+}
+
+func (e *cachedResponse) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// response returns the cached response to the request, with its current
+// age.
+func (e *cachedResponse) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// parseCacheControl returns the directives of the Cache-Control header, by
+// lowercase name, with unquoted values.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range h["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, value := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			directives[strings.ToLower(name)] = value
+		}
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	v, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// varyHeaders returns the canonical names of the request headers nominated
+// by the Vary header.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, value := range h["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
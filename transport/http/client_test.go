@@ -3,6 +3,7 @@ package http_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -329,6 +330,28 @@ func TestNewExplicitClient(t *testing.T) {
 	}
 }
 
+func TestRetryableStatus(t *testing.T) {
+	retryable := httptransport.RetryableStatus(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{statusError(http.StatusServiceUnavailable), true},
+		{fmt.Errorf("wrapped: %w", statusError(http.StatusTooManyRequests)), true},
+		{statusError(http.StatusBadRequest), false},
+		{errors.New("no status"), false},
+	} {
+		if have := retryable(tc.err); tc.want != have {
+			t.Errorf("%v: want %v, have %v", tc.err, tc.want, have)
+		}
+	}
+}
+
+type statusError int
+
+func (e statusError) Error() string   { return http.StatusText(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
 func mustParse(s string) *url.URL {
 	u, err := url.Parse(s)
 	if err != nil {
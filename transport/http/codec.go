@@ -0,0 +1,381 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+// Codec marshals and unmarshals the bodies of a media type.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the Codec of JSON bodies.
+var JSONCodec Codec = jsonCodec{}
+
+// XMLCodec is the Codec of XML bodies.
+var XMLCodec Codec = xmlCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// Codecs is a registry of codecs by media type, which lets a single Server
+// decode requests according to their Content-Type and encode responses
+// according to their Accept header, and a Client decode whatever content
+// type the server responds with. Media types are preferred in the order they
+// were registered. Media types with a structured syntax suffix, e.g.
+// application/problem+json, fall back to the codec of the suffix, e.g.
+// application/json.
+//
+// Codecs must not be modified once in use by servers or clients.
+type Codecs struct {
+	mediaTypes []string
+	codecs     map[string]Codec
+}
+
+// NewCodecs returns a registry of the JSON codec, as application/json, and of
+// the XML codec, as application/xml and text/xml. Other codecs, e.g. those of
+// the proto, msgpack and cbor subpackages, are added with Register.
+func NewCodecs() *Codecs {
+	c := &Codecs{codecs: map[string]Codec{}}
+	c.Register("application/json", JSONCodec)
+	c.Register("application/xml", XMLCodec)
+	c.Register("text/xml", XMLCodec)
+	return c
+}
+
+// Register adds the codec of the media type, e.g. "application/msgpack",
+// after the media types already registered, or replaces it.
+func (c *Codecs) Register(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := c.codecs[mediaType]; !ok {
+		c.mediaTypes = append(c.mediaTypes, mediaType)
+	}
+	c.codecs[mediaType] = codec
+}
+
+// MediaTypes returns the registered media types, in order of preference.
+func (c *Codecs) MediaTypes() []string {
+	return append([]string(nil), c.mediaTypes...)
+}
+
+// DecodeRequest returns a DecodeRequestFunc that unmarshals the request body
+// into the value returned by newRequest, which should be a pointer, with the
+// codec of the request Content-Type. Requests without a body aren't
+// unmarshaled. It returns an *UnsupportedMediaTypeError if no codec is
+// registered for the Content-Type, and a *NotAcceptableError if none of the
+// registered media types is acceptable according to the Accept header, so
+// that the endpoint isn't invoked for responses that can't be encoded.
+func (c *Codecs) DecodeRequest(newRequest func() interface{}) DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		if _, ok := c.negotiate(r.Header.Get("Accept")); !ok {
+			return nil, &NotAcceptableError{Accept: r.Header.Get("Accept"), Available: c.MediaTypes()}
+		}
+		request := newRequest()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) == 0 {
+			return request, nil
+		}
+		contentType := r.Header.Get("Content-Type")
+		codec, ok := c.lookup(contentType)
+		if !ok {
+			return nil, &UnsupportedMediaTypeError{ContentType: contentType, Available: c.MediaTypes()}
+		}
+		if err := codec.Unmarshal(body, request); err != nil {
+			return nil, errkind.Wrap(errkind.Invalid, err)
+		}
+		return request, nil
+	}
+}
+
+// EncodeResponse is an EncodeResponseFunc that marshals the response with the
+// codec of the most acceptable media type, according to the Accept header of
+// the request, found in the context under ContextKeyRequestAccept. Servers
+// should therefore be built with ServerBefore(PopulateRequestContext). The
+// most preferred media type is used if the Accept header is missing. If the
+// response implements Headerer, the provided headers will be applied to the
+// response. If the response implements StatusCoder, the provided StatusCode
+// will be used instead of 200.
+func (c *Codecs) EncodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	accept, _ := ctx.Value(ContextKeyRequestAccept).(string)
+	mediaType, ok := c.negotiate(accept)
+	if !ok {
+		return &NotAcceptableError{Accept: accept, Available: c.MediaTypes()}
+	}
+	w.Header().Add("Vary", "Accept")
+	if headerer, ok := response.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	code := http.StatusOK
+	if sc, ok := response.(StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil
+	}
+	body, err := c.codecs[mediaType].Marshal(response)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+	_, err = w.Write(body)
+	return err
+}
+
+// EncodeRequest returns an EncodeRequestFunc that marshals the request with
+// the codec of the media type, which must be registered. The Accept header
+// is set to the registered media types, preferring the one of the request.
+// If the request implements Headerer, the provided headers will be applied
+// to the request.
+func (c *Codecs) EncodeRequest(mediaType string) EncodeRequestFunc {
+	mediaType = strings.ToLower(mediaType)
+	codec, ok := c.codecs[mediaType]
+	if !ok {
+		panic("no codec registered for " + mediaType)
+	}
+	accept := []string{mediaType}
+	for _, t := range c.mediaTypes {
+		if t != mediaType {
+			accept = append(accept, t+";q=0.9")
+		}
+	}
+	return func(_ context.Context, r *http.Request, request interface{}) error {
+		r.Header.Set("Accept", strings.Join(accept, ", "))
+		if headerer, ok := request.(Headerer); ok {
+			for k := range headerer.Headers() {
+				r.Header.Set(k, headerer.Headers().Get(k))
+			}
+		}
+		if request == nil {
+			return nil
+		}
+		body, err := codec.Marshal(request)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Content-Type", mediaType)
+		r.ContentLength = int64(len(body))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+}
+
+// DecodeResponse returns a DecodeResponseFunc that unmarshals the response
+// body into the value returned by newResponse, which should be a pointer,
+// with the codec of the response Content-Type. Responses without a body
+// aren't unmarshaled. Responses with a status of 400 or more are returned as
+// an *errkind.Problem error, decoded from the body if it's a problem details
+// document, and carrying the status and body otherwise. It returns an
+// *UnsupportedMediaTypeError if no codec is registered for the Content-Type.
+func (c *Codecs) DecodeResponse(newResponse func() interface{}) DecodeResponseFunc {
+	return func(_ context.Context, resp *http.Response) (interface{}, error) {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if resp.StatusCode >= 400 {
+			return nil, responseProblem(resp.StatusCode, contentType, body)
+		}
+		response := newResponse()
+		if len(body) == 0 {
+			return response, nil
+		}
+		codec, ok := c.lookup(contentType)
+		if !ok {
+			return nil, &UnsupportedMediaTypeError{ContentType: contentType, Available: c.MediaTypes()}
+		}
+		if err := codec.Unmarshal(body, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func responseProblem(status int, contentType string, body []byte) *errkind.Problem {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == errkind.ProblemContentType {
+		var p errkind.Problem
+		if json.Unmarshal(body, &p) == nil {
+			if p.Status == 0 {
+				p.Status = status
+			}
+			return &p
+		}
+	}
+	return &errkind.Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: strings.TrimSpace(string(body)),
+		Kind:   errkind.Unknown,
+	}
+}
+
+// lookup returns the codec of the media type of contentType, or of its
+// structured syntax suffix.
+func (c *Codecs) lookup(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if codec, ok := c.codecs[mediaType]; ok {
+		return codec, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		codec, ok := c.codecs["application/"+mediaType[i+1:]]
+		return codec, ok
+	}
+	return nil, false
+}
+
+// negotiate returns the registered media type that's most acceptable
+// according to the Accept header, as per RFC 7231 section 5.3.2. Ties are
+// broken by the order of registration.
+func (c *Codecs) negotiate(accept string) (string, bool) {
+	return negotiate(accept, c.mediaTypes)
+}
+
+// negotiate returns the media type that's most acceptable according to the
+// Accept header, as per RFC 7231 section 5.3.2. Ties are broken by the order
+// of the media types.
+func negotiate(accept string, mediaTypes []string) (string, bool) {
+	if len(mediaTypes) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypes[0], true
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, mediaType := range mediaTypes {
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := r.match(mediaType); s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, s := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		typ, subtype := mediaType, ""
+		if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+			typ, subtype = mediaType[:i], mediaType[i+1:]
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// match returns the specificity with which the range matches the media
+// type: 2 for the media type itself, 1 for type/*, 0 for */*, and -1 if it
+// doesn't match.
+func (r mediaRange) match(mediaType string) int {
+	typ, subtype := mediaType, ""
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		typ, subtype = mediaType[:i], mediaType[i+1:]
+	}
+	switch {
+	case r.typ == "*" && r.subtype == "*":
+		return 0
+	case r.typ == typ && r.subtype == "*":
+		return 1
+	case r.typ == typ && r.subtype == subtype:
+		return 2
+	default:
+		return -1
+	}
+}
+
+// UnsupportedMediaTypeError is returned when no codec is registered for the
+// content type of a body. Servers encode it as 415 Unsupported Media Type.
+type UnsupportedMediaTypeError struct {
+	ContentType string
+	Available   []string
+}
+
+// Error implements error.
+func (e *UnsupportedMediaTypeError) Error() string {
+	return "unsupported media type " + strconv.Quote(e.ContentType) + ", want one of " + strings.Join(e.Available, ", ")
+}
+
+// StatusCode implements StatusCoder.
+func (e *UnsupportedMediaTypeError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *UnsupportedMediaTypeError) ErrorKind() errkind.Kind {
+	return errkind.Invalid
+}
+
+// NotAcceptableError is returned when none of the registered media types is
+// acceptable according to the Accept header of a request. Servers encode it
+// as 406 Not Acceptable.
+type NotAcceptableError struct {
+	Accept    string
+	Available []string
+}
+
+// Error implements error.
+func (e *NotAcceptableError) Error() string {
+	return "none of " + strings.Join(e.Available, ", ") + " is acceptable to " + strconv.Quote(e.Accept)
+}
+
+// StatusCode implements StatusCoder.
+func (e *NotAcceptableError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *NotAcceptableError) ErrorKind() errkind.Kind {
+	return errkind.Invalid
+}
@@ -0,0 +1,135 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/errkind"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/cbor"
+	"github.com/go-kit/kit/transport/http/msgpack"
+)
+
+type greeting struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func newCodecs() *httptransport.Codecs {
+	codecs := httptransport.NewCodecs()
+	codecs.Register(msgpack.ContentType, msgpack.Codec)
+	codecs.Register(cbor.ContentType, cbor.Codec)
+	return codecs
+}
+
+func newCodecServer(codecs *httptransport.Codecs) *httptest.Server {
+	return httptest.NewServer(httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			return greeting{Name: "hello " + request.(*greeting).Name}, nil
+		},
+		codecs.DecodeRequest(func() interface{} { return &greeting{} }),
+		codecs.EncodeResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	))
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	codecs := newCodecs()
+	server := newCodecServer(codecs)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	for _, mediaType := range codecs.MediaTypes() {
+		var contentType string
+		client := httptransport.NewClient(
+			"POST", u,
+			codecs.EncodeRequest(mediaType),
+			codecs.DecodeResponse(func() interface{} { return &greeting{} }),
+			httptransport.ClientAfter(func(ctx context.Context, resp *http.Response) context.Context {
+				contentType = resp.Header.Get("Content-Type")
+				return ctx
+			}),
+		)
+		response, err := client.Endpoint()(context.Background(), greeting{Name: "kit"})
+		if err != nil {
+			t.Errorf("%s: %v", mediaType, err)
+			continue
+		}
+		if want, have := "hello kit", response.(*greeting).Name; want != have {
+			t.Errorf("%s: want %q, have %q", mediaType, want, have)
+		}
+		if want, have := mediaType, contentType; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestCodecsNegotiation(t *testing.T) {
+	codecs := newCodecs()
+	server := newCodecServer(codecs)
+	defer server.Close()
+
+	body, _ := msgpack.Codec.Marshal(greeting{Name: "kit"})
+	for _, tc := range []struct {
+		contentType, accept string
+		wantStatus          int
+		wantContentType     string
+	}{
+		{msgpack.ContentType, "", http.StatusOK, "application/json"},
+		{msgpack.ContentType, "*/*", http.StatusOK, "application/json"},
+		{msgpack.ContentType, "text/*", http.StatusOK, "text/xml"},
+		{msgpack.ContentType, "application/*;q=0.5, application/cbor", http.StatusOK, "application/cbor"},
+		{msgpack.ContentType, "application/json;q=0.2, application/msgpack;q=0.8", http.StatusOK, "application/msgpack"},
+		{msgpack.ContentType, "*/*, application/json;q=0", http.StatusOK, "application/xml"},
+		{msgpack.ContentType, "image/png", http.StatusNotAcceptable, ""},
+		{"application/yaml", "", http.StatusUnsupportedMediaType, ""},
+	} {
+		req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", tc.contentType)
+		req.Header.Set("Accept", tc.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tc.wantStatus, resp.StatusCode; want != have {
+			t.Errorf("%s, %q: want %d, have %d", tc.contentType, tc.accept, want, have)
+		}
+		if tc.wantContentType == "" {
+			continue
+		}
+		if want, have := tc.wantContentType, resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("%q: want %q, have %q", tc.accept, want, have)
+		}
+	}
+}
+
+func TestCodecsDecodeErrorResponse(t *testing.T) {
+	server := httptest.NewServer(httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, errkind.New(errkind.NotFound, "no such greeting")
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httptransport.ProblemErrorEncoder),
+	))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	codecs := newCodecs()
+	client := httptransport.NewClient(
+		"GET", u,
+		codecs.EncodeRequest("application/json"),
+		codecs.DecodeResponse(func() interface{} { return &greeting{} }),
+	)
+	_, err := client.Endpoint()(context.Background(), nil)
+	if want, have := errkind.NotFound, errkind.Of(err); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if !httptransport.RetryableStatus(http.StatusNotFound)(err) {
+		t.Errorf("want error with status 404, have %v", err)
+	}
+}
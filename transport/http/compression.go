@@ -0,0 +1,557 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/errkind"
+)
+
+// Compressor compresses and decompresses bodies with an HTTP content coding.
+type Compressor interface {
+	// ContentEncoding returns the name of the content coding, e.g. "gzip".
+	ContentEncoding() string
+
+	// NewWriter returns a writer compressing to w. Closing it flushes the
+	// compressed data, but doesn't close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a reader decompressing from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompressor returns the Compressor of the gzip content coding, with the
+// compression level of compress/gzip, e.g. gzip.DefaultCompression.
+func GzipCompressor(level int) Compressor {
+	return &stdCompressor{
+		encoding: "gzip",
+		newWriter: func(w io.Writer) (resetWriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	}
+}
+
+// DeflateCompressor returns the Compressor of the deflate content coding,
+// which is the zlib format, with the compression level of compress/zlib, e.g.
+// zlib.DefaultCompression.
+func DeflateCompressor(level int) Compressor {
+	return &stdCompressor{
+		encoding: "deflate",
+		newWriter: func(w io.Writer) (resetWriteCloser, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+		newReader: zlib.NewReader,
+	}
+}
+
+type resetWriteCloser interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// stdCompressor pools its writers, as their compression state is large.
+type stdCompressor struct {
+	encoding  string
+	newWriter func(w io.Writer) (resetWriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	writers   sync.Pool
+}
+
+func (c *stdCompressor) ContentEncoding() string {
+	return c.encoding
+}
+
+func (c *stdCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := c.writers.Get().(resetWriteCloser); ok {
+		zw.Reset(w)
+		return &pooledWriter{resetWriteCloser: zw, pool: &c.writers}, nil
+	}
+	zw, err := c.newWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledWriter{resetWriteCloser: zw, pool: &c.writers}, nil
+}
+
+func (c *stdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return c.newReader(r)
+}
+
+type pooledWriter struct {
+	resetWriteCloser
+	pool *sync.Pool
+}
+
+// Flush flushes the pending compressed data, so that streaming responses can
+// be flushed through the writer.
+func (w *pooledWriter) Flush() error {
+	if f, ok := w.resetWriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.resetWriteCloser.Close()
+	w.pool.Put(w.resetWriteCloser)
+	return err
+}
+
+// CompressionOption sets an optional parameter of the compression of servers.
+type CompressionOption func(*compression)
+
+// CompressionCompressors sets the content codings of the server, in order of
+// preference. By default, they're gzip then deflate, with the default
+// compression level.
+func CompressionCompressors(compressors ...Compressor) CompressionOption {
+	return func(c *compression) { c.compressors = compressors }
+}
+
+// CompressionMinSize sets the size of the smallest response body that's
+// compressed, as smaller bodies don't compress well enough to be worth it. By
+// default, it's 1024 bytes. Streaming responses, flushed before reaching that
+// size, are always compressed.
+func CompressionMinSize(size int) CompressionOption {
+	return func(c *compression) { c.minSize = size }
+}
+
+// CompressionContentTypes sets the media types of the response bodies that
+// are compressed, as patterns of path.Match, e.g. "text/*" or
+// "application/*+json". By default, they're text, JSON, XML, JavaScript and
+// newline-delimited JSON, as well as the types with a +json or +xml suffix.
+func CompressionContentTypes(patterns ...string) CompressionOption {
+	return func(c *compression) { c.contentTypes = patterns }
+}
+
+// DefaultMaxDecompressedSize is the default maximum size of decompressed
+// request bodies, in bytes.
+const DefaultMaxDecompressedSize = 10 << 20
+
+// CompressionMaxDecompressedSize sets the maximum size of request bodies once
+// decompressed, so that small compressed bodies can't expand to exhaust the
+// server's memory. Reading past it fails with a *RequestTooLargeError. By
+// default, it's DefaultMaxDecompressedSize. Zero disables the limit.
+func CompressionMaxDecompressedSize(size int64) CompressionOption {
+	return func(c *compression) { c.maxDecompressed = size }
+}
+
+// ServerCompression makes the server compress its response bodies with the
+// content coding that's most acceptable to the client according to the
+// Accept-Encoding header of the request, and decompress request bodies
+// according to their Content-Encoding header. Request bodies with an
+// unsupported content coding are rejected with an *UnsupportedEncodingError.
+// Responses that already have a Content-Encoding aren't compressed.
+//
+// The size of the compressed response is reported to finalizers under
+// ContextKeyResponseSize, and its size before compression under
+// ContextKeyResponseUncompressedSize.
+func ServerCompression(options ...CompressionOption) ServerOption {
+	c := &compression{
+		compressors: []Compressor{
+			GzipCompressor(gzip.DefaultCompression),
+			DeflateCompressor(zlib.DefaultCompression),
+		},
+		minSize:         1024,
+		maxDecompressed: DefaultMaxDecompressedSize,
+		contentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/xml",
+			"application/javascript",
+			"application/x-ndjson",
+			"application/*+json",
+			"application/*+xml",
+		},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return func(s *Server) { s.compression = c }
+}
+
+type compression struct {
+	compressors     []Compressor
+	minSize         int
+	maxDecompressed int64
+	contentTypes    []string
+}
+
+// negotiate returns the compressor that's most acceptable according to the
+// Accept-Encoding header, as per RFC 7231 section 5.3.4, or nil if none is.
+// Ties are broken by the order of preference of the compressors.
+func (c *compression) negotiate(acceptEncoding string) Compressor {
+	qs := parseAcceptEncoding(acceptEncoding)
+	var (
+		best  Compressor
+		bestQ float64
+	)
+	for _, compressor := range c.compressors {
+		q, ok := qs[compressor.ContentEncoding()]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = compressor, q
+		}
+	}
+	return best
+}
+
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	qs := map[string]float64{}
+	for _, s := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(s, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+		qs[coding] = q
+	}
+	return qs
+}
+
+func (c *compression) compressor(encoding string) Compressor {
+	for _, compressor := range c.compressors {
+		if compressor.ContentEncoding() == encoding {
+			return compressor
+		}
+	}
+	return nil
+}
+
+func (c *compression) encodings() []string {
+	encodings := make([]string, len(c.compressors))
+	for i, compressor := range c.compressors {
+		encodings[i] = compressor.ContentEncoding()
+	}
+	return encodings
+}
+
+// decompressRequest replaces the body of the request with its decompressed
+// body, undoing the content codings in the reverse order they were applied,
+// and limited to the maximum decompressed size.
+func (c *compression) decompressRequest(r *http.Request) error {
+	contentEncoding := r.Header.Get("Content-Encoding")
+	if contentEncoding == "" {
+		return nil
+	}
+	var (
+		codings = strings.Split(contentEncoding, ",")
+		body    = r.Body
+	)
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+		compressor := c.compressor(coding)
+		if compressor == nil {
+			return &UnsupportedEncodingError{Encoding: coding, Available: c.encodings()}
+		}
+		zr, err := compressor.NewReader(body)
+		if err != nil {
+			return errkind.Wrap(errkind.Invalid, err)
+		}
+		body = zr
+	}
+	if c.maxDecompressed > 0 {
+		body = &limitedBody{ReadCloser: body, n: c.maxDecompressed, max: c.maxDecompressed}
+	}
+	r.Body = body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+// responseWriter returns the writer compressing the response to the request,
+// if the response is eligible.
+func (c *compression) responseWriter(w http.ResponseWriter, r *http.Request) *compressingWriter {
+	cw := &compressingWriter{ResponseWriter: w, c: c}
+	if r.Method != http.MethodHead {
+		cw.compressor = c.negotiate(r.Header.Get("Accept-Encoding"))
+	}
+	cw.decided = cw.compressor == nil
+	return cw
+}
+
+// compressingWriter buffers the response body until it reaches the minimum
+// size, is flushed or is closed, then decides whether to compress it, based
+// on its status, size and content type.
+type compressingWriter struct {
+	http.ResponseWriter
+	c            *compression
+	compressor   Compressor
+	code         int
+	buf          []byte
+	decided      bool
+	zw           io.WriteCloser
+	uncompressed int64
+}
+
+func (w *compressingWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *compressingWriter) Write(p []byte) (int, error) {
+	w.uncompressed += int64(len(p))
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.c.minSize {
+			return len(p), nil
+		}
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, if the wrapped ResponseWriter does, so that
+// streaming responses can be flushed through it.
+func (w *compressingWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the buffered response, if any, and flushes the compressed
+// data.
+func (w *compressingWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return err
+		}
+	}
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	return nil
+}
+
+func (w *compressingWriter) decide(final bool) error {
+	w.decided = true
+	h := w.Header()
+	if len(w.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.compressible() {
+		h.Add("Vary", "Accept-Encoding")
+		if !final || (len(w.buf) > 0 && len(w.buf) >= w.c.minSize) {
+			if zw, err := w.compressor.NewWriter(w.ResponseWriter); err == nil {
+				h.Set("Content-Encoding", w.compressor.ContentEncoding())
+				h.Del("Content-Length")
+				w.zw = zw
+			}
+		}
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.zw != nil {
+		_, err = w.zw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressingWriter) compressible() bool {
+	if w.code != 0 && (w.code < 200 || w.code == http.StatusNoContent || w.code == http.StatusNotModified) {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, pattern := range w.c.contentTypes {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientCompression makes the client accept compressed responses, with the
+// content codings of the compressors, in order of preference, and decompress
+// them before they're decoded. By default, the content codings are gzip then
+// deflate.
+//
+// The size of the compressed response is reported to finalizers under
+// ContextKeyResponseSize, as its Content-Length, and the size of the
+// decompressed body read by the decoder under
+// ContextKeyResponseUncompressedSize.
+func ClientCompression(compressors ...Compressor) ClientOption {
+	if len(compressors) == 0 {
+		compressors = []Compressor{
+			GzipCompressor(gzip.DefaultCompression),
+			DeflateCompressor(zlib.DefaultCompression),
+		}
+	}
+	return func(c *Client) { c.compression = &compression{compressors: compressors} }
+}
+
+// decompressResponse replaces the body of the response with its decompressed
+// body, if it has a single content coding of the compressors. It returns the
+// counter of the bytes read from the decompressed body, or nil if the body
+// isn't compressed.
+func (c *compression) decompressResponse(resp *http.Response) (*countingReader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	compressor := c.compressor(encoding)
+	if compressor == nil {
+		return nil, nil
+	}
+	zr, err := compressor.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{Reader: zr}
+	resp.Body = decompressedBody{Reader: counter, zr: zr, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.Uncompressed = true
+	return counter, nil
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// limitedBody fails with a *RequestTooLargeError once more than max bytes are
+// read, as http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+	n, max int64 // n bytes left
+	err    error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1] // one more byte tells whether the body is too large
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.n {
+		b.n -= int64(n)
+		return n, err
+	}
+	n, b.n = int(b.n), 0
+	b.err = &RequestTooLargeError{Limit: b.max}
+	return n, b.err
+}
+
+type decompressedBody struct {
+	io.Reader
+	zr   io.Closer
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	b.zr.Close()
+	return b.body.Close()
+}
+
+// UnsupportedEncodingError is returned by servers when the content coding of
+// a request body isn't supported. It's encoded as 415 Unsupported Media Type,
+// with an Accept-Encoding header listing the supported content codings, as
+// per RFC 7694.
+type UnsupportedEncodingError struct {
+	Encoding  string
+	Available []string
+}
+
+// Error implements error.
+func (e *UnsupportedEncodingError) Error() string {
+	return "unsupported content encoding " + strconv.Quote(e.Encoding) + ", want one of " + strings.Join(e.Available, ", ")
+}
+
+// StatusCode implements StatusCoder.
+func (e *UnsupportedEncodingError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// Headers implements Headerer.
+func (e *UnsupportedEncodingError) Headers() http.Header {
+	return http.Header{"Accept-Encoding": {strings.Join(e.Available, ", ")}}
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *UnsupportedEncodingError) ErrorKind() errkind.Kind {
+	return errkind.Invalid
+}
+
+// RequestTooLargeError is returned by the decompressed body of a request when
+// it's larger than the maximum decompressed size. It's encoded as 413 Payload
+// Too Large.
+type RequestTooLargeError struct {
+	Limit int64
+}
+
+// Error implements error.
+func (e *RequestTooLargeError) Error() string {
+	return "decompressed request body larger than " + strconv.FormatInt(e.Limit, 10) + " bytes"
+}
+
+// StatusCode implements StatusCoder.
+func (e *RequestTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *RequestTooLargeError) ErrorKind() errkind.Kind {
+	return errkind.Invalid
+}
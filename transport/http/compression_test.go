@@ -0,0 +1,215 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/zstd"
+)
+
+// newEchoServer returns a server responding with the request body, or body if
+// the request has none, with the content type.
+func newEchoServer(contentType, body string, options ...httptransport.ServerOption) *httptest.Server {
+	return httptest.NewServer(httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			if request.(string) == "" {
+				return body, nil
+			}
+			return request, nil
+		},
+		func(_ context.Context, r *http.Request) (interface{}, error) {
+			b, err := ioutil.ReadAll(r.Body)
+			return string(b), err
+		},
+		func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+			w.Header().Set("Content-Type", contentType)
+			_, err := w.Write([]byte(response.(string)))
+			return err
+		},
+		options...,
+	))
+}
+
+func TestServerCompression(t *testing.T) {
+	large := strings.Repeat(`{"name":"kit"},`, 200)
+	for _, tc := range []struct {
+		name, contentType, body, acceptEncoding string
+		options                                 []httptransport.CompressionOption
+		want                                    string
+	}{
+		{"gzip", "application/json", large, "gzip", nil, "gzip"},
+		{"preferred", "application/json", large, "deflate, gzip", nil, "gzip"},
+		{"q", "application/json", large, "gzip;q=0.5, deflate", nil, "deflate"},
+		{"wildcard", "text/plain", large, "*", nil, "gzip"},
+		{"refused", "application/json", large, "gzip;q=0, *;q=0", nil, ""},
+		{"identity", "application/json", large, "", nil, ""},
+		{"small", "application/json", "{}", "gzip", nil, ""},
+		{"type", "image/png", large, "gzip", nil, ""},
+		{"allowlist", "application/msgpack", large, "gzip", []httptransport.CompressionOption{
+			httptransport.CompressionContentTypes("application/msgpack"),
+		}, "gzip"},
+		{"min size", "application/json", "{}", "gzip", []httptransport.CompressionOption{
+			httptransport.CompressionMinSize(1),
+		}, "gzip"},
+		{"zstd", "application/json", large, "gzip, zstd", []httptransport.CompressionOption{
+			httptransport.CompressionCompressors(zstd.NewCompressor(zstd.SpeedDefault), httptransport.GzipCompressor(gzip.BestSpeed)),
+		}, "zstd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var size, uncompressed int64
+			server := newEchoServer(tc.contentType, tc.body,
+				httptransport.ServerCompression(tc.options...),
+				httptransport.ServerFinalizer(func(ctx context.Context, code int, r *http.Request) {
+					size = ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+					uncompressed = ctx.Value(httptransport.ContextKeyResponseUncompressedSize).(int64)
+				}),
+			)
+			defer server.Close()
+
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if want, have := tc.want, resp.Header.Get("Content-Encoding"); want != have {
+				t.Fatalf("want Content-Encoding %q, have %q", want, have)
+			}
+			if want, have := int64(len(tc.body)), uncompressed; want != have {
+				t.Errorf("want uncompressed size %d, have %d", want, have)
+			}
+			if want, have := int64(len(b)), size; want != have {
+				t.Errorf("want size %d, have %d", want, have)
+			}
+			if tc.want == "" {
+				if want, have := tc.body, string(b); want != have {
+					t.Errorf("want %q, have %q", want, have)
+				}
+				return
+			}
+			if size >= uncompressed && len(tc.body) > 2 {
+				t.Errorf("want compressed size %d < %d", size, uncompressed)
+			}
+			if want, have := "Accept-Encoding", resp.Header.Get("Vary"); want != have {
+				t.Errorf("want Vary %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestServerRequestDecompression(t *testing.T) {
+	server := newEchoServer("text/plain", "", httptransport.ServerCompression())
+	defer server.Close()
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte("hello kit"))
+	zw.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want, have := "hello kit", string(b); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	req, _ = http.NewRequest("POST", server.URL, strings.NewReader("hello"))
+	req.Header.Set("Content-Encoding", "br")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusUnsupportedMediaType, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := "gzip, deflate", resp.Header.Get("Accept-Encoding"); want != have {
+		t.Errorf("want Accept-Encoding %q, have %q", want, have)
+	}
+}
+
+func TestServerRequestDecompressionLimit(t *testing.T) {
+	server := newEchoServer("text/plain", "", httptransport.ServerCompression(
+		httptransport.CompressionMaxDecompressedSize(1024),
+	))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		size int
+		want int
+	}{
+		{1024, http.StatusOK},
+		{1025, http.StatusRequestEntityTooLarge},
+		{1 << 20, http.StatusRequestEntityTooLarge},
+	} {
+		var body bytes.Buffer
+		zw := gzip.NewWriter(&body)
+		zw.Write(make([]byte, tc.size))
+		zw.Close()
+
+		req, _ := http.NewRequest("POST", server.URL, &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want, have := tc.want, resp.StatusCode; want != have {
+			t.Errorf("%d bytes: want %d, have %d: %s", tc.size, want, have, b)
+		}
+	}
+}
+
+func TestClientCompression(t *testing.T) {
+	large := strings.Repeat("hello kit ", 200)
+	server := newEchoServer("text/plain", large, httptransport.ServerCompression(
+		httptransport.CompressionCompressors(zstd.NewCompressor(zstd.SpeedFastest)),
+	))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	var size, uncompressed int64
+	client := httptransport.NewClient(
+		"GET", u,
+		func(context.Context, *http.Request, interface{}) error { return nil },
+		func(_ context.Context, resp *http.Response) (interface{}, error) {
+			b, err := ioutil.ReadAll(resp.Body)
+			return string(b), err
+		},
+		httptransport.ClientCompression(zstd.NewCompressor(zstd.SpeedFastest)),
+		httptransport.ClientFinalizer(func(ctx context.Context, err error) {
+			size = ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+			uncompressed = ctx.Value(httptransport.ContextKeyResponseUncompressedSize).(int64)
+		}),
+	)
+	response, err := client.Endpoint()(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := large, response.(string); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := int64(len(large)), uncompressed; want != have {
+		t.Errorf("want uncompressed size %d, have %d", want, have)
+	}
+	if size >= uncompressed {
+		t.Errorf("want compressed size %d < %d", size, uncompressed)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -37,6 +40,23 @@ type clientRequest struct {
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params"`
 	ID      interface{}     `json:"id"`
+
+	// Notification omits the ID, so that the server doesn't respond. A nil
+	// ID of a request that isn't a notification is sent as null.
+	Notification bool `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r clientRequest) MarshalJSON() ([]byte, error) {
+	if r.Notification {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			Method  string          `json:"method"`
+			Params  json.RawMessage `json:"params"`
+		}{r.JSONRPC, r.Method, r.Params})
+	}
+	type request clientRequest // without the MarshalJSON method
+	return json.Marshal(request(r))
 }
 
 // NewClient constructs a usable Client for a single remote method.
@@ -142,72 +162,256 @@ func BufferedStream(buffered bool) ClientOption {
 // Endpoint returns a usable endpoint that invokes the remote endpoint.
 func (c Client) Endpoint() endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
+		return c.do(ctx, func(ctx context.Context) (interface{}, error) {
+			params, err := c.enc(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			return clientRequest{
+				JSONRPC: Version,
+				Method:  c.method,
+				Params:  params,
+				ID:      c.requestID.Generate(),
+			}, nil
+		}, func(ctx context.Context, body io.Reader) (interface{}, error) {
+			// Decode the body into an object
+			var rpcRes Response
+			if err := json.NewDecoder(body).Decode(&rpcRes); err != nil {
+				return nil, err
+			}
+			return c.dec(ctx, rpcRes)
+		})
+	}
+}
 
-		var (
-			resp *http.Response
-			err  error
-		)
-		if c.finalizer != nil {
-			defer func() {
-				if resp != nil {
-					ctx = context.WithValue(ctx, httptransport.ContextKeyResponseHeaders, resp.Header)
-					ctx = context.WithValue(ctx, httptransport.ContextKeyResponseSize, resp.ContentLength)
-				}
-				c.finalizer(ctx, err)
-			}()
-		}
+// NotificationEndpoint returns a usable endpoint that invokes the remote
+// endpoint with a notification, i.e. a request without an ID. The server
+// doesn't respond to notifications, so the endpoint's response is always nil.
+func (c Client) NotificationEndpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return c.do(ctx, func(ctx context.Context) (interface{}, error) {
+			params, err := c.enc(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			return clientRequest{
+				JSONRPC:      Version,
+				Method:       c.method,
+				Params:       params,
+				Notification: true,
+			}, nil
+		}, nil)
+	}
+}
 
-		var params json.RawMessage
-		if params, err = c.enc(ctx, request); err != nil {
-			return nil, err
-		}
-		rpcReq := clientRequest{
-			JSONRPC: Version,
-			Method:  c.method,
-			Params:  params,
-			ID:      c.requestID.Generate(),
-		}
+// do builds the body of the HTTP request with build, sends it, and decodes
+// the HTTP response body with decode. If decode is nil, the response body is
+// ignored and do returns a nil response.
+func (c Client) do(
+	ctx context.Context,
+	build func(context.Context) (interface{}, error),
+	decode func(context.Context, io.Reader) (interface{}, error),
+) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	if c.finalizer != nil {
+		defer func() {
+			if resp != nil {
+				ctx = context.WithValue(ctx, httptransport.ContextKeyResponseHeaders, resp.Header)
+				ctx = context.WithValue(ctx, httptransport.ContextKeyResponseSize, resp.ContentLength)
+			}
+			c.finalizer(ctx, err)
+		}()
+	}
 
-		req, err := http.NewRequest("POST", c.tgt.String(), nil)
-		if err != nil {
-			return nil, err
-		}
+	var rpcReq interface{}
+	if rpcReq, err = build(ctx); err != nil {
+		return nil, err
+	}
 
-		req.Header.Set("Content-Type", "application/json; charset=utf-8")
-		var b bytes.Buffer
-		req.Body = ioutil.NopCloser(&b)
-		err = json.NewEncoder(&b).Encode(rpcReq)
-		if err != nil {
-			return nil, err
-		}
+	req, err := http.NewRequest("POST", c.tgt.String(), nil)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, f := range c.before {
-			ctx = f(ctx, req)
-		}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var b bytes.Buffer
+	req.Body = ioutil.NopCloser(&b)
+	err = json.NewEncoder(&b).Encode(rpcReq)
+	if err != nil {
+		return nil, err
+	}
 
-		resp, err = c.client.Do(req.WithContext(ctx))
-		if err != nil {
-			return nil, err
-		}
+	for _, f := range c.before {
+		ctx = f(ctx, req)
+	}
 
-		if !c.bufferedStream {
-			defer resp.Body.Close()
-		}
+	resp, err = c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
 
-		for _, f := range c.after {
-			ctx = f(ctx, resp)
-		}
+	if !c.bufferedStream || decode == nil {
+		defer resp.Body.Close()
+	}
 
-		// Decode the body into an object
-		var rpcRes Response
-		err = json.NewDecoder(resp.Body).Decode(&rpcRes)
-		if err != nil {
-			return nil, err
+	for _, f := range c.after {
+		ctx = f(ctx, resp)
+	}
+
+	if decode == nil {
+		return nil, nil
+	}
+	var response interface{}
+	response, err = decode(ctx, resp.Body)
+	return response, err
+}
+
+// BatchCall is a single call within a batch request.
+type BatchCall struct {
+	// Method is the name of the remote method.
+	Method string
+
+	// Request is encoded to the params of the call.
+	Request interface{}
+
+	// Notification makes the call a notification, which gets no response.
+	Notification bool
+
+	// Encode and Decode, if set, are used for this call instead of the
+	// batch client's encoder and decoder.
+	Encode EncodeRequestFunc
+	Decode DecodeResponseFunc
+}
+
+// BatchResult is the outcome of a single call within a batch request.
+type BatchResult struct {
+	Response interface{}
+	Err      error
+}
+
+// BatchClient sends several calls to a JSON RPC server in a single batch
+// request.
+type BatchClient struct {
+	c *Client
+}
+
+// NewBatchClient constructs a usable BatchClient. The options are the same as
+// for a Client; the encoder and decoder they set are used for calls that don't
+// set their own.
+func NewBatchClient(tgt *url.URL, options ...ClientOption) *BatchClient {
+	return &BatchClient{c: NewClient(tgt, "", options...)}
+}
+
+// Endpoint returns a usable endpoint that invokes the remote methods in a
+// single batch request. Its request must be a []BatchCall, and its response
+// is a []BatchResult, with one result per call, in the same order. Responses
+// are matched to calls by ID, and the results of notifications are always
+// empty. Errors of individual calls are reported in their results; the
+// endpoint only fails if the batch as a whole does.
+func (b BatchClient) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		calls, ok := request.([]BatchCall)
+		if !ok {
+			return nil, fmt.Errorf("jsonrpc: batch request must be a []BatchCall, not %T", request)
+		}
+		if len(calls) == 0 {
+			return []BatchResult{}, nil
 		}
 
-		return c.dec(ctx, rpcRes)
+		var (
+			c   = b.c
+			ids = map[string]int{} // call index by marshaled ID
+		)
+		build := func(ctx context.Context) (interface{}, error) {
+			rpcReqs := make([]clientRequest, len(calls))
+			for i, call := range calls {
+				enc := c.enc
+				if call.Encode != nil {
+					enc = call.Encode
+				}
+				params, err := enc(ctx, call.Request)
+				if err != nil {
+					return nil, err
+				}
+				rpcReqs[i] = clientRequest{
+					JSONRPC:      Version,
+					Method:       call.Method,
+					Params:       params,
+					Notification: call.Notification,
+				}
+				if call.Notification {
+					continue
+				}
+				id := c.requestID.Generate()
+				key, err := json.Marshal(id)
+				if err != nil {
+					return nil, err
+				}
+				rpcReqs[i].ID = id
+				ids[string(key)] = i
+			}
+			return rpcReqs, nil
+		}
+		decode := func(ctx context.Context, body io.Reader) (interface{}, error) {
+			results := make([]BatchResult, len(calls))
+			if len(ids) == 0 {
+				return results, nil // only notifications
+			}
+
+			var raw json.RawMessage
+			if err := json.NewDecoder(body).Decode(&raw); err != nil {
+				return nil, err
+			}
+			if !isBatch(raw) {
+				// The batch as a whole was rejected.
+				var rpcRes Response
+				if err := json.Unmarshal(raw, &rpcRes); err != nil {
+					return nil, err
+				}
+				if rpcRes.Error != nil {
+					return nil, *rpcRes.Error
+				}
+				return nil, errors.New("jsonrpc: batch response is not an array")
+			}
+			var rpcRess []Response
+			if err := json.Unmarshal(raw, &rpcRess); err != nil {
+				return nil, err
+			}
+
+			answered := make([]bool, len(calls))
+			for _, rpcRes := range rpcRess {
+				if rpcRes.ID == nil {
+					continue
+				}
+				key, err := json.Marshal(rpcRes.ID)
+				if err != nil {
+					continue
+				}
+				i, ok := ids[string(key)]
+				if !ok || answered[i] {
+					continue
+				}
+				dec := c.dec
+				if calls[i].Decode != nil {
+					dec = calls[i].Decode
+				}
+				results[i].Response, results[i].Err = dec(ctx, rpcRes)
+				answered[i] = true
+			}
+			for i, call := range calls {
+				if !call.Notification && !answered[i] {
+					results[i].Err = fmt.Errorf("jsonrpc: no response to %s call", call.Method)
+				}
+			}
+			return results, nil
+		}
+		return c.do(ctx, build, decode)
 	}
 }
 
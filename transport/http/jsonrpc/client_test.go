@@ -367,3 +367,135 @@ func mustParse(s string) *url.URL {
 	}
 	return u
 }
+
+func TestClientNotification(t *testing.T) {
+	t.Parallel()
+
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sut := jsonrpc.NewClient(mustParse(server.URL), "add")
+	result, err := sut.NotificationEndpoint()(context.Background(), []int{2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != nil {
+		t.Errorf("want nil result, have %v", result)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(requestBody, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := fields["id"]; ok {
+		t.Errorf("want no id, have %s", id)
+	}
+}
+
+type nilIDGenerator struct{}
+
+func (nilIDGenerator) Generate() interface{} { return nil }
+
+func TestClientNilID(t *testing.T) {
+	t.Parallel()
+
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":4,"id":null}`))
+	}))
+	defer server.Close()
+
+	// A nil ID is sent as null, rather than turning the call into a
+	// notification.
+	sut := jsonrpc.NewClient(mustParse(server.URL), "add", jsonrpc.ClientRequestIDGenerator(nilIDGenerator{}))
+	if _, err := sut.Endpoint()(context.Background(), []int{2, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(requestBody, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "null", string(fields["id"]); want != have {
+		t.Errorf("want id %s, have %s", want, have)
+	}
+}
+
+func TestBatchClient(t *testing.T) {
+	t.Parallel()
+
+	var notified = make(chan interface{}, 1)
+	server := httptest.NewServer(jsonrpc.NewServer(jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				ab := request.([]int)
+				return ab[0] + ab[1], nil
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) {
+				var ab []int
+				err := json.Unmarshal(msg, &ab)
+				return ab, err
+			},
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+		"log": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				notified <- request
+				return nil, nil
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) { return string(msg), nil },
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+	}))
+	defer server.Close()
+
+	sut := jsonrpc.NewBatchClient(mustParse(server.URL))
+	response, err := sut.Endpoint()(context.Background(), []jsonrpc.BatchCall{
+		{Method: "add", Request: []int{1, 2}},
+		{Method: "log", Request: "hello", Notification: true},
+		{Method: "sub", Request: []int{1, 2}},
+		{Method: "add", Request: []int{3, 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := response.([]jsonrpc.BatchResult)
+	if want, have := 4, len(results); want != have {
+		t.Fatalf("want %d results, have %d", want, have)
+	}
+	if want, have := 3.0, results[0].Response; want != have || results[0].Err != nil {
+		t.Errorf("result 0: want %v, have %v (%v)", want, have, results[0].Err)
+	}
+	if results[1].Response != nil || results[1].Err != nil {
+		t.Errorf("result 1: want empty, have %+v", results[1])
+	}
+	if rpcErr, ok := results[2].Err.(jsonrpc.Error); !ok || rpcErr.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("result 2: want method not found, have %v", results[2].Err)
+	}
+	if want, have := 7.0, results[3].Response; want != have || results[3].Err != nil {
+		t.Errorf("result 3: want %v, have %v (%v)", want, have, results[3].Err)
+	}
+	if want, have := `"hello"`, <-notified; want != have {
+		t.Errorf("notification: want %v, have %v", want, have)
+	}
+}
+
+func TestBatchClientRejected(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "oof"}, "id": null}`))
+	}))
+	defer server.Close()
+
+	sut := jsonrpc.NewBatchClient(mustParse(server.URL))
+	_, err := sut.Endpoint()(context.Background(), []jsonrpc.BatchCall{{Method: "add"}})
+	if rpcErr, ok := err.(jsonrpc.Error); !ok || rpcErr.Code != jsonrpc.ParseError {
+		t.Errorf("want parse error, have %v", err)
+	}
+}
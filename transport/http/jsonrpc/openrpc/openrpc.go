@@ -0,0 +1,262 @@
+// Package openrpc generates OpenRPC documents describing JSON RPC services.
+// Methods are recorded in a Registry as they're added to the
+// jsonrpc.EndpointCodecMap, with example values of their params, result and
+// error types, whose schemas are derived from the Go types by reflection.
+// See https://spec.open-rpc.org.
+//
+//	api := openrpc.NewRegistry(openapi.Info{Title: "Calculator", Version: "1.0.0"})
+//	ecm := jsonrpc.EndpointCodecMap{
+//	    "add": api.Register("add", addCodec,
+//	        openrpc.ParamsType(addRequest{}),
+//	        openrpc.ResultType(addResponse{}),
+//	    ),
+//	}
+//	ecm["rpc.discover"] = api.Discover()
+package openrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+	"github.com/go-kit/kit/transport/http/openapi"
+)
+
+// Version is the version of the OpenRPC specification of the documents.
+const Version = "1.2.6"
+
+// Document is an OpenRPC document, limited to the objects the Registry emits.
+type Document struct {
+	OpenRPC    string       `json:"openrpc"`
+	Info       openapi.Info `json:"info"`
+	Servers    []Server     `json:"servers,omitempty"`
+	Methods    []*Method    `json:"methods"`
+	Components Components   `json:"components"`
+}
+
+// Server is a server hosting a service.
+type Server struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Method describes a single method of a service.
+type Method struct {
+	Name           string               `json:"name"`
+	Summary        string               `json:"summary,omitempty"`
+	Description    string               `json:"description,omitempty"`
+	ParamStructure string               `json:"paramStructure,omitempty"`
+	Params         []*ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor   `json:"result,omitempty"`
+	Errors         []*jsonrpc.Error     `json:"errors,omitempty"`
+}
+
+// ContentDescriptor describes the params or the result of a method.
+type ContentDescriptor struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Required    bool            `json:"required,omitempty"`
+	Schema      *openapi.Schema `json:"schema"`
+}
+
+// Components holds the reusable schemas of a document.
+type Components struct {
+	Schemas map[string]*openapi.Schema `json:"schemas,omitempty"`
+}
+
+// Registry records the methods of a JSON RPC service as they're registered,
+// and emits an OpenRPC document describing them. It implements http.Handler,
+// serving the document as JSON, so that it can be mounted at any path.
+type Registry struct {
+	mtx     sync.Mutex
+	info    openapi.Info
+	servers []Server
+	methods []*method
+}
+
+// RegistryOption sets an optional parameter for registries.
+type RegistryOption func(*Registry)
+
+// Servers sets the servers hosting the service.
+func Servers(servers ...Server) RegistryOption {
+	return func(r *Registry) { r.servers = append(r.servers, servers...) }
+}
+
+// NewRegistry returns an empty registry of a service.
+func NewRegistry(info openapi.Info, options ...RegistryOption) *Registry {
+	r := &Registry{info: info}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+type method struct {
+	m      Method
+	params interface{}
+	result interface{}
+	errors []error
+}
+
+// MethodOption sets an optional parameter of a registered method.
+type MethodOption func(*method)
+
+// ParamsType sets the params type of the method, by an example value,
+// typically what the method's DecodeRequestFunc returns. The fields of a
+// struct are params by name, following the rules of encoding/json; any other
+// type is a single param, named "params".
+func ParamsType(v interface{}) MethodOption {
+	return func(m *method) { m.params = v }
+}
+
+// ResultType sets the result type of the method, by an example value,
+// typically what the endpoint returns.
+func ResultType(v interface{}) MethodOption {
+	return func(m *method) { m.result = v }
+}
+
+// ErrorTypes adds the errors the method may return, by example values, as
+// encoded by the jsonrpc.DefaultErrorEncoder: the code is InternalError unless
+// the error implements jsonrpc.ErrorCoder, and the message is the error's.
+func ErrorTypes(errs ...error) MethodOption {
+	return func(m *method) { m.errors = append(m.errors, errs...) }
+}
+
+// Summary sets the short summary of the method.
+func Summary(summary string) MethodOption {
+	return func(m *method) { m.m.Summary = summary }
+}
+
+// Description sets the longer description of the method.
+func Description(description string) MethodOption {
+	return func(m *method) { m.m.Description = description }
+}
+
+// Register records the method served by ec. It returns ec, so that
+// registration can wrap the building of the jsonrpc.EndpointCodecMap.
+func (r *Registry) Register(name string, ec jsonrpc.EndpointCodec, options ...MethodOption) jsonrpc.EndpointCodec {
+	m := &method{m: Method{Name: name}}
+	for _, option := range options {
+		option(m)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.methods = append(r.methods, m)
+	return ec
+}
+
+// Document returns the OpenRPC document of the methods registered so far.
+func (r *Registry) Document() *Document {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	schemas := openapi.NewSchemas()
+	doc := &Document{
+		OpenRPC: Version,
+		Info:    r.info,
+		Servers: r.servers,
+		Methods: make([]*Method, 0, len(r.methods)),
+	}
+	for _, m := range r.methods {
+		doc.Methods = append(doc.Methods, m.build(schemas))
+	}
+	doc.Components.Schemas = schemas.Components()
+	return doc
+}
+
+// ServeHTTP implements http.Handler, serving the OpenRPC document as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(r.Document())
+}
+
+// Discover returns an EndpointCodec serving the OpenRPC document, to be added
+// to the jsonrpc.EndpointCodecMap as the "rpc.discover" method, as specified
+// by OpenRPC.
+func (r *Registry) Discover() jsonrpc.EndpointCodec {
+	return jsonrpc.EndpointCodec{
+		Endpoint: func(context.Context, interface{}) (interface{}, error) {
+			return r.Document(), nil
+		},
+		Decode: func(context.Context, json.RawMessage) (interface{}, error) {
+			return nil, nil
+		},
+		Encode: func(_ context.Context, response interface{}) (json.RawMessage, error) {
+			return json.Marshal(response)
+		},
+	}
+}
+
+const componentPrefix = "#/components/schemas/"
+
+func (m *method) build(schemas *openapi.Schemas) *Method {
+	out := m.m
+	out.Params = []*ContentDescriptor{}
+	if m.params != nil {
+		schema := schemas.For(m.params)
+		if strings.HasPrefix(schema.Ref, componentPrefix) {
+			schema = schemas.Components()[strings.TrimPrefix(schema.Ref, componentPrefix)]
+		}
+		if schema.Type == "object" && schema.Properties != nil {
+			out.ParamStructure = "by-name"
+			required := map[string]bool{}
+			for _, name := range schema.Required {
+				required[name] = true
+			}
+			for _, name := range fieldOrder(reflect.TypeOf(m.params), schema) {
+				out.Params = append(out.Params, &ContentDescriptor{
+					Name:     name,
+					Required: required[name],
+					Schema:   schema.Properties[name],
+				})
+			}
+		} else {
+			out.Params = append(out.Params, &ContentDescriptor{Name: "params", Required: true, Schema: schema})
+		}
+	}
+	if m.result != nil {
+		out.Result = &ContentDescriptor{Name: "result", Schema: schemas.For(m.result)}
+	}
+	for _, err := range m.errors {
+		e := &jsonrpc.Error{Code: jsonrpc.InternalError, Message: err.Error()}
+		if ec, ok := err.(jsonrpc.ErrorCoder); ok {
+			e.Code = ec.ErrorCode()
+		}
+		out.Errors = append(out.Errors, e)
+	}
+	return &out
+}
+
+// fieldOrder returns the property names of schema, in the order of the fields
+// of the struct type t, so that params are listed in declaration order.
+func fieldOrder(t reflect.Type, schema *openapi.Schema) []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			if _, ok := schema.Properties[name]; ok && !seen[name] {
+				names, seen[name] = append(names, name), true
+			} else if f.Anonymous {
+				walk(f.Type)
+			}
+		}
+	}
+	walk(t)
+	return names
+}
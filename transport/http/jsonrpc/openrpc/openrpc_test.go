@@ -0,0 +1,89 @@
+package openrpc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+	"github.com/go-kit/kit/transport/http/jsonrpc/openrpc"
+	"github.com/go-kit/kit/transport/http/openapi"
+)
+
+type addRequest struct {
+	A     int     `json:"a"`
+	B     int     `json:"b"`
+	Scale *string `json:"scale"`
+}
+
+type addResponse struct {
+	Sum int `json:"sum"`
+}
+
+type overflowError struct{}
+
+func (overflowError) Error() string  { return "overflow" }
+func (overflowError) ErrorCode() int { return 1 }
+
+func TestRegistry(t *testing.T) {
+	api := openrpc.NewRegistry(openapi.Info{Title: "Calculator", Version: "1.0.0"})
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": api.Register("add", jsonrpc.EndpointCodec{},
+			openrpc.Summary("Adds two numbers."),
+			openrpc.ParamsType(addRequest{}),
+			openrpc.ResultType(addResponse{}),
+			openrpc.ErrorTypes(overflowError{}, errors.New("internal")),
+		),
+		"ping": api.Register("ping", jsonrpc.EndpointCodec{}, openrpc.ParamsType([]string{})),
+	}
+	ecm["rpc.discover"] = api.Discover()
+
+	server := httptest.NewServer(jsonrpc.NewServer(ecm))
+	defer server.Close()
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"rpc.discover","id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Result openrpc.Document
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	doc := res.Result
+
+	if want, have := openrpc.Version, doc.OpenRPC; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := 2, len(doc.Methods); want != have {
+		t.Fatalf("want %d methods, have %d", want, have)
+	}
+	add := doc.Methods[0]
+	if want, have := `{"name":"add","summary":"Adds two numbers.","paramStructure":"by-name",`+
+		`"params":[{"name":"a","required":true,"schema":{"type":"integer","format":"int64"}},`+
+		`{"name":"b","required":true,"schema":{"type":"integer","format":"int64"}},`+
+		`{"name":"scale","schema":{"type":"string","nullable":true}}],`+
+		`"result":{"name":"result","schema":{"$ref":"#/components/schemas/addResponse"}},`+
+		`"errors":[{"code":1,"message":"overflow"},{"code":-32603,"message":"internal"}]}`, marshal(t, add); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if want, have := `{"name":"ping","params":[{"name":"params","required":true,"schema":{"type":"array","items":{"type":"string"}}}]}`, marshal(t, doc.Methods[1]); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if _, ok := doc.Components.Schemas["addResponse"]; !ok {
+		t.Errorf("no addResponse schema in %v", doc.Components.Schemas)
+	}
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
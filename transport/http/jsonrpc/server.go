@@ -1,11 +1,13 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"github.com/go-kit/kit/log"
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -23,6 +25,8 @@ type Server struct {
 	errorEncoder httptransport.ErrorEncoder
 	finalizer    httptransport.ServerFinalizerFunc
 	logger       log.Logger
+
+	batchConcurrency int
 }
 
 // NewServer constructs a new server, which implements http.Server.
@@ -34,10 +38,15 @@ func NewServer(
 		ecm:          ecm,
 		errorEncoder: DefaultErrorEncoder,
 		logger:       log.NewNopLogger(),
+
+		batchConcurrency: 10,
 	}
 	for _, option := range options {
 		option(s)
 	}
+	if s.batchConcurrency < 1 {
+		s.batchConcurrency = 1
+	}
 	return s
 }
 
@@ -79,6 +88,12 @@ func ServerFinalizer(f httptransport.ServerFinalizerFunc) ServerOption {
 	return func(s *Server) { s.finalizer = f }
 }
 
+// ServerBatchConcurrency sets the maximum number of entries of a batch request
+// that are handled concurrently. By default, it's 10.
+func ServerBatchConcurrency(n int) ServerOption {
+	return func(s *Server) { s.batchConcurrency = n }
+}
+
 // ServeHTTP implements http.Handler.
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -99,9 +114,10 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = f(ctx, r)
 	}
 
-	// Decode the body into an  object
-	var req Request
-	err := json.NewDecoder(r.Body).Decode(&req)
+	// Decode the body, which holds either a single request object or an
+	// array of them.
+	var raw json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&raw)
 	if err != nil {
 		rpcerr := parseError("JSON could not be decoded: " + err.Error())
 		s.logger.Log("err", rpcerr)
@@ -109,57 +125,203 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx = context.WithValue(ctx, requestIDKey, req.ID)
-
-	// Get the endpoint and codecs from the map using the method
-	// defined in the JSON  object
-	ecm, ok := s.ecm[req.Method]
-	if !ok {
-		err := methodNotFoundError(fmt.Sprintf("Method %s was not found.", req.Method))
-		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
+	if isBatch(raw) {
+		s.serveBatch(ctx, w, raw)
 		return
 	}
 
-	// Decode the JSON "params"
-	reqParams, err := ecm.Decode(ctx, req.Params)
+	req, notification, err := decodeRequest(raw)
 	if err != nil {
 		s.logger.Log("err", err)
 		s.errorEncoder(ctx, err, w)
 		return
 	}
 
-	// Call the Endpoint with the params
-	response, err := ecm.Endpoint(ctx, reqParams)
+	ctx = context.WithValue(ctx, requestIDKey, req.ID)
+
+	resParams, err := invoke(ctx, s.ecm, req, func(ctx context.Context) context.Context {
+		for _, f := range s.after {
+			ctx = f(ctx, w)
+		}
+		return ctx
+	})
 	if err != nil {
 		s.logger.Log("err", err)
-		s.errorEncoder(ctx, err, w)
+	}
+
+	// Notifications get no response, not even an error.
+	if notification {
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	for _, f := range s.after {
-		ctx = f(ctx, w)
+	if err != nil {
+		s.errorEncoder(ctx, err, w)
+		return
 	}
 
-	res := Response{
+	w.Header().Set("Content-Type", ContentType)
+	_ = json.NewEncoder(w).Encode(Response{
 		ID:      req.ID,
 		JSONRPC: Version,
+		Result:  resParams,
+	})
+}
+
+// invoke calls the endpoint in ecm that req is routed to, and returns its
+// encoded result. The after func, if not nil, is called once the endpoint
+// succeeded, before the response is encoded.
+func invoke(ctx context.Context, ecm EndpointCodecMap, req Request, after func(context.Context) context.Context) (json.RawMessage, error) {
+	// Get the endpoint and codecs from the map using the method
+	// defined in the JSON  object
+	ec, ok := ecm[req.Method]
+	if !ok {
+		return nil, methodNotFoundError(fmt.Sprintf("Method %s was not found.", req.Method))
 	}
 
-	// Encode the response from the Endpoint
-	resParams, err := ecm.Encode(ctx, response)
+	// Decode the JSON "params"
+	reqParams, err := ec.Decode(ctx, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the Endpoint with the params
+	response, err := ec.Endpoint(ctx, reqParams)
 	if err != nil {
+		return nil, err
+	}
+
+	if after != nil {
+		ctx = after(ctx)
+	}
+
+	// Encode the response from the Endpoint
+	return ec.Encode(ctx, response)
+}
+
+// serveBatch handles a batch request. Its entries are handled concurrently,
+// and the responses to those that aren't notifications are written as an
+// array. ServerAfter funcs are called once per entry, one at a time, and
+// errors are encoded with the server's ErrorEncoder into the array.
+func (s Server) serveBatch(ctx context.Context, w http.ResponseWriter, raw json.RawMessage) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		rpcerr := parseError("JSON could not be decoded: " + err.Error())
+		s.logger.Log("err", rpcerr)
+		s.errorEncoder(ctx, rpcerr, w)
+		return
+	}
+	if len(entries) == 0 {
+		err := invalidRequestError("Batch must contain at least one request.")
 		s.logger.Log("err", err)
 		s.errorEncoder(ctx, err, w)
 		return
 	}
 
-	res.Result = resParams
+	var (
+		responses = make([]json.RawMessage, len(entries))
+		headers   = make([]http.Header, len(entries))
+		sem       = make(chan struct{}, s.batchConcurrency)
+		mtx       sync.Mutex // serializes ServerAfter funcs
+		wg        sync.WaitGroup
+	)
+	after := func(ctx context.Context) context.Context {
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, f := range s.after {
+			ctx = f(ctx, w)
+		}
+		return ctx
+	}
+	for i, entry := range entries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, entry json.RawMessage) {
+			defer func() { <-sem; wg.Done() }()
+			responses[i], headers[i] = s.serveBatchEntry(ctx, entry, after)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	res := make([]json.RawMessage, 0, len(responses))
+	for i, response := range responses {
+		for k := range headers[i] {
+			w.Header().Set(k, headers[i].Get(k))
+		}
+		if response != nil {
+			res = append(res, response)
+		}
+	}
+
+	// A batch of notifications gets no response.
+	if len(res) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
 	w.Header().Set("Content-Type", ContentType)
 	_ = json.NewEncoder(w).Encode(res)
 }
 
+// serveBatchEntry handles a single entry of a batch request, and returns its
+// response, or nil for notifications, along with the headers set by the
+// ErrorEncoder, if any.
+func (s Server) serveBatchEntry(ctx context.Context, entry json.RawMessage, after func(context.Context) context.Context) (json.RawMessage, http.Header) {
+	req, notification, err := decodeRequest(entry)
+	if err == nil {
+		ctx = context.WithValue(ctx, requestIDKey, req.ID)
+		var resParams json.RawMessage
+		if resParams, err = invoke(ctx, s.ecm, req, after); err == nil {
+			if notification {
+				return nil, nil
+			}
+			var res []byte
+			if res, err = json.Marshal(Response{
+				ID:      req.ID,
+				JSONRPC: Version,
+				Result:  resParams,
+			}); err == nil {
+				return res, nil
+			}
+		}
+	}
+
+	s.logger.Log("err", err)
+	if notification {
+		return nil, nil
+	}
+
+	bw := &bufferedWriter{header: http.Header{}}
+	s.errorEncoder(ctx, err, bw)
+	if res := bytes.TrimSpace(bw.body.Bytes()); json.Valid(res) {
+		return res, bw.header
+	}
+
+	// The ErrorEncoder didn't write a JSON value, which can't be embedded in
+	// the batch response.
+	res, _ := json.Marshal(errorResponse(ctx, err))
+	return res, nil
+}
+
+// isBatch reports whether raw is an array, i.e. a batch request.
+func isBatch(raw json.RawMessage) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && raw[0] == '['
+}
+
+// decodeRequest decodes a request object, and reports whether it's a
+// notification, i.e. whether it has no id member.
+func decodeRequest(raw json.RawMessage) (req Request, notification bool, err error) {
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return req, false, invalidRequestError("Request object could not be decoded: " + err.Error())
+	}
+	var id struct {
+		ID json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(raw, &id)
+	return req, id.ID == nil, nil
+}
+
 // DefaultErrorEncoder writes the error to the ResponseWriter,
 // as a json-rpc error response, with an InternalError status code.
 // The Error() string of the error will be used as the response error message.
@@ -174,6 +336,14 @@ func DefaultErrorEncoder(ctx context.Context, err error, w http.ResponseWriter)
 		}
 	}
 
+	w.WriteHeader(http.StatusOK)
+
+	_ = json.NewEncoder(w).Encode(errorResponse(ctx, err))
+}
+
+// errorResponse returns the response object for err, with the ID of the
+// request in ctx, if any. If err implements ErrorCoder, its code is used.
+func errorResponse(ctx context.Context, err error) Response {
 	e := Error{
 		Code:    InternalError,
 		Message: err.Error(),
@@ -182,17 +352,15 @@ func DefaultErrorEncoder(ctx context.Context, err error, w http.ResponseWriter)
 		e.Code = sc.ErrorCode()
 	}
 
-	w.WriteHeader(http.StatusOK)
-
 	var requestID *RequestID
 	if v := ctx.Value(requestIDKey); v != nil {
 		requestID = v.(*RequestID)
 	}
-	_ = json.NewEncoder(w).Encode(Response{
+	return Response{
 		ID:      requestID,
 		JSONRPC: Version,
 		Error:   &e,
-	})
+	}
 }
 
 // ErrorCoder is checked by DefaultErrorEncoder. If an error value implements
@@ -217,3 +385,14 @@ func (w *interceptingWriter) WriteHeader(code int) {
 	w.code = code
 	w.ResponseWriter.WriteHeader(code)
 }
+
+// bufferedWriter is an http.ResponseWriter that keeps what's written in
+// memory, so that errors in a batch can be encoded with the ErrorEncoder.
+type bufferedWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header         { return w.header }
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *bufferedWriter) WriteHeader(int)             {}
@@ -369,3 +369,118 @@ func testServer(t *testing.T) (step func(), resp <-chan *http.Response) {
 	}()
 	return func() { stepch <- true }, response
 }
+
+func TestServerNotification(t *testing.T) {
+	var called = make(chan struct{}, 1)
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) {
+				called <- struct{}{}
+				return nil, errors.New("oof")
+			},
+			Decode: nopDecoder,
+			Encode: nopEncoder,
+		},
+	}
+	handler := jsonrpc.NewServer(ecm)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, _ := http.Post(server.URL, "application/json", body(`{"jsonrpc": "2.0", "method": "add", "params": [3, 2]}`))
+	buf, _ := ioutil.ReadAll(resp.Body)
+	if want, have := http.StatusNoContent, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if len(buf) != 0 {
+		t.Errorf("want no body, have %s", buf)
+	}
+	select {
+	case <-called:
+	default:
+		t.Error("endpoint wasn't called")
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				ab := request.([]int)
+				return ab[0] + ab[1], nil
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) {
+				var ab []int
+				err := json.Unmarshal(msg, &ab)
+				return ab, err
+			},
+			Encode: func(_ context.Context, response interface{}) (json.RawMessage, error) {
+				return json.Marshal(response)
+			},
+		},
+	}
+	handler := jsonrpc.NewServer(ecm, jsonrpc.ServerBatchConcurrency(2))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, _ := http.Post(server.URL, "application/json", body(`[
+		{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1},
+		{"jsonrpc": "2.0", "method": "add", "params": [3, 4]},
+		{"jsonrpc": "2.0", "method": "sub", "params": [5, 6], "id": 2},
+		42,
+		{"jsonrpc": "2.0", "method": "add", "params": "oops", "id": 3},
+		{"jsonrpc": "2.0", "method": "add", "params": [7, 8], "id": "four"}
+	]`))
+	buf, _ := ioutil.ReadAll(resp.Body)
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("want %d, have %d", want, have)
+	}
+
+	var res []jsonrpc.Response
+	if err := json.Unmarshal(buf, &res); err != nil {
+		t.Fatalf("Can't decode response: %v (%s)", err, buf)
+	}
+	if want, have := 5, len(res); want != have {
+		t.Fatalf("want %d responses, have %d: %s", want, have, buf)
+	}
+
+	if id, _ := res[0].ID.Int(); id != 1 || string(res[0].Result) != "3" {
+		t.Errorf("response 0: %s", buf)
+	}
+	if res[1].Error == nil || res[1].Error.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("response 1: want method not found, have %s", buf)
+	}
+	if res[2].Error == nil || res[2].Error.Code != jsonrpc.InvalidRequestError || res[2].ID != nil {
+		t.Errorf("response 2: want invalid request, have %s", buf)
+	}
+	if id, _ := res[3].ID.Int(); id != 3 || res[3].Error == nil {
+		t.Errorf("response 3: want error, have %s", buf)
+	}
+	if id, _ := res[4].ID.String(); id != "four" || string(res[4].Result) != "15" {
+		t.Errorf("response 4: %s", buf)
+	}
+}
+
+func TestServerBatchNotifications(t *testing.T) {
+	ecm := jsonrpc.EndpointCodecMap{
+		"add": jsonrpc.EndpointCodec{
+			Endpoint: endpoint.Nop,
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+	}
+	handler := jsonrpc.NewServer(ecm)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, _ := http.Post(server.URL, "application/json", body(`[{"jsonrpc": "2.0", "method": "add"}, {"jsonrpc": "2.0", "method": "add"}]`))
+	if want, have := http.StatusNoContent, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+func TestServerEmptyBatch(t *testing.T) {
+	handler := jsonrpc.NewServer(jsonrpc.EndpointCodecMap{})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, _ := http.Post(server.URL, "application/json", body(`[]`))
+	buf, _ := ioutil.ReadAll(resp.Body)
+	expectErrorCode(t, jsonrpc.InvalidRequestError, buf)
+	expectNilRequestID(t, buf)
+}
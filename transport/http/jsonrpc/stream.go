@@ -0,0 +1,643 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+)
+
+var (
+	// ErrPeerClosed is returned by calls on a Peer whose connection was
+	// closed.
+	ErrPeerClosed = errors.New("jsonrpc: peer closed")
+
+	// ErrMessageTooLarge is the reason a Peer's connection is closed when the
+	// remote end sends a message larger than the maximum size.
+	ErrMessageTooLarge = errors.New("jsonrpc: message too large")
+)
+
+// DefaultMaxMessageSize is the default maximum size of the messages a Peer
+// reads, in bytes.
+const DefaultMaxMessageSize = 1 << 20
+
+// DefaultMaxPendingRequests is the default maximum number of requests from
+// the remote end a Peer handles, or queues to handle, at once.
+const DefaultMaxPendingRequests = 100
+
+// ServerBusyError is the code of the error responses to requests rejected
+// because too many requests from the remote end are pending.
+const ServerBusyError int = -32000
+
+type peerKeyType struct{}
+
+var peerKey peerKeyType
+
+// PeerFromContext returns the Peer a request was received from, if it was
+// received over a stream connection. Endpoints can use it to push
+// notifications to the remote end.
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey).(*Peer)
+	return p, ok
+}
+
+// Peer is one end of a long-lived, bidirectional JSON RPC connection, over
+// WebSocket or newline-delimited JSON. Either end may call methods served by
+// the other, and send notifications to it. Responses are matched to calls by
+// ID, so many calls can be in flight at once.
+type Peer struct {
+	conn        messageConn
+	ecm         EndpointCodecMap
+	requestID   RequestIDGenerator
+	logger      log.Logger
+	concurrency chan struct{}
+	queue       chan struct{} // a slot per pending request or batch
+	maxSize     int
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	wmtx sync.Mutex // serializes writes
+
+	mtx     sync.Mutex
+	pending map[string]chan Response
+	err     error
+}
+
+// PeerOption sets an optional parameter for peers.
+type PeerOption func(*Peer)
+
+// PeerEndpoints sets the methods served to the remote end. By default, none
+// are, and requests from the remote end fail with MethodNotFoundError. Clients
+// can use it to handle notifications pushed by the server.
+func PeerEndpoints(ecm EndpointCodecMap) PeerOption {
+	return func(p *Peer) { p.ecm = ecm }
+}
+
+// PeerErrorLogger is used to log non-terminal errors. By default, no errors
+// are logged.
+func PeerErrorLogger(logger log.Logger) PeerOption {
+	return func(p *Peer) { p.logger = logger }
+}
+
+// PeerRequestIDGenerator sets the generator of the IDs of outgoing calls.
+// By default, AutoIncrementRequestID is used.
+func PeerRequestIDGenerator(g RequestIDGenerator) PeerOption {
+	return func(p *Peer) { p.requestID = g }
+}
+
+// PeerConcurrency sets the maximum number of requests from the remote end
+// handled concurrently. Further requests wait for one to complete, while
+// responses to our own calls keep being read, so endpoints may call back into
+// the remote end. By default, it's 10.
+func PeerConcurrency(n int) PeerOption {
+	return func(p *Peer) { p.concurrency = make(chan struct{}, n) }
+}
+
+// PeerMaxPendingRequests sets the maximum number of requests from the remote
+// end handled or waiting for a concurrency slot at once; a batch counts as a
+// single request. Further requests are rejected with ServerBusyError until
+// one completes, and further notifications are dropped, so that a remote end
+// streaming requests can't pile up goroutines, while responses to our own
+// calls keep being read. By default, it's DefaultMaxPendingRequests.
+func PeerMaxPendingRequests(n int) PeerOption {
+	return func(p *Peer) { p.queue = make(chan struct{}, n) }
+}
+
+// PeerMaxMessageSize sets the maximum size of the messages read from the
+// remote end, in bytes. The connection is closed with ErrMessageTooLarge if a
+// message is larger. By default, it's DefaultMaxMessageSize.
+func PeerMaxMessageSize(n int) PeerOption {
+	return func(p *Peer) { p.maxSize = n }
+}
+
+// NewStreamPeer returns a Peer that exchanges newline-delimited JSON messages
+// over conn, typically a TCP connection. The context is passed to endpoints,
+// and the connection is closed once it's done.
+func NewStreamPeer(ctx context.Context, conn io.ReadWriteCloser, options ...PeerOption) *Peer {
+	return newPeer(ctx, &lineConn{rwc: conn, r: bufio.NewReader(conn)}, options...)
+}
+
+// NewWebSocketPeer returns a Peer that exchanges JSON messages over ws, one
+// per text frame. The context is passed to endpoints, and the connection is
+// closed once it's done.
+func NewWebSocketPeer(ctx context.Context, ws *websocket.Conn, options ...PeerOption) *Peer {
+	return newPeer(ctx, wsConn{ws}, options...)
+}
+
+// DialWebSocket opens a WebSocket connection to url, and returns a Peer
+// using it. The context bounds the dial and the handshake, and is then passed
+// to the Peer.
+func DialWebSocket(ctx context.Context, url, origin string, options ...PeerOption) (*Peer, error) {
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := dialWebSocket(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebSocketPeer(ctx, ws, options...), nil
+}
+
+func dialWebSocket(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+	host, port := config.Location.Hostname(), config.Location.Port()
+	switch config.Location.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, websocket.ErrBadScheme
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if config.TlsConfig != nil {
+			tlsConfig = config.TlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	// Abort the handshake if the context is done before it completes.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+func newPeer(ctx context.Context, conn messageConn, options ...PeerOption) *Peer {
+	p := &Peer{
+		conn:        conn,
+		ecm:         EndpointCodecMap{},
+		requestID:   NewAutoIncrementID(0),
+		logger:      log.NewNopLogger(),
+		concurrency: make(chan struct{}, 10),
+		queue:       make(chan struct{}, DefaultMaxPendingRequests),
+		maxSize:     DefaultMaxMessageSize,
+		pending:     map[string]chan Response{},
+	}
+	for _, option := range options {
+		option(p)
+	}
+	conn.SetMaxMessageSize(p.maxSize)
+	p.ctx, p.cancel = context.WithCancel(context.WithValue(ctx, peerKey, p))
+	go func() {
+		<-p.ctx.Done()
+		p.close(ErrPeerClosed)
+	}()
+	go p.readLoop()
+	return p
+}
+
+// Call calls method on the remote end, and waits for its response, or for
+// the context to be done.
+func (p *Peer) Call(ctx context.Context, method string, params json.RawMessage) (Response, error) {
+	id := p.requestID.Generate()
+	key, err := json.Marshal(id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	ch := make(chan Response, 1)
+	if err := p.Err(); err != nil {
+		return Response{}, err
+	}
+	p.mtx.Lock()
+	p.pending[string(key)] = ch
+	p.mtx.Unlock()
+
+	defer func() {
+		p.mtx.Lock()
+		delete(p.pending, string(key))
+		p.mtx.Unlock()
+	}()
+
+	if err := p.write(clientRequest{
+		JSONRPC: Version,
+		Method:  method,
+		Params:  params,
+		ID:      id,
+	}); err != nil {
+		return Response{}, err
+	}
+
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	case <-p.ctx.Done():
+		return Response{}, p.Err()
+	}
+}
+
+// Notify sends a notification for method to the remote end.
+func (p *Peer) Notify(ctx context.Context, method string, params json.RawMessage) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return p.write(clientRequest{
+		JSONRPC:      Version,
+		Method:       method,
+		Params:       params,
+		Notification: true,
+	})
+}
+
+// Endpoint returns a usable endpoint that calls method on the remote end. If
+// enc or dec are nil, DefaultRequestEncoder and DefaultResponseDecoder are
+// used.
+func (p *Peer) Endpoint(method string, enc EncodeRequestFunc, dec DecodeResponseFunc) endpoint.Endpoint {
+	if enc == nil {
+		enc = DefaultRequestEncoder
+	}
+	if dec == nil {
+		dec = DefaultResponseDecoder
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		params, err := enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Call(ctx, method, params)
+		if err != nil {
+			return nil, err
+		}
+		return dec(ctx, res)
+	}
+}
+
+// NotificationEndpoint returns a usable endpoint that sends notifications for
+// method to the remote end. Its response is always nil. If enc is nil,
+// DefaultRequestEncoder is used.
+func (p *Peer) NotificationEndpoint(method string, enc EncodeRequestFunc) endpoint.Endpoint {
+	if enc == nil {
+		enc = DefaultRequestEncoder
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		params, err := enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		return nil, p.Notify(ctx, method, params)
+	}
+}
+
+// Close closes the connection. Pending calls fail with ErrPeerClosed.
+func (p *Peer) Close() error {
+	p.close(ErrPeerClosed)
+	return nil
+}
+
+// Done returns a channel that's closed when the connection is closed, by
+// either end.
+func (p *Peer) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+// Err returns the reason the connection was closed, or nil if it's open.
+func (p *Peer) Err() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.err == nil && p.ctx.Err() != nil {
+		return ErrPeerClosed // the context is done, but close hasn't run yet
+	}
+	return p.err
+}
+
+func (p *Peer) close(err error) {
+	p.mtx.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mtx.Unlock()
+	p.conn.Close()
+	p.cancel()
+}
+
+func (p *Peer) write(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	p.wmtx.Lock()
+	defer p.wmtx.Unlock()
+	return p.conn.WriteMessage(msg)
+}
+
+func (p *Peer) readLoop() {
+	for {
+		msg, err := p.conn.ReadMessage()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrPeerClosed
+			}
+			p.close(err)
+			return
+		}
+
+		if !json.Valid(msg) {
+			err := parseError("JSON could not be decoded.")
+			p.logger.Log("err", err)
+			p.reply(errorResponse(p.ctx, err))
+			continue
+		}
+
+		// Responses are delivered right away, since the endpoints holding
+		// the concurrency slots may be waiting for them.
+		if !isBatch(msg) {
+			if isResponse(msg) {
+				p.deliver(msg)
+				continue
+			}
+			if !p.enqueue([]json.RawMessage{msg}, false) {
+				continue
+			}
+			go func() {
+				defer p.dequeue()
+				if res := p.handle(msg); res != nil {
+					p.reply(res)
+				}
+			}()
+			continue
+		}
+
+		var entries []json.RawMessage
+		if err := json.Unmarshal(msg, &entries); err != nil || len(entries) == 0 {
+			if err == nil {
+				err = invalidRequestError("Batch must contain at least one request.")
+			}
+			p.logger.Log("err", err)
+			p.reply(errorResponse(p.ctx, err))
+			continue
+		}
+		requests := entries[:0]
+		for _, entry := range entries {
+			if isResponse(entry) {
+				p.deliver(entry)
+			} else {
+				requests = append(requests, entry)
+			}
+		}
+		if len(requests) > 0 && p.enqueue(requests, true) {
+			go func() {
+				defer p.dequeue()
+				p.handleBatch(requests)
+			}()
+		}
+	}
+}
+
+// handleBatch handles the requests of a batch with at most as many
+// goroutines as the concurrency limit.
+func (p *Peer) handleBatch(entries []json.RawMessage) {
+	var (
+		responses = make([]interface{}, len(entries))
+		next      = make(chan int)
+		workers   = cap(p.concurrency)
+		wg        sync.WaitGroup
+	)
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				responses[i] = p.handle(entries[i])
+			}
+		}()
+	}
+	for i := range entries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	res := make([]interface{}, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			res = append(res, response)
+		}
+	}
+	if len(res) > 0 {
+		p.reply(res)
+	}
+}
+
+// enqueue takes a queue slot for the requests, a single one or a batch. If
+// the queue is full, it rejects them with ServerBusyError, and returns false.
+func (p *Peer) enqueue(msgs []json.RawMessage, batch bool) bool {
+	select {
+	case p.queue <- struct{}{}:
+		return true
+	default:
+	}
+	var res []interface{}
+	for _, msg := range msgs {
+		req, notification, err := decodeRequest(msg)
+		if err != nil || notification {
+			continue
+		}
+		ctx := context.WithValue(p.ctx, requestIDKey, req.ID)
+		res = append(res, errorResponse(ctx, Error{Code: ServerBusyError, Message: "Too many pending requests."}))
+	}
+	p.logger.Log("err", "too many pending requests", "rejected", len(res), "dropped", len(msgs)-len(res))
+	switch {
+	case len(res) == 0:
+	case batch:
+		p.reply(res)
+	default:
+		p.reply(res[0])
+	}
+	return false
+}
+
+func (p *Peer) dequeue() {
+	<-p.queue
+}
+
+// isResponse reports whether the message is a response to one of our calls,
+// rather than a request.
+func isResponse(msg json.RawMessage) bool {
+	var kind struct {
+		Method *string `json:"method"`
+	}
+	return json.Unmarshal(msg, &kind) == nil && kind.Method == nil
+}
+
+// handle handles a single request, once a concurrency slot is available. It
+// returns the response to send, or nil if there's none.
+func (p *Peer) handle(msg json.RawMessage) interface{} {
+	select {
+	case p.concurrency <- struct{}{}:
+		defer func() { <-p.concurrency }()
+	case <-p.ctx.Done():
+		return nil
+	}
+
+	ctx := p.ctx
+	req, notification, err := decodeRequest(msg)
+	if err == nil {
+		ctx = context.WithValue(ctx, requestIDKey, req.ID)
+		var resParams json.RawMessage
+		if resParams, err = invoke(ctx, p.ecm, req, nil); err == nil {
+			if notification {
+				return nil
+			}
+			return Response{
+				ID:      req.ID,
+				JSONRPC: Version,
+				Result:  resParams,
+			}
+		}
+	}
+
+	p.logger.Log("err", err)
+	if notification {
+		return nil
+	}
+	return errorResponse(ctx, err)
+}
+
+// deliver hands a response over to the call waiting for it.
+func (p *Peer) deliver(msg json.RawMessage) {
+	var res Response
+	if err := json.Unmarshal(msg, &res); err != nil || res.ID == nil {
+		p.logger.Log("err", "unexpected message", "msg", string(msg))
+		return
+	}
+	key, err := json.Marshal(res.ID)
+	if err != nil {
+		return
+	}
+	p.mtx.Lock()
+	ch, ok := p.pending[string(key)]
+	p.mtx.Unlock()
+	if !ok {
+		p.logger.Log("err", "response to unknown call", "id", string(key))
+		return
+	}
+	select {
+	case ch <- res:
+	default: // already answered
+	}
+}
+
+func (p *Peer) reply(res interface{}) {
+	if err := p.write(res); err != nil {
+		p.logger.Log("err", err)
+	}
+}
+
+// messageConn reads and writes whole JSON messages.
+type messageConn interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage([]byte) error
+	SetMaxMessageSize(int)
+	Close() error
+}
+
+// lineConn delimits messages with newlines.
+type lineConn struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+	max int
+}
+
+func (c *lineConn) ReadMessage() ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := c.r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(bytes.TrimRight(line, "\r\n")) > c.max {
+			return nil, ErrMessageTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if msg := bytes.TrimSpace(line); len(msg) > 0 {
+			return msg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = line[:0]
+	}
+}
+
+func (c *lineConn) SetMaxMessageSize(n int) {
+	c.max = n
+}
+
+func (c *lineConn) WriteMessage(msg []byte) error {
+	_, err := c.rwc.Write(append(msg, '\n'))
+	return err
+}
+
+func (c *lineConn) Close() error {
+	return c.rwc.Close()
+}
+
+// wsConn sends every message in its own text frame.
+type wsConn struct {
+	ws *websocket.Conn
+}
+
+func (c wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	err := websocket.Message.Receive(c.ws, &msg)
+	if err == websocket.ErrFrameTooLarge {
+		err = ErrMessageTooLarge
+	}
+	return msg, err
+}
+
+func (c wsConn) SetMaxMessageSize(n int) {
+	c.ws.MaxPayloadBytes = n
+}
+
+func (c wsConn) WriteMessage(msg []byte) error {
+	return websocket.Message.Send(c.ws, string(msg))
+}
+
+func (c wsConn) Close() error {
+	return c.ws.Close()
+}
@@ -0,0 +1,116 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// StreamServer serves an EndpointCodecMap over long-lived connections, either
+// WebSocket, through ServeHTTP, or newline-delimited JSON, through Serve and
+// ServeConn. Every connection is handled by a Peer, which endpoints can get
+// with PeerFromContext to push notifications to the client.
+type StreamServer struct {
+	ecm         EndpointCodecMap
+	options     []PeerOption
+	connect     []func(*Peer)
+	checkOrigin func(*http.Request) bool
+}
+
+// StreamServerOption sets an optional parameter for stream servers.
+type StreamServerOption func(*StreamServer)
+
+// StreamServerPeerOptions sets the options of the Peer handling every
+// connection.
+func StreamServerPeerOptions(options ...PeerOption) StreamServerOption {
+	return func(s *StreamServer) { s.options = append(s.options, options...) }
+}
+
+// StreamServerConnect functions are called with the Peer handling every new
+// connection, as soon as it's established. They may keep it, e.g. to push
+// notifications to the client later on.
+func StreamServerConnect(connect ...func(*Peer)) StreamServerOption {
+	return func(s *StreamServer) { s.connect = append(s.connect, connect...) }
+}
+
+// StreamServerCheckOrigin sets the func deciding whether WebSocket
+// connections are accepted from the origin of the request. By default, only
+// requests without an Origin header, i.e. not from browsers, and requests
+// whose origin has the same host as the request are, as per SameOrigin.
+func StreamServerCheckOrigin(checkOrigin func(r *http.Request) bool) StreamServerOption {
+	return func(s *StreamServer) { s.checkOrigin = checkOrigin }
+}
+
+// SameOrigin reports whether the request has no Origin header, or one whose
+// host is the host of the request.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// NewStreamServer constructs a new stream server.
+func NewStreamServer(ecm EndpointCodecMap, options ...StreamServerOption) *StreamServer {
+	s := &StreamServer{ecm: ecm, checkOrigin: SameOrigin}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler, upgrading the request to a WebSocket
+// connection. Requests from origins rejected by the StreamServerCheckOrigin
+// func fail with 403 Forbidden.
+func (s StreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !s.checkOrigin(r) {
+				return errors.New("origin not allowed")
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			s.serve(NewWebSocketPeer(r.Context(), ws, s.peerOptions()...))
+		},
+	}.ServeHTTP(w, r)
+}
+
+// Serve accepts connections on l, and serves newline-delimited JSON on each
+// of them, until l is closed.
+func (s StreamServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(context.Background(), conn)
+	}
+}
+
+// ServeConn serves newline-delimited JSON on conn, and returns once the
+// connection is closed.
+func (s StreamServer) ServeConn(ctx context.Context, conn net.Conn) {
+	s.serve(NewStreamPeer(ctx, conn, s.peerOptions()...))
+}
+
+func (s StreamServer) serve(p *Peer) {
+	for _, f := range s.connect {
+		f(p)
+	}
+	<-p.Done()
+}
+
+func (s StreamServer) peerOptions() []PeerOption {
+	return append([]PeerOption{PeerEndpoints(s.ecm)}, s.options...)
+}
@@ -0,0 +1,337 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+)
+
+type teapotError struct{}
+
+func (teapotError) Error() string  { return "teapot" }
+func (teapotError) ErrorCode() int { return 418 }
+
+func streamCodecs() jsonrpc.EndpointCodecMap {
+	return jsonrpc.EndpointCodecMap{
+		"sleep": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				ms := request.(int)
+				time.Sleep(time.Duration(ms) * time.Millisecond)
+				return ms, nil
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) {
+				var ms int
+				err := json.Unmarshal(msg, &ms)
+				return ms, err
+			},
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+		"teapot": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { return nil, teapotError{} },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+		"subscribe": jsonrpc.EndpointCodec{
+			Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				p, ok := jsonrpc.PeerFromContext(ctx)
+				if !ok {
+					return nil, errors.New("no peer")
+				}
+				return nil, p.Notify(ctx, "tick", json.RawMessage(`"tock"`))
+			},
+			Decode: nopDecoder,
+			Encode: nopEncoder,
+		},
+	}
+}
+
+func TestStreamServerTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go jsonrpc.NewStreamServer(streamCodecs()).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := jsonrpc.NewStreamPeer(context.Background(), conn)
+	defer p.Close()
+
+	// Calls complete out of order, and each gets its own response.
+	var (
+		sleep = p.Endpoint("sleep", nil, nil)
+		wg    sync.WaitGroup
+	)
+	for _, ms := range []int{30, 20, 10, 0} {
+		wg.Add(1)
+		go func(ms int) {
+			defer wg.Done()
+			response, err := sleep(context.Background(), ms)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want, have := float64(ms), response; want != have {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		}(ms)
+	}
+	wg.Wait()
+
+	_, err = p.Endpoint("teapot", nil, nil)(context.Background(), struct{}{})
+	if rpcErr, ok := err.(jsonrpc.Error); !ok || rpcErr.Code != 418 {
+		t.Errorf("want teapot error, have %v", err)
+	}
+
+	_, err = p.Endpoint("nope", nil, nil)(context.Background(), struct{}{})
+	if rpcErr, ok := err.(jsonrpc.Error); !ok || rpcErr.Code != jsonrpc.MethodNotFoundError {
+		t.Errorf("want method not found, have %v", err)
+	}
+}
+
+func TestStreamServerWebSocket(t *testing.T) {
+	var (
+		connected = make(chan *jsonrpc.Peer, 1)
+		server    = httptest.NewServer(jsonrpc.NewStreamServer(
+			streamCodecs(),
+			jsonrpc.StreamServerConnect(func(p *jsonrpc.Peer) { connected <- p }),
+		))
+		ticks = make(chan interface{}, 2)
+	)
+	defer server.Close()
+
+	p, err := jsonrpc.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), server.URL,
+		jsonrpc.PeerEndpoints(jsonrpc.EndpointCodecMap{
+			"tick": jsonrpc.EndpointCodec{
+				Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+					ticks <- request
+					return nil, nil
+				},
+				Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) { return string(msg), nil },
+				Encode: nopEncoder,
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// The server pushes a notification from an endpoint...
+	if _, err := p.Endpoint("subscribe", nil, nil)(context.Background(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `"tock"`, <-ticks; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// ...and from outside of any request.
+	if err := (<-connected).Notify(context.Background(), "tick", json.RawMessage(`"tick"`)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `"tick"`, <-ticks; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestPeerClose(t *testing.T) {
+	var (
+		client, server = net.Pipe()
+		started        = make(chan struct{})
+		block          = make(chan struct{})
+	)
+	defer close(block)
+	go jsonrpc.NewStreamServer(jsonrpc.EndpointCodecMap{
+		"block": jsonrpc.EndpointCodec{
+			Endpoint: func(context.Context, interface{}) (interface{}, error) { close(started); <-block; return nil, nil },
+			Decode:   nopDecoder,
+			Encode:   nopEncoder,
+		},
+	}).ServeConn(context.Background(), server)
+
+	p := jsonrpc.NewStreamPeer(context.Background(), client)
+	errc := make(chan error)
+	go func() {
+		_, err := p.Call(context.Background(), "block", nil)
+		errc <- err
+	}()
+	<-started
+	server.Close()
+
+	if want, have := jsonrpc.ErrPeerClosed, <-errc; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if _, err := p.Call(context.Background(), "block", nil); err != jsonrpc.ErrPeerClosed {
+		t.Errorf("want %v, have %v", jsonrpc.ErrPeerClosed, err)
+	}
+}
+
+func TestPeerBatch(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go jsonrpc.NewStreamServer(streamCodecs()).ServeConn(context.Background(), server)
+
+	go client.Write([]byte(`[{"jsonrpc": "2.0", "method": "sleep", "params": 1, "id": 1}, {"jsonrpc": "2.0", "method": "sleep", "params": 2}]` + "\n"))
+	var res []jsonrpc.Response
+	if err := json.NewDecoder(client).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(res); want != have {
+		t.Fatalf("want %d responses, have %d", want, have)
+	}
+	if want, have := "1", string(res[0].Result); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestPeerCallback(t *testing.T) {
+	client, server := net.Pipe()
+	go jsonrpc.NewStreamServer(jsonrpc.EndpointCodecMap{
+		"callback": jsonrpc.EndpointCodec{
+			Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				p, _ := jsonrpc.PeerFromContext(ctx)
+				return p.Endpoint("echo", nil, nil)(ctx, request)
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) { return msg, nil },
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+	}, jsonrpc.StreamServerPeerOptions(jsonrpc.PeerConcurrency(1))).ServeConn(context.Background(), server)
+
+	p := jsonrpc.NewStreamPeer(context.Background(), client, jsonrpc.PeerEndpoints(jsonrpc.EndpointCodecMap{
+		"echo": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) { return request, nil },
+			Decode:   func(_ context.Context, msg json.RawMessage) (interface{}, error) { return msg, nil },
+			Encode:   jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+	}))
+	defer p.Close()
+
+	// The server endpoint holds the only concurrency slot while it waits
+	// for the client's response.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := p.Endpoint("callback", nil, nil)(ctx, "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "ping", response; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestPeerMaxPendingRequests(t *testing.T) {
+	client, server := net.Pipe()
+	go jsonrpc.NewStreamServer(jsonrpc.EndpointCodecMap{
+		"callback": jsonrpc.EndpointCodec{
+			Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+				p, _ := jsonrpc.PeerFromContext(ctx)
+				return p.Endpoint("echo", nil, nil)(ctx, request)
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) { return msg, nil },
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+	}, jsonrpc.StreamServerPeerOptions(jsonrpc.PeerConcurrency(1), jsonrpc.PeerMaxPendingRequests(1))).ServeConn(context.Background(), server)
+
+	var (
+		echoing = make(chan struct{})
+		release = make(chan struct{})
+	)
+	p := jsonrpc.NewStreamPeer(context.Background(), client, jsonrpc.PeerEndpoints(jsonrpc.EndpointCodecMap{
+		"echo": jsonrpc.EndpointCodec{
+			Endpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+				close(echoing)
+				<-release
+				return request, nil
+			},
+			Decode: func(_ context.Context, msg json.RawMessage) (interface{}, error) { return msg, nil },
+			Encode: jsonrpc.EncodeResponseFunc(jsonrpc.DefaultRequestEncoder),
+		},
+	}))
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.Call(ctx, "callback", json.RawMessage(`"ping"`))
+		errc <- err
+	}()
+	<-echoing
+
+	// The queue is full: further requests are rejected.
+	res, err := p.Call(ctx, "callback", json.RawMessage(`"ping"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error == nil {
+		t.Fatal("want error response, have none")
+	}
+	if want, have := jsonrpc.ServerBusyError, res.Error.Code; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+
+	// Responses to the server's calls are still delivered.
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeerMaxMessageSize(t *testing.T) {
+	var (
+		client, server = net.Pipe()
+		connected      = make(chan *jsonrpc.Peer, 1)
+	)
+	go jsonrpc.NewStreamServer(
+		streamCodecs(),
+		jsonrpc.StreamServerPeerOptions(jsonrpc.PeerMaxMessageSize(64)),
+		jsonrpc.StreamServerConnect(func(p *jsonrpc.Peer) { connected <- p }),
+	).ServeConn(context.Background(), server)
+
+	p := jsonrpc.NewStreamPeer(context.Background(), client)
+	defer p.Close()
+	if _, err := p.Call(context.Background(), "sleep", json.RawMessage("0")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Call(context.Background(), "sleep", json.RawMessage(`"`+strings.Repeat("x", 64)+`"`))
+	if want, have := jsonrpc.ErrPeerClosed, err; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	sp := <-connected
+	<-sp.Done()
+	if want, have := jsonrpc.ErrMessageTooLarge, sp.Err(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestStreamServerOrigin(t *testing.T) {
+	server := httptest.NewServer(jsonrpc.NewStreamServer(streamCodecs()))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, err := jsonrpc.DialWebSocket(context.Background(), url, "http://example.com"); err == nil {
+		t.Error("want error for cross-origin connection, have none")
+	}
+	p, err := jsonrpc.DialWebSocket(context.Background(), url, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := jsonrpc.DialWebSocket(ctx, url, server.URL); err == nil {
+		t.Error("want error for canceled context, have none")
+	}
+}
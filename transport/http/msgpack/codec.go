@@ -0,0 +1,36 @@
+// Package msgpack provides the MessagePack codec of the HTTP transport's
+// content negotiation, to be registered in an httptransport.Codecs:
+//
+//	codecs := httptransport.NewCodecs()
+//	codecs.Register(msgpack.ContentType, msgpack.Codec)
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// ContentType is the media type of MessagePack bodies.
+const ContentType = "application/msgpack"
+
+// Codec is the Codec of MessagePack bodies. Struct fields are named after
+// their msgpack tag, or else their json tag, so that the same types can be
+// marshaled as JSON and MessagePack.
+var Codec httptransport.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.NewDecoder(bytes.NewReader(data)).UseJSONTag(true).Decode(v)
+}
@@ -0,0 +1,100 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/msgpack"
+)
+
+type greeting struct {
+	Name string            `json:"name"`
+	Tags map[string]string `json:"tags"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := greeting{Name: "kit", Tags: map[string]string{"a": "1"}}
+	b, err := msgpack.Codec.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out greeting
+	if err := msgpack.Codec.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("want %v, have %v", in, out)
+	}
+
+	// Fields are named after their json tag.
+	var fields map[string]interface{}
+	if err := msgpack.Codec.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "kit", fields["name"]; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	codecs := httptransport.NewCodecs()
+	codecs.Register(msgpack.ContentType, msgpack.Codec)
+	server := httptest.NewServer(httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			return greeting{Name: "hello " + request.(*greeting).Name}, nil
+		},
+		codecs.DecodeRequest(func() interface{} { return &greeting{} }),
+		codecs.EncodeResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	))
+	defer server.Close()
+
+	body, err := msgpack.Codec.Marshal(greeting{Name: "kit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		accept          string
+		wantContentType string
+	}{
+		{msgpack.ContentType, msgpack.ContentType},
+		{"application/json;q=0.5, application/msgpack", msgpack.ContentType},
+		{"application/msgpack;q=0.5, application/json", "application/json"},
+		{"", "application/json"},
+	} {
+		req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", msgpack.ContentType)
+		req.Header.Set("Accept", tc.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := http.StatusOK, resp.StatusCode; want != have {
+			t.Fatalf("%q: want %d, have %d: %s", tc.accept, want, have, b)
+		}
+		if want, have := tc.wantContentType, resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("%q: want %q, have %q", tc.accept, want, have)
+		}
+		if tc.wantContentType != msgpack.ContentType {
+			continue
+		}
+		var response greeting
+		if err := msgpack.Codec.Unmarshal(b, &response); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := "hello kit", response.Name; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
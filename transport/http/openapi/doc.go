@@ -0,0 +1,14 @@
+// Package openapi generates OpenAPI 3 documents describing the HTTP servers
+// of a service. Operations are recorded in a Registry as their handlers are
+// mounted, with example values of their request, response and error types,
+// whose schemas are derived from the Go types by reflection.
+//
+//	api := openapi.NewRegistry(openapi.Info{Title: "Profile service", Version: "1.0.0"})
+//	r.Methods("GET").Path("/profiles/{id}").Handler(api.Register(
+//	    "GET", "/profiles/{id}", getProfileServer,
+//	    openapi.RequestType(getProfileRequest{}),
+//	    openapi.ResponseType(getProfileResponse{}),
+//	    openapi.ErrorTypes(ErrNotFound),
+//	))
+//	r.Methods("GET").Path("/openapi.json").Handler(api)
+package openapi
@@ -0,0 +1,386 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Registry records the operations of an HTTP API as they're registered, and
+// emits an OpenAPI document describing them. It implements http.Handler,
+// serving the document as JSON, so that it can be mounted at any path.
+type Registry struct {
+	mtx        sync.Mutex
+	info       Info
+	servers    []Server
+	operations []*operation
+}
+
+// RegistryOption sets an optional parameter for registries.
+type RegistryOption func(*Registry)
+
+// Servers sets the servers hosting the API. By default, the document has
+// none, which means the API is relative to the server of the document.
+func Servers(servers ...Server) RegistryOption {
+	return func(r *Registry) { r.servers = append(r.servers, servers...) }
+}
+
+// NewRegistry returns an empty registry of an API.
+func NewRegistry(info Info, options ...RegistryOption) *Registry {
+	r := &Registry{info: info}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+type operation struct {
+	method, path string
+	vars         []pathVar
+	op           Operation
+	request      interface{}
+	response     interface{}
+	errors       []error
+}
+
+// OperationOption sets an optional parameter of a registered operation.
+type OperationOption func(*operation)
+
+// RequestType sets the request type of the operation, by an example value,
+// typically what the server's DecodeRequestFunc returns. Fields tagged with
+// path, query or header are the parameters of the operation, named by the
+// tag value; the other fields are the JSON body, for methods that have one.
+func RequestType(v interface{}) OperationOption {
+	return func(o *operation) { o.request = v }
+}
+
+// ResponseType sets the response type of the operation, by an example value,
+// typically what the endpoint returns. As with EncodeJSONResponse, its status
+// code is 200 unless it implements StatusCoder, and it's sent with the headers
+// its Headers method returns, if it implements Headerer. No body is described
+// for 204 No Content.
+func ResponseType(v interface{}) OperationOption {
+	return func(o *operation) { o.response = v }
+}
+
+// ErrorTypes adds the errors the operation may return, by example values, as
+// encoded by the DefaultErrorEncoder: the status code is 500 unless the error
+// implements StatusCoder, and the body is the JSON the error marshals to if it
+// implements json.Marshaler, or its message otherwise. The schema of JSON
+// errors is inferred from the JSON of the examples.
+func ErrorTypes(errs ...error) OperationOption {
+	return func(o *operation) { o.errors = append(o.errors, errs...) }
+}
+
+// OperationID sets the unique identifier of the operation.
+func OperationID(id string) OperationOption {
+	return func(o *operation) { o.op.OperationID = id }
+}
+
+// Summary sets the short summary of the operation.
+func Summary(summary string) OperationOption {
+	return func(o *operation) { o.op.Summary = summary }
+}
+
+// Description sets the longer description of the operation.
+func Description(description string) OperationOption {
+	return func(o *operation) { o.op.Description = description }
+}
+
+// Tags sets the tags grouping the operation with others.
+func Tags(tags ...string) OperationOption {
+	return func(o *operation) { o.op.Tags = append(o.op.Tags, tags...) }
+}
+
+// Register records the operation handled by h, typically an
+// httptransport.Server, for the method and the path, written as a template
+// with {name} or {name:pattern} parameters like gorilla/mux routes. Patterns
+// are left out of the path of the document, and set on the schemas of the
+// parameters instead. It returns h, so that registration can wrap the
+// mounting of the handler.
+func (r *Registry) Register(method, path string, h http.Handler, options ...OperationOption) http.Handler {
+	o := &operation{method: strings.ToLower(method)}
+	o.path, o.vars = parsePath(path)
+	for _, option := range options {
+		option(o)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.operations = append(r.operations, o)
+	return h
+}
+
+// Document returns the OpenAPI document of the operations registered so far.
+func (r *Registry) Document() *Document {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	schemas := NewSchemas()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    r.info,
+		Servers: r.servers,
+		Paths:   map[string]PathItem{},
+	}
+	for _, o := range r.operations {
+		item, ok := doc.Paths[o.path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[o.path] = item
+		}
+		item[o.method] = o.build(schemas)
+	}
+	doc.Components.Schemas = schemas.Components()
+	return doc
+}
+
+// ServeHTTP implements http.Handler, serving the OpenAPI document as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(r.Document())
+}
+
+type pathVar struct {
+	name, pattern string
+}
+
+// parsePath returns the path template without the patterns of its variables,
+// e.g. /profiles/{id} for /profiles/{id:[0-9]+}, and the variables. Braces
+// within patterns are balanced, as in gorilla/mux.
+func parsePath(path string) (string, []pathVar) {
+	var (
+		b     strings.Builder
+		vars  []pathVar
+		start = -1
+		depth int
+	)
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			if depth++; depth == 1 {
+				start = i + 1
+			}
+		case '}':
+			if depth == 0 {
+				break
+			}
+			if depth--; depth == 0 {
+				v := pathVar{name: path[start:i]}
+				if j := strings.IndexByte(v.name, ':'); j >= 0 {
+					v.name, v.pattern = v.name[:j], v.name[j+1:]
+				}
+				vars = append(vars, v)
+				b.WriteString("{" + v.name + "}")
+			}
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(path[i])
+		}
+	}
+	if depth > 0 {
+		b.WriteString(path[start-1:]) // unbalanced, left as is
+	}
+	return b.String(), vars
+}
+
+func (o *operation) build(schemas *Schemas) *Operation {
+	op := o.op
+	op.Responses = map[string]*Response{}
+
+	declared := map[string]bool{}
+	if o.request != nil {
+		t := indirect(reflect.TypeOf(o.request))
+		op.Parameters = parameters(schemas, t)
+		for _, p := range op.Parameters {
+			if p.In == "path" {
+				declared[p.Name] = true
+			}
+		}
+		if hasBody(o.method) && hasBodyFields(t) {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: schemas.For(o.request)}},
+			}
+		}
+	}
+	for _, v := range o.vars {
+		if !declared[v.name] {
+			schema := &Schema{Type: "string"}
+			if v.pattern != "" {
+				schema.Pattern = "^(?:" + v.pattern + ")$"
+			}
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name: v.name, In: "path", Required: true, Schema: schema,
+			})
+		}
+	}
+
+	code, response := http.StatusOK, &Response{}
+	if o.response != nil {
+		if sc, ok := o.response.(httptransport.StatusCoder); ok {
+			code = sc.StatusCode()
+		}
+		response.Headers = headers(o.response)
+		if code != http.StatusNoContent {
+			response.Content = map[string]MediaType{"application/json": {Schema: schemas.For(o.response)}}
+		}
+	}
+	response.Description = http.StatusText(code)
+	op.Responses[strconv.Itoa(code)] = response
+
+	for _, err := range o.errors {
+		code := http.StatusInternalServerError
+		if sc, ok := err.(httptransport.StatusCoder); ok {
+			code = sc.StatusCode()
+		}
+		contentType, media := "text/plain", MediaType{Schema: &Schema{Type: "string"}, Example: err.Error()}
+		if marshaler, ok := err.(json.Marshaler); ok {
+			if body, marshalErr := marshaler.MarshalJSON(); marshalErr == nil {
+				contentType, media = "application/json", MediaType{Schema: inferSchema(body), Example: json.RawMessage(body)}
+			}
+		}
+		key := strconv.Itoa(code)
+		response, ok := op.Responses[key]
+		if !ok {
+			response = &Response{Description: http.StatusText(code), Content: map[string]MediaType{}}
+			op.Responses[key] = response
+		}
+		if response.Content == nil {
+			response.Content = map[string]MediaType{}
+		}
+		response.Content[contentType] = merge(response.Content[contentType], media)
+		for name, h := range headers(err) {
+			if response.Headers == nil {
+				response.Headers = map[string]*Header{}
+			}
+			response.Headers[name] = h
+		}
+	}
+	return &op
+}
+
+// merge returns the media type of a body that's either a or b.
+func merge(a, b MediaType) MediaType {
+	if a.Schema == nil || reflect.DeepEqual(a.Schema, b.Schema) {
+		return b
+	}
+	if len(a.Schema.OneOf) > 0 {
+		return MediaType{Schema: &Schema{OneOf: append(a.Schema.OneOf, b.Schema)}}
+	}
+	return MediaType{Schema: &Schema{OneOf: []*Schema{a.Schema, b.Schema}}}
+}
+
+// inferSchema returns the schema of the JSON value v, since the Go type of
+// a json.Marshaler doesn't tell the shape of the JSON it marshals to.
+func inferSchema(v json.RawMessage) *Schema {
+	var value interface{}
+	if err := json.Unmarshal(v, &value); err != nil {
+		return &Schema{}
+	}
+	return valueSchema(value)
+}
+
+func valueSchema(value interface{}) *Schema {
+	switch v := value.(type) {
+	case bool:
+		return &Schema{Type: "boolean"}
+	case float64:
+		return &Schema{Type: "number"}
+	case string:
+		return &Schema{Type: "string"}
+	case []interface{}:
+		if len(v) == 0 {
+			return &Schema{Type: "array", Items: &Schema{}}
+		}
+		return &Schema{Type: "array", Items: valueSchema(v[0])}
+	case map[string]interface{}:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for name, field := range v {
+			schema.Properties[name] = valueSchema(field)
+		}
+		return schema
+	default: // null
+		return &Schema{Nullable: true}
+	}
+}
+
+// parameters returns the path, query and header parameters bound to the
+// fields of the struct type t.
+func parameters(schemas *Schemas, t reflect.Type) []*Parameter {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var params []*Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if in, name, ok := paramTag(f); ok {
+			params = append(params, &Parameter{
+				Name:        name,
+				In:          in,
+				Description: f.Tag.Get("description"),
+				Required:    in == "path",
+				Schema:      schemas.Type(f.Type),
+			})
+		} else if f.Anonymous {
+			params = append(params, parameters(schemas, indirect(f.Type))...)
+		}
+	}
+	return params
+}
+
+// hasBodyFields returns whether any field of t is encoded in the body.
+func hasBodyFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, _, ok := paramTag(f); ok {
+			continue
+		}
+		if _, _, ok := jsonField(f); !ok {
+			continue
+		}
+		if !f.Anonymous || hasBodyFields(indirect(f.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBody(method string) bool {
+	switch method {
+	case "get", "head", "delete", "options", "trace":
+		return false
+	}
+	return true
+}
+
+// headers returns the headers set by v, if it implements Headerer.
+func headers(v interface{}) map[string]*Header {
+	headerer, ok := v.(httptransport.Headerer)
+	if !ok {
+		return nil
+	}
+	var hs map[string]*Header
+	for name := range headerer.Headers() {
+		if hs == nil {
+			hs = map[string]*Header{}
+		}
+		hs[name] = &Header{Schema: &Schema{Type: "string"}}
+	}
+	return hs
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,149 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/openapi"
+)
+
+type createProfileRequest struct {
+	Tenant  string `path:"tenant"`
+	DryRun  bool   `query:"dry_run"`
+	TraceID string `header:"X-Trace-Id"`
+	Name    string `json:"name"`
+}
+
+type createProfileResponse struct {
+	ID string `json:"id"`
+}
+
+func (createProfileResponse) StatusCode() int { return http.StatusCreated }
+
+func (createProfileResponse) Headers() http.Header {
+	return http.Header{"Location": []string{"/profiles/1"}}
+}
+
+type conflictError struct {
+	Reason string `json:"reason"`
+}
+
+func (e conflictError) Error() string      { return e.Reason }
+func (conflictError) StatusCode() int      { return http.StatusConflict }
+func (conflictError) Headers() http.Header { return http.Header{"Retry-After": []string{"1"}} }
+func (e conflictError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Reason string `json:"reason"`
+	}{e.Reason})
+}
+
+type deleteProfileRequest struct {
+	ID string `path:"id"`
+}
+
+type deleteProfileResponse struct{}
+
+func (deleteProfileResponse) StatusCode() int { return http.StatusNoContent }
+
+func TestRegistry(t *testing.T) {
+	var (
+		api     = openapi.NewRegistry(openapi.Info{Title: "Profiles", Version: "1.0.0"})
+		handler = httptransport.NewServer(
+			func(context.Context, interface{}) (interface{}, error) { return createProfileResponse{}, nil },
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONResponse,
+		)
+	)
+	if want, have := http.Handler(handler), api.Register(
+		"POST", "/{tenant}/profiles", handler,
+		openapi.OperationID("createProfile"),
+		openapi.RequestType(createProfileRequest{}),
+		openapi.ResponseType(createProfileResponse{}),
+		openapi.ErrorTypes(conflictError{}, errors.New("internal")),
+	); want != have {
+		t.Error("want the registered handler")
+	}
+	api.Register(
+		"DELETE", "/{tenant}/profiles/{id}", handler,
+		openapi.RequestType(&deleteProfileRequest{}),
+		openapi.ResponseType(deleteProfileResponse{}),
+	)
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var doc openapi.Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := openapi.Version, doc.OpenAPI; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	create := doc.Paths["/{tenant}/profiles"]["post"]
+	if create == nil {
+		t.Fatalf("no create operation in %v", doc.Paths)
+	}
+	if want, have := `[{"name":"tenant","in":"path","required":true,"schema":{"type":"string"}},`+
+		`{"name":"dry_run","in":"query","schema":{"type":"boolean"}},`+
+		`{"name":"X-Trace-Id","in":"header","schema":{"type":"string"}}]`, marshal(t, create.Parameters); want != have {
+		t.Errorf("parameters: want %s, have %s", want, have)
+	}
+	if want, have := `{"required":true,"content":{"application/json":{"schema":{"$ref":"#/components/schemas/createProfileRequest"}}}}`, marshal(t, create.RequestBody); want != have {
+		t.Errorf("request body: want %s, have %s", want, have)
+	}
+	if want, have := `{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`, marshal(t, doc.Components.Schemas["createProfileRequest"]); want != have {
+		t.Errorf("request schema: want %s, have %s", want, have)
+	}
+	if want, have := `{"description":"Created","headers":{"Location":{"schema":{"type":"string"}}},`+
+		`"content":{"application/json":{"schema":{"$ref":"#/components/schemas/createProfileResponse"}}}}`, marshal(t, create.Responses["201"]); want != have {
+		t.Errorf("response: want %s, have %s", want, have)
+	}
+	if want, have := `{"description":"Conflict","headers":{"Retry-After":{"schema":{"type":"string"}}},`+
+		`"content":{"application/json":{"schema":{"type":"object","properties":{"reason":{"type":"string"}}},"example":{"reason":""}}}}`, marshal(t, create.Responses["409"]); want != have {
+		t.Errorf("conflict: want %s, have %s", want, have)
+	}
+	if want, have := `{"description":"Internal Server Error","content":{"text/plain":{"schema":{"type":"string"},"example":"internal"}}}`, marshal(t, create.Responses["500"]); want != have {
+		t.Errorf("internal: want %s, have %s", want, have)
+	}
+
+	remove := doc.Paths["/{tenant}/profiles/{id}"]["delete"]
+	if remove == nil {
+		t.Fatalf("no delete operation in %v", doc.Paths)
+	}
+	if want, have := `[{"name":"id","in":"path","required":true,"schema":{"type":"string"}},`+
+		`{"name":"tenant","in":"path","required":true,"schema":{"type":"string"}}]`, marshal(t, remove.Parameters); want != have {
+		t.Errorf("parameters: want %s, have %s", want, have)
+	}
+	if remove.RequestBody != nil {
+		t.Errorf("want no request body, have %s", marshal(t, remove.RequestBody))
+	}
+	if want, have := `{"description":"No Content"}`, marshal(t, remove.Responses["204"]); want != have {
+		t.Errorf("response: want %s, have %s", want, have)
+	}
+}
+
+func TestRegistryPathPatterns(t *testing.T) {
+	api := openapi.NewRegistry(openapi.Info{Title: "Profiles", Version: "1.0.0"})
+	api.Register("GET", "/profiles/{id:[0-9]+}/photos/{size:[a-z]{2}}", http.NotFoundHandler())
+
+	doc := api.Document()
+	get := doc.Paths["/profiles/{id}/photos/{size}"]["get"]
+	if get == nil {
+		t.Fatalf("no get operation in %v", doc.Paths)
+	}
+	if want, have := `[{"name":"id","in":"path","required":true,"schema":{"type":"string","pattern":"^(?:[0-9]+)$"}},`+
+		`{"name":"size","in":"path","required":true,"schema":{"type":"string","pattern":"^(?:[a-z]{2})$"}}]`, marshal(t, get.Parameters); want != have {
+		t.Errorf("parameters: want %s, have %s", want, have)
+	}
+}
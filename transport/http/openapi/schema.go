@@ -0,0 +1,234 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema, in the dialect of OpenAPI 3.0, which OpenRPC
+// documents use as well.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+// Schemas generates the schemas of Go types by reflection, following the
+// rules of encoding/json. Named struct types are collected as components, and
+// referenced with $ref, which allows recursive types.
+//
+// Struct fields may be annotated with a description tag, and with an enum tag
+// listing the comma-separated values they may take. Fields that are bound to a
+// path, query or header tag are request parameters, not part of the schema.
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+// NewSchemas returns an empty set of component schemas.
+func NewSchemas() *Schemas {
+	return &Schemas{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// Components returns the schemas of the named struct types seen so far, by
+// name. They're referenced as "#/components/schemas/{name}".
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// For returns the schema of the type of v.
+func (s *Schemas) For(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	return s.Type(reflect.TypeOf(v))
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Type returns the schema of t.
+func (s *Schemas) Type(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	schema := s.typ(t)
+	if nullable && schema.Ref == "" {
+		schema.Nullable = true
+	}
+	return schema
+}
+
+func (s *Schemas) typ(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case implements(t, jsonMarshalerType):
+		return &Schema{} // arbitrary JSON
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.Type(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: s.Type(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.Type(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default: // interfaces, and types encoding/json doesn't support
+		return &Schema{}
+	}
+}
+
+// component registers the schema of the named struct type t, and returns its
+// name.
+func (s *Schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	s.names[t] = name
+	s.components[name] = &Schema{} // placeholder for recursive types
+	*s.components[name] = *s.object(t)
+	return name
+}
+
+// object returns the schema of the struct type t.
+func (s *Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(t, schema)
+	return schema
+}
+
+func (s *Schemas) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, ok := jsonField(f)
+		if !ok {
+			continue
+		}
+		if _, _, ok := paramTag(f); ok {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.fields(ft, schema) // embedded fields are promoted
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := s.Type(f.Type)
+		if fs.Ref == "" { // siblings of $ref are ignored
+			fs.Description = f.Tag.Get("description")
+			for _, v := range splitTag(f.Tag.Get("enum")) {
+				fs.Enum = append(fs.Enum, v)
+			}
+		}
+		schema.Properties[name] = fs
+		if !omitempty && f.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// jsonField returns the JSON name of f, empty if it's not set by a tag, and
+// whether f is encoded at all.
+func jsonField(f reflect.StructField) (name string, omitempty, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous { // unexported
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty, true
+}
+
+// paramIns are the locations of request parameters, which are also the names
+// of the struct tags binding fields to them.
+var paramIns = []string{"path", "query", "header"}
+
+// paramTag returns the location and name of the request parameter f is bound
+// to, if any.
+func paramTag(f reflect.StructField) (in, name string, ok bool) {
+	for _, in := range paramIns {
+		if name, ok := f.Tag.Lookup(in); ok {
+			if name == "" {
+				name = f.Name
+			}
+			return in, name, true
+		}
+	}
+	return "", "", false
+}
+
+func splitTag(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
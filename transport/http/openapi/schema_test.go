@@ -0,0 +1,72 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport/http/openapi"
+)
+
+type node struct {
+	Name     string    `json:"name" description:"The name of the node."`
+	Kind     string    `json:"kind,omitempty" enum:"leaf,branch"`
+	Children []*node   `json:"children,omitempty"`
+	Created  time.Time `json:"created"`
+	Data     []byte    `json:"data,omitempty"`
+	Weight   *float64  `json:"weight"`
+	Labels   map[string]int
+	ID       string `path:"id"`
+	secret   string
+	Ignored  string `json:"-"`
+	embedded
+}
+
+type embedded struct {
+	Version int32 `json:"version"`
+}
+
+func TestSchemas(t *testing.T) {
+	schemas := openapi.NewSchemas()
+	if want, have := `{"$ref":"#/components/schemas/node"}`, marshal(t, schemas.For(node{})); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	for _, tc := range []struct {
+		v    interface{}
+		want string
+	}{
+		{"", `{"type":"string"}`},
+		{int64(0), `{"type":"integer","format":"int64"}`},
+		{[]string{}, `{"type":"array","items":{"type":"string"}}`},
+		{(*bool)(nil), `{"type":"boolean","nullable":true}`},
+		{json.RawMessage{}, `{}`},
+		{struct{ A int }{}, `{"type":"object","properties":{"A":{"type":"integer","format":"int64"}},"required":["A"]}`},
+	} {
+		if have := marshal(t, schemas.For(tc.v)); tc.want != have {
+			t.Errorf("%T: want %s, have %s", tc.v, tc.want, have)
+		}
+	}
+
+	want := `{"type":"object","properties":{` +
+		`"Labels":{"type":"object","additionalProperties":{"type":"integer","format":"int64"}},` +
+		`"children":{"type":"array","items":{"$ref":"#/components/schemas/node"}},` +
+		`"created":{"type":"string","format":"date-time"},` +
+		`"data":{"type":"string","format":"byte"},` +
+		`"kind":{"type":"string","enum":["leaf","branch"]},` +
+		`"name":{"type":"string","description":"The name of the node."},` +
+		`"version":{"type":"integer","format":"int32"},` +
+		`"weight":{"type":"number","format":"double","nullable":true}},` +
+		`"required":["name","created","Labels","version"]}`
+	if have := marshal(t, schemas.Components()["node"]); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
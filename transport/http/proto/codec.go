@@ -0,0 +1,34 @@
+package proto
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// ContentType is the media type of Protobuf bodies.
+const ContentType = "application/x-protobuf"
+
+// Codec is the Codec of Protobuf bodies, to be registered in an
+// httptransport.Codecs as ContentType. Values must implement proto.Message.
+var Codec httptransport.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("value does not implement proto.Message")
+	}
+	return proto.Marshal(m)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("value does not implement proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
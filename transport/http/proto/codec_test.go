@@ -0,0 +1,94 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := &Cat{Name: "Ziggy", Age: 13, Breed: "Lumpy"}
+	b, err := Codec.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Cat
+	if err := Codec.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(in, &out) {
+		t.Errorf("want %v, have %v", in, &out)
+	}
+
+	// Values must be messages.
+	if _, err := Codec.Marshal(struct{}{}); err == nil {
+		t.Error("want error marshaling a non-message, have none")
+	}
+	if err := Codec.Unmarshal(b, &struct{}{}); err == nil {
+		t.Error("want error unmarshaling into a non-message, have none")
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	codecs := httptransport.NewCodecs()
+	codecs.Register(ContentType, Codec)
+	server := httptest.NewServer(httptransport.NewServer(
+		func(_ context.Context, request interface{}) (interface{}, error) {
+			cat := request.(*Cat)
+			return &Cat{Name: cat.Name, Age: cat.Age + 1}, nil
+		},
+		codecs.DecodeRequest(func() interface{} { return &Cat{} }),
+		codecs.EncodeResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	))
+	defer server.Close()
+
+	body, err := Codec.Marshal(&Cat{Name: "Ziggy", Age: 13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		accept          string
+		wantContentType string
+		unmarshal       func([]byte, interface{}) error
+	}{
+		{ContentType, ContentType, Codec.Unmarshal},
+		{"application/json;q=0.5, application/x-protobuf", ContentType, Codec.Unmarshal},
+		{"application/x-protobuf;q=0.5, application/json", "application/json", json.Unmarshal},
+		{"", "application/json", json.Unmarshal},
+	} {
+		req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", ContentType)
+		req.Header.Set("Accept", tc.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := http.StatusTeapot, resp.StatusCode; want != have { // *Cat is a StatusCoder
+			t.Fatalf("%q: want %d, have %d: %s", tc.accept, want, have, b)
+		}
+		if want, have := tc.wantContentType, resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("%q: want %q, have %q", tc.accept, want, have)
+		}
+		var cat Cat
+		if err := tc.unmarshal(b, &cat); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := int32(14), cat.Age; want != have {
+			t.Errorf("%q: want age %d, have %d", tc.accept, want, have)
+		}
+	}
+}
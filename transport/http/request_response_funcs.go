@@ -128,6 +128,13 @@ const (
 	ContextKeyResponseHeaders
 
 	// ContextKeyResponseSize is populated in the context whenever a
-	// ServerFinalizerFunc is specified. Its value is of type int64.
+	// ServerFinalizerFunc is specified. Its value is of type int64. With
+	// compression, it's the size of the compressed response.
 	ContextKeyResponseSize
+
+	// ContextKeyResponseUncompressedSize is populated in the context
+	// whenever a ServerFinalizerFunc is specified. Its value is of type int64,
+	// and is the size of the response before compression, which is
+	// ContextKeyResponseSize if the response isn't compressed.
+	ContextKeyResponseUncompressedSize
 )
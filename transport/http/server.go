@@ -3,9 +3,11 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 )
@@ -20,6 +22,8 @@ type Server struct {
 	errorEncoder ErrorEncoder
 	finalizer    []ServerFinalizerFunc
 	errorHandler transport.ErrorHandler
+	compression  *compression
+	caching      *caching
 }
 
 // NewServer constructs a new server, which implements http.Handler and wraps
@@ -95,11 +99,17 @@ func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	var cw *compressingWriter
 	if len(s.finalizer) > 0 {
 		iw := &interceptingWriter{w, http.StatusOK, 0}
 		defer func() {
+			uncompressed := iw.written
+			if cw != nil {
+				uncompressed = cw.uncompressed
+			}
 			ctx = context.WithValue(ctx, ContextKeyResponseHeaders, iw.Header())
 			ctx = context.WithValue(ctx, ContextKeyResponseSize, iw.written)
+			ctx = context.WithValue(ctx, ContextKeyResponseUncompressedSize, uncompressed)
 			for _, f := range s.finalizer {
 				f(ctx, iw.code, r)
 			}
@@ -107,6 +117,22 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w = iw
 	}
 
+	if s.compression != nil {
+		cw = s.compression.responseWriter(w, r)
+		defer func() {
+			if err := cw.Close(); err != nil {
+				s.errorHandler.Handle(ctx, err)
+			}
+		}()
+		w = cw
+
+		if err := s.compression.decompressRequest(r); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			s.errorEncoder(ctx, err, w)
+			return
+		}
+	}
+
 	for _, f := range s.before {
 		ctx = f(ctx, r)
 	}
@@ -129,7 +155,12 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = f(ctx, w)
 	}
 
-	if err := s.enc(ctx, w, response); err != nil {
+	enc := s.enc
+	if s.caching != nil {
+		enc = s.caching.encoder(r, enc)
+	}
+
+	if err := enc(ctx, w, response); err != nil {
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
 		return
@@ -210,6 +241,34 @@ func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 	w.Write(body)
 }
 
+// ProblemErrorEncoder writes the error to the ResponseWriter as an RFC 7807
+// problem details document, with a content type of application/problem+json.
+// The status code is the one of the error's kind, as classified by
+// errkind.Of, unless an error in its chain implements StatusCoder. If an error
+// in its chain implements Headerer, the provided headers will be applied to
+// the response. If one implements json.Marshaler, the members of the object
+// it marshals to are added to the document. The detail of the document is set
+// as per errkind.ProblemOf.
+func ProblemErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	problem := errkind.ProblemOf(err)
+	body, marshalErr := problem.MarshalJSON()
+	if marshalErr != nil {
+		DefaultErrorEncoder(ctx, err, w)
+		return
+	}
+	w.Header().Set("Content-Type", errkind.ProblemContentType)
+	var headerer Headerer
+	if errors.As(err, &headerer) {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	w.WriteHeader(problem.Status)
+	w.Write(body)
+}
+
 // StatusCoder is checked by DefaultErrorEncoder. If an error value implements
 // StatusCoder, the StatusCode will be used when encoding the error. By default,
 // StatusInternalServerError (500) is used.
@@ -242,3 +301,11 @@ func (w *interceptingWriter) Write(p []byte) (int, error) {
 	w.written += int64(n)
 	return n, err
 }
+
+// Flush implements http.Flusher, if the wrapped ResponseWriter does, so that
+// streaming responses can be flushed through it.
+func (w *interceptingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -2,7 +2,9 @@ package http_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	httptransport "github.com/go-kit/kit/transport/http"
 )
 
@@ -332,6 +335,41 @@ func TestAddMultipleHeadersErrorEncoder(t *testing.T) {
 	}
 }
 
+func TestProblemErrorEncoder(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("get profile: %w", errkind.New(errkind.NotFound, "no such profile"))
+		},
+		func(context.Context, *http.Request) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httptransport.ProblemErrorEncoder),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := http.StatusNotFound, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := "application/problem+json", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	var problem errkind.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := errkind.NotFound, problem.Kind; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := "get profile: no such profile", problem.Detail; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
 type noContentResponse struct{}
 
 func (e noContentResponse) StatusCode() int { return http.StatusNoContent }
@@ -359,6 +397,38 @@ func TestEncodeNoContent(t *testing.T) {
 	}
 }
 
+func TestProblemErrorEncoderWrapped(t *testing.T) {
+	handler := httptransport.NewServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("brew: %w", enhancedError{})
+		},
+		func(context.Context, *http.Request) (interface{}, error) { return struct{}{}, nil },
+		httptransport.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httptransport.ProblemErrorEncoder),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := http.StatusTeapot, resp.StatusCode; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := "1", resp.Header.Get("X-Enhanced"); want != have {
+		t.Errorf("want X-Enhanced %q, have %q", want, have)
+	}
+	var problem errkind.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "", problem.Detail; want != have {
+		t.Errorf("want no detail for an unknown error, have %q", have)
+	}
+}
+
 type enhancedError struct{}
 
 func (e enhancedError) Error() string                { return "enhanced error" }
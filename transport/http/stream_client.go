@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeEventFunc decodes the data of an event received by an EventReader.
+type DecodeEventFunc func(ctx context.Context, data []byte) (interface{}, error)
+
+// StreamError is returned by EventReader when the server ended a Server-Sent
+// Events stream with an event of type "error".
+type StreamError struct {
+	Message string
+}
+
+func (e StreamError) Error() string {
+	return e.Message
+}
+
+// DecodeEventStreamResponse returns a DecodeResponseFunc that reads a stream
+// served by a StreamServer, either Server-Sent Events or newline-delimited
+// JSON depending on the response content type. The response is an
+// *EventReader. The client must be built with BufferedStream(true), and the
+// EventReader closed once done with it. Responses with a status other than 200
+// are returned as an error.
+func DecodeEventStreamResponse(dec DecodeEventFunc) DecodeResponseFunc {
+	return func(ctx context.Context, resp *http.Response) (interface{}, error) {
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return NewEventReader(resp, dec), nil
+	}
+}
+
+// EventReader reads the events of a streaming HTTP response. It implements
+// EventStream, and returns Events whose Data is decoded by a DecodeEventFunc.
+type EventReader struct {
+	body   io.ReadCloser
+	r      *bufio.Reader
+	dec    DecodeEventFunc
+	ndjson bool
+	lastID string
+}
+
+// NewEventReader returns an EventReader of the response body, which is read as
+// newline-delimited JSON if that's the response content type, and as
+// Server-Sent Events otherwise.
+func NewEventReader(resp *http.Response, dec DecodeEventFunc) *EventReader {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return &EventReader{
+		body:   resp.Body,
+		r:      bufio.NewReader(resp.Body),
+		dec:    dec,
+		ndjson: mediaType == NDJSONContentType,
+	}
+}
+
+// Next returns the next Event of the stream, or io.EOF once the stream ended.
+// Reading blocks until an event is received, or the context of the request is
+// canceled; ctx is passed to the DecodeEventFunc.
+func (er *EventReader) Next(ctx context.Context) (interface{}, error) {
+	var (
+		e   Event
+		err error
+	)
+	if er.ndjson {
+		e, err = er.nextNDJSON()
+	} else {
+		e, err = er.nextSSE()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Data, err = er.dec(ctx, e.Data.([]byte)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// LastEventID returns the last event ID received, which clients may send in
+// the Last-Event-ID header to resume a Server-Sent Events stream.
+func (er *EventReader) LastEventID() string {
+	return er.lastID
+}
+
+// Close closes the response body, which ends the request.
+func (er *EventReader) Close() error {
+	return er.body.Close()
+}
+
+func (er *EventReader) nextNDJSON() (Event, error) {
+	for {
+		line, err := er.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+		if line != "" { // empty lines are keep-alives
+			return Event{Data: []byte(line)}, nil
+		}
+	}
+}
+
+// nextSSE parses the next event as specified by
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+func (er *EventReader) nextSSE() (Event, error) {
+	var (
+		e       Event
+		data    []string
+		hasData bool
+	)
+	for {
+		line, err := er.readLine()
+		if err != nil {
+			return Event{}, err // an incomplete event is discarded
+		}
+		if line == "" {
+			if !hasData {
+				e = Event{}
+				continue
+			}
+			e.ID = er.lastID
+			if e.Type == "error" {
+				return Event{}, StreamError{Message: strings.Join(data, "\n")}
+			}
+			e.Data = []byte(strings.Join(data, "\n"))
+			return e, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data, hasData = append(data, value), true
+		case "event":
+			e.Type = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				e.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// readLine returns the next line, without its line ending.
+func (er *EventReader) readLine() (string, error) {
+	line, err := er.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil // the last line needn't end with a newline
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,412 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+)
+
+// Event is a single message of a streaming response. The endpoints of a
+// StreamServer may send Events to set the Server-Sent Events fields, or any
+// other value, which is sent as the data of an unnamed event. Newline-delimited
+// JSON streams only carry the data.
+type Event struct {
+	ID    string
+	Type  string
+	Retry time.Duration
+	Data  interface{}
+}
+
+// EventStream is a sequence of events, returned by the endpoints of a
+// StreamServer. Next blocks until the next event is available, and returns
+// io.EOF once there are no more. It must return when ctx is canceled.
+type EventStream interface {
+	Next(ctx context.Context) (event interface{}, err error)
+}
+
+// EventStreamFunc is an adapter to allow the use of ordinary functions as
+// EventStreams.
+type EventStreamFunc func(ctx context.Context) (interface{}, error)
+
+// Next implements EventStream.
+func (f EventStreamFunc) Next(ctx context.Context) (interface{}, error) {
+	return f(ctx)
+}
+
+// ChanEventStream returns an EventStream of the values received from c. The
+// stream ends when c is closed.
+func ChanEventStream(c <-chan interface{}) EventStream {
+	return EventStreamFunc(func(ctx context.Context) (interface{}, error) {
+		select {
+		case event, ok := <-c:
+			if !ok {
+				return nil, io.EOF
+			}
+			return event, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// EncodeEventFunc encodes the data of an event. The result must not contain
+// newlines when streaming newline-delimited JSON, or the stream fails.
+type EncodeEventFunc func(ctx context.Context, data interface{}) ([]byte, error)
+
+// EncodeJSONEvent is an EncodeEventFunc that serializes the data as JSON.
+func EncodeJSONEvent(_ context.Context, data interface{}) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// Content types of the streams served by StreamServer.
+const (
+	EventStreamContentType = "text/event-stream"
+	NDJSONContentType      = "application/x-ndjson"
+)
+
+// StreamServer wraps an endpoint whose response is a stream of events, and
+// implements http.Handler. The response may be an EventStream, or a channel
+// of events, which ends when it's closed. Events are written as they come,
+// as Server-Sent Events, or as newline-delimited JSON if the Accept header of
+// the request prefers application/x-ndjson, and flushed one by one. The stream ends when the
+// client disconnects, which cancels the context given to the endpoint.
+type StreamServer struct {
+	e            endpoint.Endpoint
+	dec          DecodeRequestFunc
+	enc          EncodeEventFunc
+	before       []RequestFunc
+	after        []ServerResponseFunc
+	errorEncoder ErrorEncoder
+	streamError  StreamErrorEncoder
+	finalizer    []ServerFinalizerFunc
+	errorHandler transport.ErrorHandler
+	keepAlive    time.Duration
+}
+
+// NewStreamServer constructs a new stream server, which implements
+// http.Handler and wraps the provided endpoint. The data of every event is
+// encoded by enc, e.g. EncodeJSONEvent.
+func NewStreamServer(
+	e endpoint.Endpoint,
+	dec DecodeRequestFunc,
+	enc EncodeEventFunc,
+	options ...StreamServerOption,
+) *StreamServer {
+	s := &StreamServer{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		errorEncoder: DefaultErrorEncoder,
+		streamError:  DefaultStreamErrorEncoder,
+		errorHandler: transport.NewLogErrorHandler(log.NewNopLogger()),
+		keepAlive:    15 * time.Second,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// StreamServerOption sets an optional parameter for stream servers.
+type StreamServerOption func(*StreamServer)
+
+// StreamServerBefore functions are executed on the HTTP request object before
+// the request is decoded.
+func StreamServerBefore(before ...RequestFunc) StreamServerOption {
+	return func(s *StreamServer) { s.before = append(s.before, before...) }
+}
+
+// StreamServerAfter functions are executed on the HTTP response writer after
+// the endpoint is invoked, but before the stream starts.
+func StreamServerAfter(after ...ServerResponseFunc) StreamServerOption {
+	return func(s *StreamServer) { s.after = append(s.after, after...) }
+}
+
+// StreamServerErrorEncoder is used to encode the errors encountered before
+// the stream starts, i.e. decoding the request or invoking the endpoint. By
+// default, errors are written with the DefaultErrorEncoder. Errors returned by
+// the stream itself are encoded by the StreamErrorEncoder instead.
+func StreamServerErrorEncoder(ee ErrorEncoder) StreamServerOption {
+	return func(s *StreamServer) { s.errorEncoder = ee }
+}
+
+// StreamErrorEncoder returns the message sent to Server-Sent Events clients,
+// as the data of an event of type "error", when the stream fails after it
+// started. Newline-delimited JSON streams end silently.
+type StreamErrorEncoder func(ctx context.Context, err error) string
+
+// DefaultStreamErrorEncoder returns the status text of the error's status
+// code, if it implements StatusCoder, or else of 500 Internal Server Error, so
+// that error messages aren't disclosed to clients.
+func DefaultStreamErrorEncoder(_ context.Context, err error) string {
+	code := http.StatusInternalServerError
+	if sc, ok := err.(StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	return http.StatusText(code)
+}
+
+// StreamServerStreamErrorEncoder is used to encode the errors returned by the
+// stream once it started. By default, DefaultStreamErrorEncoder is used.
+func StreamServerStreamErrorEncoder(ee StreamErrorEncoder) StreamServerOption {
+	return func(s *StreamServer) { s.streamError = ee }
+}
+
+// StreamServerErrorHandler is used to handle non-terminal errors, including
+// the errors ending a stream. By default, non-terminal errors are ignored.
+func StreamServerErrorHandler(errorHandler transport.ErrorHandler) StreamServerOption {
+	return func(s *StreamServer) { s.errorHandler = errorHandler }
+}
+
+// StreamServerFinalizer is executed at the end of every HTTP request, once
+// the stream ended. By default, no finalizer is registered.
+func StreamServerFinalizer(f ...ServerFinalizerFunc) StreamServerOption {
+	return func(s *StreamServer) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// StreamServerKeepAlive sets the interval of the keep-alives written while no
+// event is, so that proxies don't close idle streams: comment lines for
+// Server-Sent Events, and empty lines for newline-delimited JSON. By default,
+// it's 15 seconds. Zero disables keep-alives.
+func StreamServerKeepAlive(d time.Duration) StreamServerOption {
+	return func(s *StreamServer) { s.keepAlive = d }
+}
+
+// ServeHTTP implements http.Handler.
+func (s StreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if len(s.finalizer) > 0 {
+		iw := &interceptingWriter{w, http.StatusOK, 0}
+		defer func() {
+			ctx = context.WithValue(ctx, ContextKeyResponseHeaders, iw.Header())
+			ctx = context.WithValue(ctx, ContextKeyResponseSize, iw.written)
+			for _, f := range s.finalizer {
+				f(ctx, iw.code, r)
+			}
+		}()
+		w = iw
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, r)
+	}
+
+	request, err := s.dec(ctx, r)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		s.errorEncoder(ctx, err, w)
+		return
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		s.errorEncoder(ctx, err, w)
+		return
+	}
+
+	var stream EventStream
+	switch resp := response.(type) {
+	case EventStream:
+		stream = resp
+	case <-chan interface{}:
+		stream = ChanEventStream(resp)
+	case chan interface{}:
+		stream = ChanEventStream(resp)
+	default:
+		err := fmt.Errorf("unsupported stream response type %T", response)
+		s.errorHandler.Handle(ctx, err)
+		s.errorEncoder(ctx, err, w)
+		return
+	}
+
+	for _, f := range s.after {
+		ctx = f(ctx, w)
+	}
+
+	mediaType, _ := negotiate(r.Header.Get("Accept"), []string{EventStreamContentType, NDJSONContentType})
+	ndjson := mediaType == NDJSONContentType
+	if ndjson {
+		w.Header().Set("Content-Type", NDJSONContentType)
+	} else {
+		w.Header().Set("Content-Type", EventStreamContentType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	if headerer, ok := response.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	sw := &streamWriter{w: w, ndjson: ndjson}
+	sw.flush()
+	if err := s.stream(ctx, sw, stream); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		if err != ctx.Err() {
+			sw.writeError(s.streamError(ctx, err))
+		}
+	}
+}
+
+type nextResult struct {
+	event interface{}
+	err   error
+}
+
+// stream writes the events of stream to sw until it ends, the client
+// disconnects or writing fails. Events are read concurrently, so that
+// keep-alives are written while waiting for them.
+func (s StreamServer) stream(ctx context.Context, sw *streamWriter, stream EventStream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		next = make(chan nextResult)
+		more = make(chan struct{})
+	)
+	go func() {
+		for {
+			event, err := stream.Next(ctx)
+			select {
+			case next <- nextResult{event, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case <-more:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var keepAlive <-chan time.Time
+	if s.keepAlive > 0 {
+		ticker := time.NewTicker(s.keepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case res := <-next:
+			if res.err == io.EOF {
+				return nil
+			} else if res.err != nil {
+				return res.err
+			}
+			if err := s.writeEvent(ctx, sw, res.event); err != nil {
+				return err
+			}
+			more <- struct{}{}
+		case <-keepAlive:
+			if err := sw.keepAlive(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s StreamServer) writeEvent(ctx context.Context, sw *streamWriter, event interface{}) error {
+	e, ok := event.(Event)
+	if !ok {
+		if p, isPtr := event.(*Event); isPtr && p != nil {
+			e = *p
+		} else {
+			e = Event{Data: event}
+		}
+	}
+	// Line breaks would end the field, and let the rest inject other fields.
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return fmt.Errorf("invalid event ID %q", e.ID)
+	}
+	if strings.ContainsAny(e.Type, "\r\n") {
+		return fmt.Errorf("invalid event type %q", e.Type)
+	}
+	data, err := s.enc(ctx, e.Data)
+	if err != nil {
+		return err
+	}
+	// A line break would split the record in two.
+	if sw.ndjson && bytes.ContainsAny(data, "\r\n") {
+		return fmt.Errorf("invalid newline-delimited JSON record %q", data)
+	}
+	return sw.writeEvent(e, data)
+}
+
+// streamWriter writes events to the response, and flushes them one by one.
+type streamWriter struct {
+	w      http.ResponseWriter
+	ndjson bool
+}
+
+func (sw *streamWriter) writeEvent(e Event, data []byte) error {
+	var buf bytes.Buffer
+	if sw.ndjson {
+		buf.Write(data)
+		buf.WriteByte('\n')
+		return sw.write(buf.Bytes())
+	}
+	if e.ID != "" {
+		buf.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Type != "" {
+		buf.WriteString("event: " + e.Type + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(int64(e.Retry/time.Millisecond), 10) + "\n")
+	}
+	lines := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(string(data))
+	for _, line := range strings.Split(lines, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteByte('\n')
+	return sw.write(buf.Bytes())
+}
+
+func (sw *streamWriter) writeError(msg string) {
+	if sw.ndjson {
+		return
+	}
+	sw.writeEvent(Event{Type: "error"}, []byte(msg))
+}
+
+func (sw *streamWriter) keepAlive() error {
+	if sw.ndjson {
+		return sw.write([]byte("\n"))
+	}
+	return sw.write([]byte(": keep-alive\n\n"))
+}
+
+func (sw *streamWriter) write(p []byte) error {
+	if _, err := sw.w.Write(p); err != nil {
+		return err
+	}
+	sw.flush()
+	return nil
+}
+
+func (sw *streamWriter) flush() {
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
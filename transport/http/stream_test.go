@@ -0,0 +1,307 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+func decodeJSONEvent(_ context.Context, data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func streamClient(t *testing.T, serverURL string, options ...httptransport.ClientOption) endpoint.Endpoint {
+	t.Helper()
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptransport.NewClient(
+		"GET", u,
+		func(context.Context, *http.Request, interface{}) error { return nil },
+		httptransport.DecodeEventStreamResponse(decodeJSONEvent),
+		append(options, httptransport.BufferedStream(true))...,
+	).Endpoint()
+}
+
+func readEvents(t *testing.T, response interface{}) ([]httptransport.Event, error) {
+	t.Helper()
+	er := response.(*httptransport.EventReader)
+	defer er.Close()
+	var events []httptransport.Event
+	for {
+		event, err := er.Next(context.Background())
+		if err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, event.(httptransport.Event))
+	}
+}
+
+func eventsHandler(events ...interface{}) *httptransport.StreamServer {
+	return httptransport.NewStreamServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			c := make(chan interface{}, len(events))
+			for _, event := range events {
+				c <- event
+			}
+			close(c)
+			return c, nil
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONEvent,
+	)
+}
+
+func TestStreamServerSSE(t *testing.T) {
+	server := httptest.NewServer(eventsHandler(
+		httptransport.Event{ID: "1", Type: "greeting", Retry: time.Second, Data: "hello\nworld"},
+		map[string]int{"n": 2},
+	))
+	defer server.Close()
+
+	response, err := streamClient(t, server.URL)(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := readEvents(t, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []httptransport.Event{
+		{ID: "1", Type: "greeting", Retry: time.Second, Data: "hello\nworld"},
+		{ID: "1", Data: map[string]interface{}{"n": float64(2)}}, // the last ID sticks
+	}
+	if !reflect.DeepEqual(want, events) {
+		t.Errorf("want %v, have %v", want, events)
+	}
+}
+
+func TestStreamServerNDJSON(t *testing.T) {
+	server := httptest.NewServer(eventsHandler(
+		httptransport.Event{ID: "1", Type: "greeting", Data: "hello"},
+		2,
+	))
+	defer server.Close()
+
+	resp, err := streamClient(t, server.URL,
+		httptransport.ClientBefore(httptransport.SetRequestHeader("Accept", httptransport.NDJSONContentType)),
+	)(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := readEvents(t, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []httptransport.Event{{Data: "hello"}, {Data: float64(2)}}
+	if !reflect.DeepEqual(want, events) {
+		t.Errorf("want %v, have %v", want, events)
+	}
+}
+
+func TestStreamServerKeepAliveAndDisconnect(t *testing.T) {
+	var (
+		canceled  = make(chan struct{})
+		finalized = make(chan int64, 1)
+	)
+	handler := httptransport.NewStreamServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			return httptransport.EventStreamFunc(func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				close(canceled)
+				return nil, ctx.Err()
+			}), nil
+		},
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONEvent,
+		httptransport.StreamServerKeepAlive(10*time.Millisecond),
+		httptransport.StreamServerFinalizer(func(ctx context.Context, code int, r *http.Request) {
+			finalized <- ctx.Value(httptransport.ContextKeyResponseSize).(int64)
+		}),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "text/event-stream", resp.Header.Get("Content-Type"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := ": keep-alive\n", line; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	resp.Body.Close()
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("stream wasn't canceled when the client disconnected")
+	}
+	if size := <-finalized; size == 0 {
+		t.Error("want response size, have 0")
+	}
+}
+
+func TestStreamServerNegotiation(t *testing.T) {
+	server := httptest.NewServer(eventsHandler("hello"))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{"", httptransport.EventStreamContentType},
+		{"*/*", httptransport.EventStreamContentType},
+		{"application/x-ndjson", httptransport.NDJSONContentType},
+		{"Application/X-NDJSON", httptransport.NDJSONContentType},
+		{"text/event-stream;q=0.5, application/*", httptransport.NDJSONContentType},
+		{"application/x-ndjson;q=0, */*", httptransport.EventStreamContentType},
+		{"application/x-ndjson-seq", httptransport.EventStreamContentType},
+	} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept", tc.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := tc.want, resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("Accept %q: want %q, have %q", tc.accept, want, have)
+		}
+	}
+}
+
+func TestStreamServerNDJSONNewlines(t *testing.T) {
+	// Records with line breaks would be split, so they end the stream.
+	server := httptest.NewServer(httptransport.NewStreamServer(
+		func(context.Context, interface{}) (interface{}, error) {
+			c := make(chan interface{}, 2)
+			c <- "hello"
+			c <- map[string]int{"n": 2}
+			close(c)
+			return c, nil
+		},
+		httptransport.NopRequestDecoder,
+		func(_ context.Context, data interface{}) ([]byte, error) {
+			return json.MarshalIndent(data, "", "  ")
+		},
+	))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", httptransport.NDJSONContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "\"hello\"\n", string(body); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestStreamServerErrors(t *testing.T) {
+	// Errors ending a stream are sent to Server-Sent Events clients, without
+	// their message by default.
+	failing := func(context.Context, interface{}) (interface{}, error) {
+		var n int
+		return httptransport.EventStreamFunc(func(context.Context) (interface{}, error) {
+			if n++; n > 1 {
+				return nil, errors.New("dang")
+			}
+			return "first", nil
+		}), nil
+	}
+	for _, tc := range []struct {
+		options []httptransport.StreamServerOption
+		want    string
+	}{
+		{nil, "Internal Server Error"},
+		{[]httptransport.StreamServerOption{httptransport.StreamServerStreamErrorEncoder(
+			func(_ context.Context, err error) string { return "failed: " + err.Error() },
+		)}, "failed: dang"},
+	} {
+		server := httptest.NewServer(httptransport.NewStreamServer(
+			failing,
+			httptransport.NopRequestDecoder,
+			httptransport.EncodeJSONEvent,
+			tc.options...,
+		))
+		defer server.Close()
+
+		response, err := streamClient(t, server.URL)(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := readEvents(t, response)
+		if want, have := 1, len(events); want != have {
+			t.Errorf("want %d events, have %d", want, have)
+		}
+		if want, have := (httptransport.StreamError{Message: tc.want}), err; want != have {
+			t.Errorf("want %v, have %v", want, have)
+		}
+	}
+
+	// Line breaks in event IDs and types would inject other fields, so they
+	// end the stream.
+	for _, event := range []httptransport.Event{
+		{ID: "1\nevent: admin", Data: "x"},
+		{Type: "message\rdata: injected", Data: "x"},
+	} {
+		server := httptest.NewServer(eventsHandler(event))
+		defer server.Close()
+
+		response, err := streamClient(t, server.URL)(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := readEvents(t, response)
+		if want, have := 0, len(events); want != have {
+			t.Errorf("want %d events, have %d: %v", want, have, events)
+		}
+		if _, ok := err.(httptransport.StreamError); !ok {
+			t.Errorf("want StreamError, have %v", err)
+		}
+	}
+
+	// Responses that aren't streams are errors, encoded by the ErrorEncoder.
+	server := httptest.NewServer(httptransport.NewStreamServer(
+		func(context.Context, interface{}) (interface{}, error) { return "not a stream", nil },
+		httptransport.NopRequestDecoder,
+		httptransport.EncodeJSONEvent,
+	))
+	defer server.Close()
+
+	_, err := streamClient(t, server.URL)(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("want 500 error, have %v", err)
+	}
+}
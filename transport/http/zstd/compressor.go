@@ -0,0 +1,53 @@
+// Package zstd provides the Zstandard content coding of the HTTP transport's
+// compression, to be used with ServerCompression and ClientCompression:
+//
+//	httptransport.ServerCompression(httptransport.CompressionCompressors(
+//		zstd.NewCompressor(zstd.SpeedDefault),
+//		httptransport.GzipCompressor(gzip.DefaultCompression),
+//	))
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// EncoderLevel is the compression level of the compressor.
+type EncoderLevel = zstd.EncoderLevel
+
+// The compression levels of the compressor.
+const (
+	SpeedFastest           = zstd.SpeedFastest
+	SpeedDefault           = zstd.SpeedDefault
+	SpeedBetterCompression = zstd.SpeedBetterCompression
+)
+
+// NewCompressor returns the Compressor of the zstd content coding, with the
+// compression level. Each body is compressed and decompressed by a single
+// goroutine, as bodies are compressed concurrently by the server.
+func NewCompressor(level EncoderLevel) httptransport.Compressor {
+	return compressor{level: level}
+}
+
+type compressor struct {
+	level EncoderLevel
+}
+
+func (compressor) ContentEncoding() string {
+	return "zstd"
+}
+
+func (c compressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(c.level), zstd.WithEncoderConcurrency(1))
+}
+
+func (compressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
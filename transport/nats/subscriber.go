@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 
@@ -195,3 +196,20 @@ func DefaultErrorEncoder(_ context.Context, err error, reply string, nc *nats.Co
 		logger.Log("err", err)
 	}
 }
+
+// ProblemErrorEncoder writes the error to the subscriber reply as an RFC 7807
+// problem details document, with the status and kind classified by the
+// errkind package.
+func ProblemErrorEncoder(_ context.Context, err error, reply string, nc *nats.Conn) {
+	logger := log.NewNopLogger()
+
+	b, err := errkind.ProblemOf(err).MarshalJSON()
+	if err != nil {
+		logger.Log("err", err)
+		return
+	}
+
+	if err := nc.Publish(reply, b); err != nil {
+		logger.Log("err", err)
+	}
+}
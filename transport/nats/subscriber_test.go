@@ -13,6 +13,7 @@ import (
 	"github.com/nats-io/nats.go"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
 	natstransport "github.com/go-kit/kit/transport/nats"
 )
 
@@ -413,6 +414,36 @@ func TestErrorEncoder(t *testing.T) {
 	}
 }
 
+func TestProblemErrorEncoder(t *testing.T) {
+	nc := newNatsConn(t)
+	defer nc.Close()
+
+	handler := natstransport.NewSubscriber(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, errkind.New(errkind.PermissionDenied, "not yours")
+		},
+		func(context.Context, *nats.Msg) (interface{}, error) { return struct{}{}, nil },
+		natstransport.EncodeJSONResponse,
+		natstransport.SubscriberErrorEncoder(natstransport.ProblemErrorEncoder),
+	)
+
+	sub, err := nc.QueueSubscribe("natstransport.test", "natstransport", handler.ServeMsg(nc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	r, err := nc.Request("natstransport.test", []byte("test data"), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"detail":"not yours","kind":"permission_denied","status":403,"title":"Forbidden","type":"about:blank"}`
+	if have := string(r.Data); want != have {
+		t.Errorf("ProblemErrorEncoder: got: %s, expected: %s", have, want)
+	}
+}
+
 type noContentResponse struct{}
 
 func TestEncodeNoContent(t *testing.T) {
@@ -0,0 +1,35 @@
+// Package validation provides an endpoint middleware that validates decoded
+// requests, and reports the invalid fields in a structured error, which the
+// HTTP, gRPC and JSON RPC transports encode as a client error.
+//
+// Requests are validated by the rules of the validate struct tags of their
+// fields, and by their Validate method, if they implement Validator. A tag
+// lists the rules a field must follow, separated by commas:
+//
+//	required    the value isn't the zero value, or a nil pointer
+//	min=N       numbers are at least N; strings, slices and maps have at
+//	            least N characters or elements
+//	max=N       numbers are at most N; strings, slices and maps have at most
+//	            N characters or elements
+//	len=N       strings, slices and maps have exactly N characters or elements
+//	oneof=a b   the value is one of the space-separated values
+//	pattern=re  strings match the regular expression, which can't contain
+//	            commas
+//	email       strings are email addresses
+//
+// Rules other than required don't apply to nil pointers. Nested structs,
+// slices and maps are validated recursively, and fields are reported by the
+// path of their JSON names, e.g. "items[0].name", and cycles are skipped.
+// The exported fields of embedded structs are validated as the outer
+// struct's, even if the embedded struct is unexported.
+//
+// Validate methods with a pointer receiver are called on a copy of values
+// that aren't addressable, e.g. map values or requests passed by value.
+// Validate methods of values only reachable through unexported fields are not
+// called.
+//
+// The tags of a struct type are parsed once, when a value of the type is
+// first validated. An unknown or misapplied rule is a programming error:
+// Validate returns it as a plain error rather than an *Error, so that
+// transports encode it as an internal error.
+package validation
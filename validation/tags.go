@@ -0,0 +1,373 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const tagName = "validate"
+
+func validateValue(e *Error, path string, request interface{}) error {
+	if request == nil {
+		return nil
+	}
+	w := walker{e: e, walking: map[visit]bool{}}
+	w.walk(path, reflect.ValueOf(request))
+	return w.err
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// visit is a pointer, map or slice being walked, used to detect cycles.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type walker struct {
+	e       *Error
+	err     error // the first malformed or misapplied tag
+	walking map[visit]bool
+}
+
+// walk validates the fields of v, recursively, then calls its Validate
+// method, if any. Values already being walked, i.e. cycles, are skipped.
+func (w *walker) walk(path string, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Ptr {
+			if !w.enter(visit{ptr: v.Pointer(), typ: v.Type()}) {
+				return
+			}
+			defer w.leave(visit{ptr: v.Pointer(), typ: v.Type()})
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields, err := fieldsOf(v.Type())
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		for _, f := range fields {
+			if f.embedded {
+				w.walk(path, v.Field(f.index)) // embedded fields are promoted
+				continue
+			}
+			fpath := join(path, f.name)
+			w.checkRules(fpath, v.Field(f.index), f.rules)
+			w.walk(fpath, v.Field(f.index))
+		}
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		vis := visit{ptr: v.Pointer(), typ: v.Type(), len: v.Len()}
+		if !w.enter(vis) {
+			return
+		}
+		defer w.leave(vis)
+		w.walkElems(path, v)
+	case reflect.Array:
+		w.walkElems(path, v)
+	}
+
+	if !v.CanInterface() {
+		return // reached through an unexported field
+	}
+	validator, ok := v.Interface().(Validator)
+	if !ok && reflect.PtrTo(v.Type()).Implements(validatorType) {
+		// Validate has a pointer receiver: call it on a copy if the value
+		// isn't addressable, e.g. a map value or a request passed by value.
+		ptr := v
+		if v.CanAddr() {
+			ptr = v.Addr()
+		} else {
+			ptr = reflect.New(v.Type())
+			ptr.Elem().Set(v)
+		}
+		validator, ok = ptr.Interface().(Validator), true
+	}
+	if ok {
+		if err := validator.Validate(); err != nil {
+			addValidatorError(w.e, path, err)
+		}
+	}
+}
+
+func (w *walker) walkElems(path string, v reflect.Value) {
+	if v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			w.walk(fmt.Sprintf("%s[%v]", path, iter.Key().Interface()), iter.Value())
+		}
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		w.walk(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+	}
+}
+
+func (w *walker) enter(vis visit) bool {
+	if w.walking[vis] {
+		return false
+	}
+	w.walking[vis] = true
+	return true
+}
+
+func (w *walker) leave(vis visit) {
+	delete(w.walking, vis)
+}
+
+func (w *walker) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *walker) checkRules(path string, v reflect.Value, rules []rule) {
+	for _, r := range rules {
+		if r.name == "required" {
+			if v.IsZero() {
+				w.e.Add(path, "is required")
+				return
+			}
+			continue
+		}
+		value := v
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return
+			}
+			value = value.Elem()
+		}
+		// Rules on interface fields are only checked against the dynamic
+		// type of their value.
+		if err := r.appliesTo(value.Type()); err != nil {
+			w.fail(fmt.Errorf("validation: %s: %v", path, err))
+			return
+		}
+		if reason := r.check(value); reason != "" {
+			w.e.Add(path, reason)
+		}
+	}
+}
+
+// field is an exported field of a struct, with its parsed rules.
+type field struct {
+	index    int
+	name     string // JSON name
+	embedded bool   // promoted fields are walked with the parent's path
+	rules    []rule
+}
+
+type structFields struct {
+	fields []field
+	err    error
+}
+
+var structs sync.Map // reflect.Type: structFields
+
+// fieldsOf returns the fields of the struct type t, with their rules parsed
+// and checked against the field types. It returns an error if a validate tag
+// is malformed, or has a rule that doesn't apply to its field.
+func fieldsOf(t reflect.Type) ([]field, error) {
+	if sf, ok := structs.Load(t); ok {
+		return sf.(structFields).fields, sf.(structFields).err
+	}
+	var sf structFields
+	for i := 0; i < t.NumField() && sf.err == nil; i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && f.Anonymous {
+			// The exported fields of embedded structs are promoted, even if
+			// the embedded struct itself is unexported.
+			sf.fields = append(sf.fields, field{index: i, embedded: true})
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		rules, err := parseRules(f.Tag.Get(tagName), f.Type)
+		if err != nil {
+			sf.err = fmt.Errorf("validation: %s.%s: %v", t, f.Name, err)
+			break
+		}
+		sf.fields = append(sf.fields, field{index: i, name: name, rules: rules})
+	}
+	if sf.err != nil {
+		sf.fields = nil
+	}
+	structs.Store(t, sf)
+	return sf.fields, sf.err
+}
+
+// rule is a single parsed rule of a validate tag.
+type rule struct {
+	name, arg string
+	n         float64        // min, max and len
+	values    []string       // oneof
+	re        *regexp.Regexp // pattern
+}
+
+// parseRules parses the rules of a validate tag, and checks they apply to
+// values of type t.
+func parseRules(tag string, t reflect.Type) ([]rule, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var rules []rule
+	for _, s := range strings.Split(tag, ",") {
+		r := rule{name: s}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			r.name, r.arg = s[:i], s[i+1:]
+		}
+		var err error
+		switch r.name {
+		case "required", "email":
+		case "min", "max", "len":
+			if r.n, err = strconv.ParseFloat(r.arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s argument %q", r.name, r.arg)
+			}
+		case "oneof":
+			r.values = strings.Fields(r.arg)
+		case "pattern":
+			if r.re, err = regexp.Compile(r.arg); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", r.arg, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", r.name)
+		}
+		if t.Kind() != reflect.Interface {
+			if err := r.appliesTo(t); err != nil {
+				return nil, err
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// appliesTo returns an error if the rule doesn't apply to values of type t.
+func (r rule) appliesTo(t reflect.Type) error {
+	var ok bool
+	switch r.name {
+	case "required", "oneof":
+		ok = true
+	case "min", "max":
+		ok = isNumber(t.Kind()) || hasLength(t.Kind())
+	case "len":
+		ok = hasLength(t.Kind())
+	case "pattern", "email":
+		ok = t.Kind() == reflect.String
+	}
+	if !ok {
+		return errors.New(r.name + " doesn't apply to " + t.String())
+	}
+	return nil
+}
+
+// check returns why v doesn't follow the rule, if it doesn't. The rule must
+// apply to the type of v.
+func (r rule) check(v reflect.Value) string {
+	switch r.name {
+	case "min", "max", "len":
+		if number, ok := numberOf(v); ok {
+			if r.name == "min" && number < r.n {
+				return "must be at least " + r.arg
+			}
+			if r.name == "max" && number > r.n {
+				return "must be at most " + r.arg
+			}
+			return ""
+		}
+		length, _ := lengthOf(v)
+		switch {
+		case r.name == "min" && float64(length) < r.n:
+			return "length must be at least " + r.arg
+		case r.name == "max" && float64(length) > r.n:
+			return "length must be at most " + r.arg
+		case r.name == "len" && float64(length) != r.n:
+			return "length must be " + r.arg
+		}
+	case "oneof":
+		s := fmt.Sprint(v) // v may be reached through an unexported embedded struct
+		for _, value := range r.values {
+			if s == value {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.values, ", ")
+	case "pattern":
+		if !r.re.MatchString(v.String()) {
+			return "must match " + r.arg
+		}
+	case "email":
+		if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+			return "must be an email address"
+		}
+	}
+	return ""
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasLength(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func numberOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func lengthOf(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/errkind"
+)
+
+// Validator is implemented by requests that validate themselves. Validate
+// may return an *Error to report the invalid fields, or any other error to
+// report the request as invalid as a whole.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is the reason why a field of a request is invalid. The field is
+// a path of JSON names, e.g. "items[0].name", or empty if the error is about
+// the request as a whole.
+type FieldError struct {
+	Field  string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Error is returned by the middleware when a request is invalid, and lists
+// why. It's encoded as 400 Bad Request with an RFC 7807 problem body by HTTP
+// transports, as INVALID_ARGUMENT with BadRequest details by gRPC
+// transports, and as invalid params (-32602) by JSON RPC transports.
+type Error struct {
+	Fields []FieldError
+}
+
+// Add appends the reason why field is invalid.
+func (e *Error) Add(field, reason string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: reason})
+}
+
+// Err returns e if any field was added, and nil otherwise, so that Validate
+// methods may collect field errors and return e.Err().
+func (e *Error) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		if f.Field == "" {
+			reasons[i] = f.Reason
+		} else {
+			reasons[i] = f.Field + ": " + f.Reason
+		}
+	}
+	return "invalid request: " + strings.Join(reasons, "; ")
+}
+
+// StatusCode implements the http transport StatusCoder.
+func (e *Error) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// MarshalJSON implements json.Marshaler, as an RFC 7807 problem details
+// object, with the field errors as its "invalid-params" extension member.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	fields := e.Fields
+	if fields == nil {
+		fields = []FieldError{}
+	}
+	return json.Marshal(struct {
+		Type          string       `json:"type"`
+		Title         string       `json:"title"`
+		Status        int          `json:"status"`
+		Detail        string       `json:"detail"`
+		InvalidParams []FieldError `json:"invalid-params"`
+	}{
+		Type:          "about:blank",
+		Title:         http.StatusText(http.StatusBadRequest),
+		Status:        http.StatusBadRequest,
+		Detail:        e.Error(),
+		InvalidParams: fields,
+	})
+}
+
+// GRPCStatus returns the INVALID_ARGUMENT status of the error, with the field
+// errors as BadRequest details. It's used by the grpc status package.
+func (e *Error) GRPCStatus() *status.Status {
+	br := &errdetails.BadRequest{}
+	for _, f := range e.Fields {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Description: f.Reason,
+		})
+	}
+	st := status.New(codes.InvalidArgument, e.Error())
+	if withDetails, err := st.WithDetails(br); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// ErrorKind implements errkind.ErrorKinder.
+func (e *Error) ErrorKind() errkind.Kind {
+	return errkind.Invalid
+}
+
+// ErrorCode implements the jsonrpc transport ErrorCoder, as invalid params.
+func (e *Error) ErrorCode() int {
+	return -32602
+}
+
+// Validate checks request against the rules of its validate struct tags,
+// then calls its Validate method if it implements Validator, as well as the
+// Validate methods of its nested fields. It returns an *Error if request is
+// invalid, and a plain error if one of its tags is malformed, or has a rule
+// that doesn't apply to its field.
+func Validate(request interface{}) error {
+	e := &Error{}
+	if err := validateValue(e, "", request); err != nil {
+		return err
+	}
+	return e.Err()
+}
+
+// Middleware returns an endpoint.Middleware that validates the requests with
+// Validate, and returns the *Error without invoking the next endpoint if
+// they're invalid.
+func Middleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := Validate(request); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// addValidatorError adds the error returned by a Validate method to e, with
+// field paths relative to path.
+func addValidatorError(e *Error, path string, err error) {
+	var ve *Error
+	if !errors.As(err, &ve) {
+		e.Add(path, err.Error())
+		return
+	}
+	for _, f := range ve.Fields {
+		e.Add(join(path, f.Field), f.Reason)
+	}
+}
+
+func join(path, field string) string {
+	switch {
+	case path == "":
+		return field
+	case field == "":
+		return path
+	case strings.HasPrefix(field, "["):
+		return path + field
+	default:
+		return path + "." + field
+	}
+}
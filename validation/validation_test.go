@@ -0,0 +1,255 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+	"github.com/go-kit/kit/validation"
+)
+
+type item struct {
+	Name     string `json:"name" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1,max=10"`
+}
+
+type order struct {
+	Email    string            `json:"email" validate:"required,email"`
+	Currency string            `json:"currency" validate:"oneof=EUR USD"`
+	Code     *string           `json:"code" validate:"pattern=^[A-Z]{3}$"`
+	Items    []item            `json:"items" validate:"min=1"`
+	Notes    map[string]string `json:"notes,omitempty" validate:"max=2"`
+	Discount int               `json:"discount"`
+}
+
+func (o order) Validate() error {
+	e := &validation.Error{}
+	if o.Discount > 0 && len(o.Items) < 2 {
+		e.Add("discount", "requires at least 2 items")
+	}
+	return e.Err()
+}
+
+func TestValidate(t *testing.T) {
+	code := "ab"
+	for _, tc := range []struct {
+		request interface{}
+		want    []validation.FieldError
+	}{
+		{
+			request: order{Email: "a@b.c", Currency: "EUR", Items: []item{{"a", 1}}},
+		},
+		{
+			request: &order{Email: "nope", Currency: "GBP", Code: &code, Discount: 1},
+			want: []validation.FieldError{
+				{Field: "email", Reason: "must be an email address"},
+				{Field: "currency", Reason: "must be one of EUR, USD"},
+				{Field: "code", Reason: "must match ^[A-Z]{3}$"},
+				{Field: "items", Reason: "length must be at least 1"},
+				{Field: "discount", Reason: "requires at least 2 items"},
+			},
+		},
+		{
+			request: order{Email: "a@b.c", Currency: "USD", Items: []item{{"a", 1}, {"", 11}}},
+			want: []validation.FieldError{
+				{Field: "items[1].name", Reason: "is required"},
+				{Field: "items[1].quantity", Reason: "must be at most 10"},
+			},
+		},
+		{
+			request: validatorFunc(func() error { return errors.New("nope") }),
+			want:    []validation.FieldError{{Reason: "nope"}},
+		},
+		{
+			request: "not a struct",
+		},
+	} {
+		err := validation.Validate(tc.request)
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("%T: want no error, have %v", tc.request, err)
+			}
+			continue
+		}
+		var ve *validation.Error
+		if !errors.As(err, &ve) {
+			t.Errorf("%T: want *validation.Error, have %v", tc.request, err)
+			continue
+		}
+		if want, have := fmt.Sprint(tc.want), fmt.Sprint(ve.Fields); want != have {
+			t.Errorf("want %s, have %s", want, have)
+		}
+	}
+}
+
+type validatorFunc func() error
+
+func (f validatorFunc) Validate() error { return f() }
+
+func TestMiddleware(t *testing.T) {
+	var invoked bool
+	e := validation.Middleware()(func(context.Context, interface{}) (interface{}, error) {
+		invoked = true
+		return nil, nil
+	})
+	if _, err := e(context.Background(), item{}); err == nil {
+		t.Error("want error, have none")
+	}
+	if invoked {
+		t.Error("invalid request reached the endpoint")
+	}
+	if _, err := e(context.Background(), item{Name: "a", Quantity: 1}); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+	if !invoked {
+		t.Error("valid request didn't reach the endpoint")
+	}
+}
+
+func TestErrorEncoding(t *testing.T) {
+	err := validation.Validate(item{Quantity: 1})
+
+	// HTTP
+	rec := httptest.NewRecorder()
+	httptransport.DefaultErrorEncoder(context.Background(), err, rec)
+	if want, have := http.StatusBadRequest, rec.Code; want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+	if want, have := `{"type":"about:blank","title":"Bad Request","status":400,`+
+		`"detail":"invalid request: name: is required","invalid-params":[{"name":"name","reason":"is required"}]}`,
+		strings.TrimSpace(rec.Body.String()); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	// gRPC
+	st := status.Convert(err)
+	if want, have := codes.InvalidArgument, st.Code(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("want 1 detail, have %d", len(details))
+	}
+	br, ok := details[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("want *errdetails.BadRequest, have %T", details[0])
+	}
+	if want, have := "name", br.FieldViolations[0].Field; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// JSON RPC
+	if want, have := jsonrpc.InvalidParamsError, err.(jsonrpc.ErrorCoder).ErrorCode(); want != have {
+		t.Errorf("want %d, have %d", want, have)
+	}
+}
+
+type node struct {
+	Name string `json:"name" validate:"required"`
+	Next *node  `json:"next"`
+}
+
+func TestValidateCycles(t *testing.T) {
+	a := &node{Name: "a"}
+	b := &node{Next: a}
+	a.Next = b
+	err := validation.Validate(a)
+	var ve *validation.Error
+	if !errors.As(err, &ve) {
+		t.Fatalf("want *validation.Error, have %v", err)
+	}
+	if want, have := fmt.Sprint([]validation.FieldError{{Field: "next.name", Reason: "is required"}}), fmt.Sprint(ve.Fields); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+type audit struct {
+	Author string `json:"author" validate:"required"`
+	Status string `json:"status" validate:"oneof=draft final"`
+}
+
+type document struct {
+	audit
+	Title string `json:"title"`
+}
+
+type page struct {
+	Number int `json:"number"`
+}
+
+func (p *page) Validate() error {
+	e := &validation.Error{}
+	if p.Number <= 0 {
+		e.Add("number", "must be positive")
+	}
+	return e.Err()
+}
+
+func TestValidateEmbeddedUnexported(t *testing.T) {
+	err := validation.Validate(document{audit: audit{Status: "lost"}})
+	var ve *validation.Error
+	if !errors.As(err, &ve) {
+		t.Fatalf("want *validation.Error, have %v", err)
+	}
+	want := []validation.FieldError{{Field: "author", Reason: "is required"}, {Field: "status", Reason: "must be one of draft, final"}}
+	if want, have := fmt.Sprint(want), fmt.Sprint(ve.Fields); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func TestValidatePointerReceiver(t *testing.T) {
+	for _, request := range []interface{}{
+		page{},
+		map[string]page{"first": {}},
+	} {
+		if err := validation.Validate(request); err == nil {
+			t.Errorf("%#v: want error, have none", request)
+		}
+	}
+	if err := validation.Validate(map[string]page{"first": {Number: 1}}); err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+	for _, request := range []interface{}{
+		struct {
+			N int `validate:"min=one"`
+		}{},
+		struct {
+			N int `validate:"nope"`
+		}{},
+		struct {
+			N int `validate:"pattern=^a$"`
+		}{},
+		struct {
+			S string `validate:"pattern=("`
+		}{},
+		struct {
+			N bool `validate:"len=1"`
+		}{},
+		struct {
+			V interface{} `validate:"email"`
+		}{V: 1},
+	} {
+		err := validation.Validate(request)
+		if err == nil {
+			t.Errorf("%#v: want error, have none", request)
+			continue
+		}
+		var ve *validation.Error
+		if errors.As(err, &ve) {
+			t.Errorf("%#v: want plain error, have %v", request, err)
+		}
+	}
+}